@@ -14,6 +14,7 @@ import (
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -31,6 +32,15 @@ func (e *Exchange) Init() *errs.Error {
 			Proxy: http.ProxyURL(proxy),
 		}
 	}
+	cassettePath := utils.GetMapVal(e.Options, OptHttpCassette, "")
+	if cassettePath != "" {
+		mode := utils.GetMapVal(e.Options, OptCassetteMode, CassetteReplay)
+		cassette, err := NewCassette(cassettePath, mode, e.HttpClient.Transport)
+		if err != nil {
+			return err
+		}
+		e.HttpClient.Transport = cassette
+	}
 	e.parseOptCreds()
 	utils.SetFieldBy(&e.UserAgent, e.Options, OptUserAgent, "")
 	if e.EnableRateLimit == BoolNull {
@@ -56,13 +66,30 @@ func (e *Exchange) Init() *errs.Error {
 	utils.SetFieldBy(&e.MarketType, e.Options, OptMarketType, MarketSpot)
 	utils.SetFieldBy(&e.ContractType, e.Options, OptContractType, "")
 	utils.SetFieldBy(&e.TimeInForce, e.Options, OptTimeInForce, DefTimeInForce)
+	utils.SetFieldBy(&e.KlineClosedOnly, e.Options, OptKlineClosedOnly, false)
+	utils.SetFieldBy(&e.MarketCachePath, e.Options, OptMarketCache, "")
+	utils.SetFieldBy(&e.MarketCacheSecs, e.Options, OptMarketCacheSecs, 3600)
+	utils.SetFieldBy(&e.ValidateMode, e.Options, OptValidateOrder, "")
+	utils.SetFieldBy(&e.DecimalMode, e.Options, OptDecimalMode, false)
+	recordPath := utils.GetMapVal(e.Options, OptWsRecord, "")
+	if recordPath != "" && e.WsRecorder == nil {
+		recorder, err := NewWsRecorder(recordPath)
+		if err != nil {
+			return err
+		}
+		e.WsRecorder = recorder
+	}
 	e.CurrCodeMap = DefCurrCodeMap
 	e.CurrenciesById = map[string]*Currency{}
 	e.CurrenciesByCode = map[string]*Currency{}
 	e.WSClients = map[string]*WsClient{}
 	e.WsOutChans = map[string]interface{}{}
 	e.WsChanRefs = map[string]map[string]struct{}{}
+	e.WsChanPolicies = map[string]*WsChanPolicy{}
+	e.wsDropped = map[string]int64{}
+	e.coalescers = map[string]*outCoalescer{}
 	e.OrderBooks = map[string]*OrderBook{}
+	e.OdBookStats = map[string]*OdBookStat{}
 	e.MarkPrices = map[string]map[string]float64{}
 	e.KeyTimeStamps = map[string]int64{}
 	return nil
@@ -91,21 +118,67 @@ func (e *Exchange) SafeCurrencyCode(currId string) string {
 	return e.SafeCurrency(currId).Code
 }
 
-func doLoadMarkets(e *Exchange, params *map[string]interface{}) {
+func doLoadMarkets(e *Exchange, reload bool, params *map[string]interface{}) {
+	var cache *MarketCache
+	if e.MarketCachePath != "" && !reload {
+		cache = e.readMarketCache()
+		if cache != nil {
+			age := e.MilliSeconds() - cache.Time
+			ttl := int64(e.MarketCacheSecs) * 1000
+			if age <= ttl {
+				e.applyMarketCache(cache)
+				if age > ttl/2 {
+					// 缓存即将过期，后台刷新，当前请求直接使用缓存
+					go e.refreshMarkets(params)
+				}
+				e.MarketsWait <- e.Markets
+				return
+			}
+		}
+	}
+	currencies, markets, err := fetchMarketsData(e, params)
+	if err == nil && len(markets) == 0 && cache != nil {
+		err = errs.MarketNotLoad
+	}
+	if err != nil {
+		if cache != nil {
+			log.Warn("load markets fail, use stale market cache", zap.String("exg", e.Name),
+				zap.String("path", e.MarketCachePath), zap.Int64("age_secs", (e.MilliSeconds()-cache.Time)/1000),
+				zap.Error(err))
+			e.applyMarketCache(cache)
+			e.MarketsWait <- e.Markets
+			return
+		}
+		e.MarketsWait <- err
+		return
+	}
+	setMarkets(e, currencies, markets)
+	e.marketsTime = e.MilliSeconds()
+	e.SaveMarketCache()
+	e.MarketsWait <- markets
+}
+
+func fetchMarketsData(e *Exchange, params *map[string]interface{}) (CurrencyMap, MarketMap, *errs.Error) {
 	var currencies CurrencyMap
 	var err *errs.Error
 	if e.HasApi("fetchCurrencies") {
 		currencies, err = e.FetchCurrencies(params)
 		if err != nil {
-			e.MarketsWait <- err
-			return
+			return nil, nil, err
 		}
 	}
 	markets, err := e.FetchMarkets(params)
 	if err != nil {
-		e.MarketsWait <- err
-		return
+		return nil, nil, err
 	}
+	return currencies, markets, nil
+}
+
+/*
+setMarkets
+更新Markets及其索引，currencies为nil时从markets中生成
+*/
+func setMarkets(e *Exchange, currencies CurrencyMap, markets MarketMap) {
 	// 现货的放在前面
 	items := make([]*Market, 0, len(markets))
 	for _, v := range markets {
@@ -134,6 +207,7 @@ func doLoadMarkets(e *Exchange, params *map[string]interface{}) {
 			IDs = append(IDs, item.ID)
 		}
 	}
+	oldMarkets := e.Markets
 	e.Markets = markets
 	sort.Strings(symbols)
 	sort.Strings(IDs)
@@ -151,14 +225,14 @@ func doLoadMarkets(e *Exchange, params *map[string]interface{}) {
 				curr := Currency{
 					ID:        market.BaseID,
 					Code:      market.Base,
-					Precision: float64(market.Precision.Base),
+					Precision: market.Precision.Base,
 				}
 				if curr.ID == "" {
 					curr.ID = market.Base
 				}
 				if curr.Precision == 0 {
 					if market.Precision.Amount > 0 {
-						curr.Precision = float64(market.Precision.Amount)
+						curr.Precision = market.Precision.Amount
 					} else {
 						curr.Precision = defCurrPrecision
 					}
@@ -169,14 +243,14 @@ func doLoadMarkets(e *Exchange, params *map[string]interface{}) {
 				curr := Currency{
 					ID:        market.QuoteID,
 					Code:      market.Quote,
-					Precision: float64(market.Precision.Quote),
+					Precision: market.Precision.Quote,
 				}
 				if curr.ID == "" {
 					curr.ID = market.Quote
 				}
 				if curr.Precision == 0 {
 					if market.Precision.Price > 0 {
-						curr.Precision = float64(market.Precision.Price)
+						curr.Precision = market.Precision.Price
 					} else {
 						curr.Precision = defCurrPrecision
 					}
@@ -212,14 +286,14 @@ func doLoadMarkets(e *Exchange, params *map[string]interface{}) {
 	for _, v := range e.CurrenciesByCode {
 		e.CurrenciesById[v.ID] = v
 	}
-	e.MarketsWait <- markets
+	e.emitMarketChanges(oldMarkets, markets)
 }
 
 func (e *Exchange) LoadMarkets(reload bool, params *map[string]interface{}) (MarketMap, *errs.Error) {
 	if reload || e.Markets == nil {
 		if e.MarketsWait == nil {
 			e.MarketsWait = make(chan interface{})
-			go doLoadMarkets(e, params)
+			go doLoadMarkets(e, reload, params)
 		}
 		result := <-e.MarketsWait
 		e.MarketsWait = nil
@@ -231,6 +305,7 @@ func (e *Exchange) LoadMarkets(reload bool, params *map[string]interface{}) (Mar
 		}
 		return nil, errs.NewMsg(errs.CodeUnsupportMarket, "unknown markets type: %t", result)
 	}
+	e.applyRefreshed()
 	return e.Markets, nil
 }
 
@@ -242,9 +317,9 @@ func (e *Exchange) GetPriceOnePip(pair string) (float64, *errs.Error) {
 	if mar, ok := markets[pair]; ok {
 		precision := mar.Precision.Price
 		if e.PrecisionMode == PrecModeTickSize {
-			return float64(precision), nil
+			return precision, nil
 		} else {
-			return 1 / math.Pow(10, float64(precision)), nil
+			return 1 / math.Pow(10, precision), nil
 		}
 	}
 	return 0, errs.NoMarketForPair
@@ -398,10 +473,22 @@ func (e *Exchange) FetchOpenOrders(symbol string, since int64, limit int, params
 	return nil, errs.NotImplement
 }
 
+func (e *Exchange) FetchOrder(symbol, orderId string, params *map[string]interface{}) (*Order, *errs.Error) {
+	return nil, errs.NotImplement
+}
+
+func (e *Exchange) FetchMyLiquidations(symbol string, since int64, limit int, params *map[string]interface{}) ([]*Liquidation, *errs.Error) {
+	return nil, errs.NotImplement
+}
+
 func (e *Exchange) FetchOrderBook(symbol string, limit int, params *map[string]interface{}) (*OrderBook, *errs.Error) {
 	return nil, errs.NotImplement
 }
 
+func (e *Exchange) FetchOptionChain(underlying string, params *map[string]interface{}) (*OptionChain, *errs.Error) {
+	return nil, errs.NotImplement
+}
+
 func (e *Exchange) CreateOrder(symbol, odType, side string, amount float64, price float64, params *map[string]interface{}) (*Order, *errs.Error) {
 	return nil, errs.NotImplement
 }
@@ -418,6 +505,10 @@ func (e *Exchange) LoadLeverageBrackets(reload bool, params *map[string]interfac
 	return errs.NotImplement
 }
 
+func (e *Exchange) FetchLeverageTiers(symbols []string, params *map[string]interface{}) (map[string][]*LeverageTier, *errs.Error) {
+	return nil, errs.NotImplement
+}
+
 func (e *Exchange) CalculateFee(symbol, odType, side string, amount float64, price float64, isMaker bool,
 	params *map[string]interface{}) (*Fee, *errs.Error) {
 	if odType == OdTypeMarket && isMaker {
@@ -485,7 +576,7 @@ func (e *Exchange) PriceOnePip(symbol string) (float64, *errs.Error) {
 	if err != nil {
 		return 0, err
 	}
-	prec := float64(market.Precision.Price)
+	prec := market.Precision.Price
 	if e.PrecisionMode == PrecModeTickSize {
 		return prec, nil
 	}
@@ -508,6 +599,37 @@ func (e *Exchange) MilliSeconds() int64 {
 	return time.Now().UnixMilli()
 }
 
+/*
+GetOdBookStat
+返回订单簿同步统计的副本，不存在时返回nil
+*/
+func (e *Exchange) GetOdBookStat(symbol string) *OdBookStat {
+	e.statLock.Lock()
+	defer e.statLock.Unlock()
+	stat, ok := e.OdBookStats[symbol]
+	if !ok {
+		return nil
+	}
+	res := *stat
+	return &res
+}
+
+/*
+UpdateOdBookStat
+加锁更新订单簿同步统计，不存在时创建，返回更新后的副本
+*/
+func (e *Exchange) UpdateOdBookStat(symbol string, update func(stat *OdBookStat)) OdBookStat {
+	e.statLock.Lock()
+	defer e.statLock.Unlock()
+	stat, ok := e.OdBookStats[symbol]
+	if !ok {
+		stat = &OdBookStat{}
+		e.OdBookStats[symbol] = stat
+	}
+	update(stat)
+	return *stat
+}
+
 func (e *Exchange) Nonce() int64 {
 	return time.Now().UnixMilli() - e.TimeDelay
 }
@@ -532,12 +654,15 @@ func (e *Exchange) RequestApi(ctx context.Context, endpoint string, params *map[
 		return &HttpRes{Error: errs.ApiNotSupport}
 	}
 	if e.EnableRateLimit == BoolTrue {
-		elapsed := e.MilliSeconds() - e.lastRequestMS
-		sleepMS := int64(float64(e.RateLimit) * api.Cost)
-		if elapsed < sleepMS {
-			time.Sleep(time.Duration(sleepMS-elapsed) * time.Millisecond)
+		// 并发请求时依次预留发送时间
+		e.rateLock.Lock()
+		now := e.MilliSeconds()
+		sendMS := max(now, e.lastRequestMS+int64(float64(e.RateLimit)*api.Cost))
+		e.lastRequestMS = sendMS
+		e.rateLock.Unlock()
+		if sendMS > now {
+			time.Sleep(time.Duration(sendMS-now) * time.Millisecond)
 		}
-		e.lastRequestMS = e.MilliSeconds()
 	}
 	sign := e.Sign(api, params)
 	if sign.Error != nil {
@@ -706,32 +831,73 @@ func (e *Exchange) LoadArgsMarketType(args map[string]interface{}, symbols ...st
 	return marketType, contractType, nil
 }
 
-func (e *Exchange) PrecAmount(m *Market, amount float64) (string, *errs.Error) {
-	res, err := utils.PrecFloat64Str(amount, m.Precision.Amount, false)
+/*
+PrecNum
+按交易所的PrecisionMode对数字取近似值，precision为Market.Precision中的值，
+rounding为RoundNearest/RoundDown/RoundUp。
+PrecModeTickSize下precision为0时表示未知，原样返回
+*/
+func (e *Exchange) PrecNum(num, precision float64, rounding int) (string, *errs.Error) {
+	mode := e.PrecisionMode
+	if mode == 0 {
+		// 未调用Init时默认按小数位数处理
+		mode = PrecModeDecimalPlace
+	} else if mode == PrecModeTickSize && precision <= 0 {
+		return strconv.FormatFloat(num, 'f', -1, 64), nil
+	}
+	res, err := utils.PrecFloat64Round(num, mode, precision, rounding)
 	if err != nil {
 		return "", errs.New(errs.CodePrecDecFail, err)
 	}
 	return res, nil
 }
 
-func (e *Exchange) precPriceCost(m *Market, value float64, round bool) (string, *errs.Error) {
-	res, err := utils.PrecFloat64Str(value, m.Precision.Price, round)
+/*
+PrecNumFloat
+同PrecNum，返回浮点数
+*/
+func (e *Exchange) PrecNumFloat(num, precision float64, rounding int) (float64, *errs.Error) {
+	text, err := e.PrecNum(num, precision, rounding)
 	if err != nil {
-		return "", errs.New(errs.CodePrecDecFail, err)
+		return 0, err
+	}
+	res, err2 := strconv.ParseFloat(text, 64)
+	if err2 != nil {
+		return 0, errs.New(errs.CodePrecDecFail, err2)
 	}
 	return res, nil
 }
 
+func (e *Exchange) PrecAmount(m *Market, amount float64) (string, *errs.Error) {
+	return e.PrecNum(amount, m.Precision.Amount, RoundDown)
+}
+
 func (e *Exchange) PrecPrice(m *Market, price float64) (string, *errs.Error) {
-	return e.precPriceCost(m, price, true)
+	return e.PrecNum(price, m.Precision.Price, RoundNearest)
 }
 
 func (e *Exchange) PrecCost(m *Market, cost float64) (string, *errs.Error) {
-	return e.precPriceCost(m, cost, false)
+	return e.PrecNum(cost, m.Precision.Price, RoundDown)
 }
 
 func (e *Exchange) PrecFee(m *Market, fee float64) (string, *errs.Error) {
-	return e.precPriceCost(m, fee, true)
+	return e.PrecNum(fee, m.Precision.Price, RoundNearest)
+}
+
+/*
+PrecAmountRound
+按指定取整方式处理数量，如平仓时向上取整确保全部平掉
+*/
+func (e *Exchange) PrecAmountRound(m *Market, amount float64, rounding int) (string, *errs.Error) {
+	return e.PrecNum(amount, m.Precision.Amount, rounding)
+}
+
+/*
+PrecPriceRound
+按指定取整方式处理价格，如买单向下、卖单向上取整避免吃单
+*/
+func (e *Exchange) PrecPriceRound(m *Market, price float64, rounding int) (string, *errs.Error) {
+	return e.PrecNum(price, m.Precision.Price, rounding)
 }
 
 /*
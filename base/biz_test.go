@@ -1,6 +1,7 @@
 package base
 
 import (
+	"github.com/banbox/banexg/errs"
 	"testing"
 )
 
@@ -71,3 +72,69 @@ func TestCalcFee(t *testing.T) {
 		t.Errorf("maker fee: %v", fee)
 	}
 }
+
+func TestPrecTickSize(t *testing.T) {
+	mar := &Market{Symbol: "FOO/USD:FOO", Precision: &Precision{Price: 0.5, Amount: 5}}
+	e := Exchange{Options: map[string]interface{}{OptPrecisionMode: PrecModeTickSize}}
+	e.Init()
+	items := []struct {
+		text string
+		fn   func() (string, *errs.Error)
+	}{
+		{"1.5", func() (string, *errs.Error) { return e.PrecPrice(mar, 1.26) }},
+		{"1", func() (string, *errs.Error) { return e.PrecPriceRound(mar, 1.49, RoundDown) }},
+		{"1.5", func() (string, *errs.Error) { return e.PrecPriceRound(mar, 1.01, RoundUp) }},
+		{"10", func() (string, *errs.Error) { return e.PrecAmount(mar, 14.9) }},
+		{"15", func() (string, *errs.Error) { return e.PrecAmountRound(mar, 10.1, RoundUp) }},
+	}
+	for i, it := range items {
+		res, err := it.fn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != it.text {
+			t.Errorf("case %d: expect %s, got %s", i, it.text, res)
+		}
+	}
+	pip, err := e.PriceOnePip(mar.Symbol)
+	if err == nil || pip != 0 {
+		// 未加载到Markets中，应返回错误
+		t.Errorf("PriceOnePip should fail for unknown market")
+	}
+	e.Markets = MarketMap{mar.Symbol: mar}
+	if pip, _ = e.PriceOnePip(mar.Symbol); pip != 0.5 {
+		t.Errorf("PriceOnePip expect 0.5, got %v", pip)
+	}
+
+	e2 := Exchange{}
+	e2.Init()
+	res, _ := e2.PrecPrice(&Market{Precision: &Precision{Price: 2}}, 1.236)
+	if res != "1.24" {
+		t.Errorf("decimal place mode expect 1.24, got %s", res)
+	}
+}
+
+func TestOdBookStat(t *testing.T) {
+	e := Exchange{OdBookStats: map[string]*OdBookStat{}}
+	if e.GetOdBookStat("BTC/USDT") != nil {
+		t.Error("GetOdBookStat should not create stat")
+	}
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			e.UpdateOdBookStat("BTC/USDT", func(stat *OdBookStat) {
+				stat.Gaps += 1
+			})
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		if stat := e.GetOdBookStat("BTC/USDT"); stat != nil {
+			stat.Gaps = -1
+		}
+	}
+	<-done
+	if stat := e.GetOdBookStat("BTC/USDT"); stat == nil || stat.Gaps != 100 {
+		t.Errorf("bad stat: %v", stat)
+	}
+}
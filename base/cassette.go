@@ -0,0 +1,228 @@
+package base
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"github.com/bytedance/sonic"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	CassetteRecord = "record" // 请求真实接口，并将请求和响应保存到文件
+	CassetteReplay = "replay" // 从文件返回匹配的响应，不访问网络
+)
+
+var (
+	// CassetteSkipParams 每次请求都会变化的参数，匹配时忽略，也不保存
+	CassetteSkipParams = map[string]bool{"timestamp": true, "signature": true, "recvWindow": true}
+	// CassetteScrubParams 敏感参数，保存时替换为***，匹配时只要求存在
+	CassetteScrubParams = map[string]bool{"listenKey": true}
+)
+
+/*
+CassetteItem
+录制的一次HTTP请求和响应。请求头不保存，避免泄露ApiKey
+*/
+type CassetteItem struct {
+	Method  string `json:"method"`
+	URL     string `json:"url"`    // 不含查询参数
+	Params  string `json:"params"` // 标准化后的查询参数和表单，按key排序
+	Status  int    `json:"status"`
+	RspType string `json:"rsp_type"`
+	Body    string `json:"body"`
+}
+
+func (i *CassetteItem) key() string {
+	return i.Method + " " + i.URL + "?" + i.Params
+}
+
+/*
+Cassette
+http.RoundTripper实现，录制或重放HTTP请求。可通过OptHttpCassette和OptCassetteMode启用，
+刷新测试数据时用录制模式运行一次测试即可
+*/
+type Cassette struct {
+	Path   string
+	Mode   string
+	Items  []*CassetteItem
+	next   http.RoundTripper
+	lock   sync.Mutex
+	cursor map[string]int  // key: 重放的下一个序号，同一请求多次录制时按顺序返回
+	fresh  map[string]bool // key: 本次录制过，首次录制时删除文件中的旧记录
+}
+
+/*
+NewCassette
+读取录制文件并创建Cassette，文件不存在时录制模式从空开始，重放模式返回错误。
+next为录制时实际发送请求的RoundTripper，为nil时使用http.DefaultTransport
+*/
+func NewCassette(path, mode string, next http.RoundTripper) (*Cassette, *errs.Error) {
+	if mode != CassetteRecord && mode != CassetteReplay {
+		return nil, errs.NewMsg(errs.CodeParamInvalid, "invalid cassette mode: %s", mode)
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	c := &Cassette{
+		Path:   path,
+		Mode:   mode,
+		Items:  make([]*CassetteItem, 0),
+		next:   next,
+		cursor: map[string]int{},
+		fresh:  map[string]bool{},
+	}
+	err := utils.ReadJsonFile(path, &c.Items)
+	if err != nil {
+		if mode == CassetteReplay || !os.IsNotExist(err) {
+			return nil, errs.New(errs.CodeIOReadFail, err)
+		}
+	}
+	return c, nil
+}
+
+/*
+normCassetteParams
+合并查询参数和表单请求体，去掉CassetteSkipParams，遮盖CassetteScrubParams，按key排序
+*/
+func normCassetteParams(query, body string) string {
+	var parts []string
+	for _, text := range []string{query, body} {
+		if text != "" {
+			parts = append(parts, text)
+		}
+	}
+	raw := strings.Join(parts, "&")
+	if raw == "" {
+		return ""
+	}
+	args, err := url.ParseQuery(raw)
+	if err != nil {
+		return raw
+	}
+	for k := range args {
+		if CassetteSkipParams[k] {
+			delete(args, k)
+		} else if CassetteScrubParams[k] {
+			args.Set(k, "***")
+		}
+	}
+	return args.Encode()
+}
+
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	reqUrl := *req.URL
+	reqUrl.RawQuery = ""
+	reqUrl.Fragment = ""
+	item := &CassetteItem{
+		Method: req.Method,
+		URL:    reqUrl.String(),
+		Params: normCassetteParams(req.URL.RawQuery, string(body)),
+	}
+	if c.Mode == CassetteReplay {
+		return c.replay(req, item), nil
+	}
+	rsp, err := c.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	rspData, err := io.ReadAll(rsp.Body)
+	_ = rsp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	rsp.Body = io.NopCloser(bytes.NewReader(rspData))
+	item.Status = rsp.StatusCode
+	item.RspType = rsp.Header.Get("Content-Type")
+	item.Body = string(rspData)
+	c.record(item)
+	return rsp, nil
+}
+
+func (c *Cassette) record(item *CassetteItem) {
+	key := item.key()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.fresh[key] {
+		c.fresh[key] = true
+		items := make([]*CassetteItem, 0, len(c.Items))
+		for _, old := range c.Items {
+			if old.key() != key {
+				items = append(items, old)
+			}
+		}
+		c.Items = items
+	}
+	c.Items = append(c.Items, item)
+	if err := c.save(); err != nil {
+		log.Error("save cassette fail", zap.String("path", c.Path), zap.Error(err))
+	}
+}
+
+func (c *Cassette) replay(req *http.Request, item *CassetteItem) *http.Response {
+	key := item.key()
+	c.lock.Lock()
+	matches := make([]*CassetteItem, 0, 1)
+	for _, old := range c.Items {
+		if old.key() == key {
+			matches = append(matches, old)
+		}
+	}
+	var hit *CassetteItem
+	if len(matches) > 0 {
+		idx := c.cursor[key]
+		if idx >= len(matches) {
+			// 录制的次数不够时重复最后一次
+			idx = len(matches) - 1
+		}
+		hit = matches[idx]
+		c.cursor[key] = idx + 1
+	}
+	c.lock.Unlock()
+	header := http.Header{}
+	if hit == nil {
+		log.Warn("no cassette record for request", zap.String("req", key))
+		header.Set("Content-Type", "application/json")
+		text := fmt.Sprintf(`{"code":-1,"msg":"no cassette record for %s"}`, strings.ReplaceAll(key, `"`, `'`))
+		hit = &CassetteItem{Status: http.StatusNotFound, Body: text}
+	} else if hit.RspType != "" {
+		header.Set("Content-Type", hit.RspType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", hit.Status, http.StatusText(hit.Status)),
+		StatusCode:    hit.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(hit.Body)),
+		ContentLength: int64(len(hit.Body)),
+		Request:       req,
+	}
+}
+
+func (c *Cassette) save() error {
+	data, err := sonic.ConfigStd.MarshalIndent(c.Items, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFile(c.Path, data)
+}
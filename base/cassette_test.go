@@ -0,0 +1,59 @@
+package base
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCassette(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits += 1
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"symbol":"` + r.URL.Query().Get("symbol") + `"}`))
+	}))
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	get := func(client *http.Client, query string) (int, string) {
+		rsp, err := client.Get(srv.URL + "/api/v3/order?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rsp.Body.Close()
+		data, _ := io.ReadAll(rsp.Body)
+		return rsp.StatusCode, string(data)
+	}
+
+	rec, err := NewCassette(path, CassetteRecord, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: rec}
+	get(client, "symbol=BTCUSDT&timestamp=1&signature=abc")
+	get(client, "symbol=ETHUSDT&listenKey=secretKey&timestamp=2&signature=def")
+	if hits != 2 || len(rec.Items) != 2 {
+		t.Fatalf("record fail, hits: %d, items: %d", hits, len(rec.Items))
+	}
+	if strings.Contains(rec.Items[1].Params, "secretKey") || strings.Contains(rec.Items[1].Params, "signature") {
+		t.Errorf("params not scrubbed: %s", rec.Items[1].Params)
+	}
+	srv.Close()
+
+	rep, err := NewCassette(path, CassetteReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = &http.Client{Transport: rep}
+	// 参数顺序、时间戳和签名不同也能匹配
+	status, body := get(client, "signature=xyz&timestamp=99&symbol=BTCUSDT")
+	if status != 200 || body != `{"symbol":"BTCUSDT"}` {
+		t.Errorf("replay fail: %d %s", status, body)
+	}
+	status, _ = get(client, "symbol=XRPUSDT&timestamp=99&signature=xyz")
+	if status != http.StatusNotFound {
+		t.Errorf("unmatched request should be 404, got %d", status)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/banbox/banexg/log"
 	"github.com/banbox/banexg/utils"
 	"github.com/bytedance/sonic"
+	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
 	"sort"
 	"strconv"
@@ -103,18 +104,19 @@ func (ob *OrderBook) SetSide(text string, isBuy bool) {
 		log.Error("unmarshal od book side fail", zap.Error(err))
 		return
 	}
-	var valArr = make([][2]float64, len(arr))
-	for i, row := range arr {
-		val1, _ := strconv.ParseFloat(row[0], 64)
-		val2, _ := strconv.ParseFloat(row[1], 64)
-		valArr[i][0] = val1
-		valArr[i][1] = val2
-	}
+	ob.UpdateSide(arr, isBuy)
+}
+
+/*
+UpdateSide
+使用[price, size]字符串数组更新买单或卖单，size为0表示删除此价格
+*/
+func (ob *OrderBook) UpdateSide(rows [][2]string, isBuy bool) {
+	side := ob.Asks
 	if isBuy {
-		ob.Bids.Update(valArr)
-	} else {
-		ob.Asks.Update(valArr)
+		side = ob.Bids
 	}
+	side.UpdateStr(rows)
 }
 
 func NewOrderBookSide(isBuy bool, depth int, deltas [][2]float64) *OrderBookSide {
@@ -135,7 +137,37 @@ func (obs *OrderBookSide) Update(deltas [][2]float64) {
 	obs.Limit()
 }
 
+/*
+UpdateStr
+使用[price, size]字符串数组更新，Exact时同时更新DecRows
+*/
+func (obs *OrderBookSide) UpdateStr(rows [][2]string) {
+	for _, row := range rows {
+		price, _ := strconv.ParseFloat(row[0], 64)
+		size, _ := strconv.ParseFloat(row[1], 64)
+		if obs.Exact {
+			dec := [2]decimal.Decimal{ParseDec(row[0]), ParseDec(row[1])}
+			obs.storeRow([2]float64{price, size}, &dec)
+		} else {
+			obs.storeRow([2]float64{price, size}, nil)
+		}
+	}
+	obs.Limit()
+}
+
 func (obs *OrderBookSide) StoreArray(delta [2]float64) {
+	var dec *[2]decimal.Decimal
+	if obs.Exact {
+		dec = &[2]decimal.Decimal{decimal.NewFromFloat(delta[0]), decimal.NewFromFloat(delta[1])}
+	}
+	obs.storeRow(delta, dec)
+}
+
+/*
+storeRow
+更新一个价格档位，dec不为nil时同步更新DecRows
+*/
+func (obs *OrderBookSide) storeRow(delta [2]float64, dec *[2]decimal.Decimal) {
 	price := delta[0]
 	size := delta[1]
 	indexPrice := price
@@ -147,6 +179,9 @@ func (obs *OrderBookSide) StoreArray(delta [2]float64) {
 	if size > 0 {
 		if index < len(obs.Index) && obs.Index[index] == indexPrice {
 			obs.Rows[index][1] = size
+			if dec != nil {
+				obs.DecRows[index][1] = dec[1]
+			}
 		} else {
 			obs.Index = append(obs.Index, 0)
 			copy(obs.Index[index+1:], obs.Index[index:])
@@ -155,10 +190,18 @@ func (obs *OrderBookSide) StoreArray(delta [2]float64) {
 			obs.Rows = append(obs.Rows, [2]float64{})
 			copy(obs.Rows[index+1:], obs.Rows[index:])
 			obs.Rows[index] = delta
+			if dec != nil {
+				obs.DecRows = append(obs.DecRows, [2]decimal.Decimal{})
+				copy(obs.DecRows[index+1:], obs.DecRows[index:])
+				obs.DecRows[index] = *dec
+			}
 		}
 	} else if index < len(obs.Index) && obs.Index[index] == indexPrice {
 		obs.Index = append(obs.Index[:index], obs.Index[index+1:]...)
 		obs.Rows = append(obs.Rows[:index], obs.Rows[index+1:]...)
+		if dec != nil {
+			obs.DecRows = append(obs.DecRows[:index], obs.DecRows[index+1:]...)
+		}
 	}
 }
 
@@ -171,4 +214,22 @@ func (obs *OrderBookSide) Limit() {
 		obs.Rows = obs.Rows[:len(obs.Rows)-1]
 		obs.Index = obs.Index[:len(obs.Index)-1]
 	}
+	if len(obs.DecRows) > len(obs.Rows) {
+		obs.DecRows = obs.DecRows[:len(obs.Rows)]
+	}
+}
+
+/*
+ParseDec
+解析交易所返回的数字字符串为decimal，为空或无效时返回0
+*/
+func ParseDec(text string) decimal.Decimal {
+	if text == "" {
+		return decimal.Zero
+	}
+	res, err := decimal.NewFromString(text)
+	if err != nil {
+		return decimal.Zero
+	}
+	return res
 }
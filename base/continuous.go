@@ -0,0 +1,345 @@
+package base
+
+import (
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/utils"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const msecsPerDay = int64(86400000)
+
+/*
+ContSymbol
+连续合约的虚拟symbol，格式：BTC/USD:BTC-CQ，BTC/USDT:USDT-NQ-3
+最后一部分可选，表示到期前多少天切换到下一合约
+*/
+type ContSymbol struct {
+	Symbol   string
+	Base     string
+	Quote    string
+	Settle   string
+	Rule     string // ContCurrentQuarter/ContNextQuarter
+	RollDays int    // 小于0表示使用ContResolver.RollDays
+}
+
+/*
+ContRoll
+连续合约切换事件。Gap和Ratio仅在拼接历史K线时计算：
+Gap为切换时新合约收盘价-旧合约收盘价，Ratio为新合约收盘价/旧合约收盘价
+*/
+type ContRoll struct {
+	Symbol string // 虚拟symbol
+	From   string // 旧合约，首次解析时为空
+	To     string
+	Time   int64 // 13位毫秒时间戳
+	Gap    float64
+	Ratio  float64
+}
+
+/*
+ContSegment
+某个具体合约作为连续合约的时间段[Start, End)，Start为0表示更早的合约未知
+*/
+type ContSegment struct {
+	Market *Market
+	Start  int64
+	End    int64
+}
+
+/*
+ContExchange
+ContResolver需要的交易所接口，BanExchange均已实现
+*/
+type ContExchange interface {
+	FindMarkets(baseCode, quote, marketType string) []*Market
+	FetchOhlcv(symbol, timeframe string, since int64, limit int, params *map[string]interface{}) ([]*Kline, *errs.Error)
+	MilliSeconds() int64
+}
+
+/*
+ContResolver
+将连续合约的虚拟symbol解析为具体的交割合约，在切换时触发OnRoll，
+并可跨合约拼接复权后的历史K线。
+只能使用交易所市场信息中存在的合约，已下架的历史合约无法参与解析和拼接
+*/
+type ContResolver struct {
+	Exg       ContExchange
+	RollDays  int    // 默认到期前多少天切换到下一合约
+	Adjust    string // 拼接K线的复权方式：ContAdjustNone/ContAdjustAdd/ContAdjustRatio
+	PageLimit int    // 拼接K线时单次请求的最大数量
+	OnRoll    func(evt *ContRoll)
+	current   map[string]string // 虚拟symbol: 当前具体合约
+	lock      sync.Mutex
+}
+
+func NewContResolver(exg ContExchange, rollDays int) *ContResolver {
+	return &ContResolver{
+		Exg:       exg,
+		RollDays:  rollDays,
+		PageLimit: 1000,
+		current:   make(map[string]string),
+	}
+}
+
+/*
+ParseContSymbol
+解析连续合约的虚拟symbol，格式错误时返回CodeParamInvalid
+*/
+func ParseContSymbol(symbol string) (*ContSymbol, *errs.Error) {
+	pair, contract, _ := strings.Cut(symbol, ":")
+	baseCode, quote, _ := strings.Cut(pair, "/")
+	parts := strings.Split(contract, "-")
+	if baseCode == "" || quote == "" || parts[0] == "" || len(parts) < 2 || len(parts) > 3 {
+		return nil, errs.NewMsg(errs.CodeParamInvalid, "invalid continuous symbol: %s", symbol)
+	}
+	res := &ContSymbol{Symbol: symbol, Base: baseCode, Quote: quote, Settle: parts[0], Rule: parts[1], RollDays: -1}
+	if res.Rule != ContCurrentQuarter && res.Rule != ContNextQuarter {
+		return nil, errs.NewMsg(errs.CodeParamInvalid, "invalid continuous rule in symbol: %s", symbol)
+	}
+	if len(parts) == 3 {
+		days, err := strconv.Atoi(parts[2])
+		if err != nil || days < 0 {
+			return nil, errs.NewMsg(errs.CodeParamInvalid, "invalid roll days in symbol: %s", symbol)
+		}
+		res.RollDays = days
+	}
+	return res, nil
+}
+
+/*
+IsContSymbol
+是否为连续合约的虚拟symbol
+*/
+func IsContSymbol(symbol string) bool {
+	_, err := ParseContSymbol(symbol)
+	return err == nil
+}
+
+func (c *ContSymbol) offset() int {
+	if c.Rule == ContNextQuarter {
+		return 1
+	}
+	return 0
+}
+
+func (r *ContResolver) rollMSecs(cs *ContSymbol) int64 {
+	if cs.RollDays >= 0 {
+		return int64(cs.RollDays) * msecsPerDay
+	}
+	return int64(r.RollDays) * msecsPerDay
+}
+
+/*
+contracts
+返回虚拟symbol对应的所有交割合约，按到期时间升序
+*/
+func (r *ContResolver) contracts(cs *ContSymbol) ([]*Market, *errs.Error) {
+	res := make([]*Market, 0)
+	for _, mar := range r.Exg.FindMarkets(cs.Base, cs.Quote, MarketFuture) {
+		if mar.Settle == cs.Settle && mar.Expiry > 0 {
+			res = append(res, mar)
+		}
+	}
+	if len(res) == 0 {
+		return nil, errs.NewMsg(errs.CodeNoMarketForPair, "no delivery futures for %s", cs.Symbol)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Expiry < res[j].Expiry
+	})
+	return res, nil
+}
+
+/*
+Schedule
+返回[start, end)期间虚拟symbol依次对应的具体合约
+*/
+func (r *ContResolver) Schedule(symbol string, start, end int64) ([]*ContSegment, *errs.Error) {
+	cs, err := ParseContSymbol(symbol)
+	if err != nil {
+		return nil, err
+	}
+	markets, err := r.contracts(cs)
+	if err != nil {
+		return nil, err
+	}
+	rollMS, offset := r.rollMSecs(cs), cs.offset()
+	res := make([]*ContSegment, 0)
+	for i := offset; i < len(markets); i++ {
+		seg := &ContSegment{Market: markets[i], End: markets[i-offset].Expiry - rollMS}
+		if i-offset > 0 {
+			seg.Start = markets[i-offset-1].Expiry - rollMS
+		}
+		if seg.End <= start || seg.Start >= end || seg.Start >= seg.End {
+			continue
+		}
+		res = append(res, seg)
+	}
+	return res, nil
+}
+
+/*
+Resolve
+返回timeMS时虚拟symbol对应的具体合约，不会记录状态和触发切换事件
+*/
+func (r *ContResolver) Resolve(symbol string, timeMS int64) (*Market, *errs.Error) {
+	segs, err := r.Schedule(symbol, timeMS, timeMS+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(segs) == 0 {
+		return nil, errs.NewMsg(errs.CodeNoMarketForPair, "no contract for %s at %v", symbol, timeMS)
+	}
+	return segs[0].Market, nil
+}
+
+/*
+Update
+解析timeMS时虚拟symbol对应的具体合约，与上次不同时触发OnRoll并返回切换事件。
+策略可定时调用此方法跟随主力合约
+*/
+func (r *ContResolver) Update(symbol string, timeMS int64) (*Market, *ContRoll, *errs.Error) {
+	mar, err := r.Resolve(symbol, timeMS)
+	if err != nil {
+		return nil, nil, err
+	}
+	r.lock.Lock()
+	prev, ok := r.current[symbol]
+	r.current[symbol] = mar.Symbol
+	r.lock.Unlock()
+	if ok && prev == mar.Symbol {
+		return mar, nil, nil
+	}
+	evt := &ContRoll{Symbol: symbol, From: prev, To: mar.Symbol, Time: timeMS}
+	if r.OnRoll != nil {
+		r.OnRoll(evt)
+	}
+	return mar, evt, nil
+}
+
+/*
+Current
+返回上次Update记录的具体合约symbol，未记录时为空
+*/
+func (r *ContResolver) Current(symbol string) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.current[symbol]
+}
+
+/*
+FetchOhlcv
+按虚拟symbol跨合约拼接历史K线，并按Adjust向后复权（最新合约的价格不变）。
+每个合约只取其作为连续合约期间的K线，返回期间的所有切换事件
+*/
+func (r *ContResolver) FetchOhlcv(symbol, timeframe string, since int64, limit int, params *map[string]interface{}) ([]*Kline, []*ContRoll, *errs.Error) {
+	tfSecs, err := utils.ParseTimeFrame(timeframe)
+	if err != nil {
+		return nil, nil, err
+	}
+	tfMSecs := int64(tfSecs) * 1000
+	end := r.Exg.MilliSeconds()
+	if since <= 0 {
+		if limit <= 0 {
+			limit = r.PageLimit
+		}
+		since = end - int64(limit)*tfMSecs
+	} else if limit > 0 {
+		end = min(end, since+int64(limit)*tfMSecs)
+	}
+	segs, err := r.Schedule(symbol, since, end)
+	if err != nil {
+		return nil, nil, err
+	}
+	parts := make([][]*Kline, 0, len(segs))
+	rolls := make([]*ContRoll, 0, len(segs))
+	for i, seg := range segs {
+		start := max(seg.Start, since)
+		if i > 0 {
+			// 多取一根与上个合约重叠的K线，用于计算切换时的价差
+			start -= tfMSecs
+		}
+		bars, err := r.fetchRange(seg.Market.Symbol, timeframe, tfMSecs, start, min(seg.End, end), params)
+		if err != nil {
+			return nil, nil, err
+		}
+		if i > 0 {
+			evt := &ContRoll{Symbol: symbol, From: segs[i-1].Market.Symbol, To: seg.Market.Symbol,
+				Time: seg.Start, Ratio: 1}
+			prev := parts[len(parts)-1]
+			if len(bars) > 0 && len(prev) > 0 && bars[0].Time == prev[len(prev)-1].Time {
+				oldClose, newClose := prev[len(prev)-1].Close, bars[0].Close
+				evt.Gap = newClose - oldClose
+				if oldClose != 0 {
+					evt.Ratio = newClose / oldClose
+				}
+			}
+			if len(bars) > 0 && bars[0].Time < seg.Start {
+				bars = bars[1:]
+			}
+			rolls = append(rolls, evt)
+		}
+		parts = append(parts, bars)
+	}
+	// 从最新合约向前累积复权
+	gap, ratio := 0.0, 1.0
+	for i := len(parts) - 1; i >= 0; i-- {
+		if i < len(parts)-1 {
+			gap += rolls[i].Gap
+			ratio *= rolls[i].Ratio
+		}
+		for _, k := range parts[i] {
+			adjustKline(k, r.Adjust, gap, ratio)
+		}
+	}
+	res := make([]*Kline, 0)
+	for _, bars := range parts {
+		res = append(res, bars...)
+	}
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res, rolls, nil
+}
+
+/*
+fetchRange
+分页获取[start, end)期间的K线
+*/
+func (r *ContResolver) fetchRange(symbol, timeframe string, tfMSecs, start, end int64, params *map[string]interface{}) ([]*Kline, *errs.Error) {
+	res := make([]*Kline, 0)
+	for start < end {
+		count := min(int((end-start+tfMSecs-1)/tfMSecs), r.PageLimit)
+		bars, err := r.Exg.FetchOhlcv(symbol, timeframe, start, count, params)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range bars {
+			if k.Time >= start && k.Time < end {
+				res = append(res, k)
+			}
+		}
+		if len(bars) == 0 || bars[len(bars)-1].Time+tfMSecs <= start {
+			break
+		}
+		start = bars[len(bars)-1].Time + tfMSecs
+	}
+	return res, nil
+}
+
+func adjustKline(k *Kline, adjust string, gap, ratio float64) {
+	switch adjust {
+	case ContAdjustAdd:
+		k.Open += gap
+		k.High += gap
+		k.Low += gap
+		k.Close += gap
+	case ContAdjustRatio:
+		k.Open *= ratio
+		k.High *= ratio
+		k.Low *= ratio
+		k.Close *= ratio
+	}
+}
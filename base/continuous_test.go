@@ -0,0 +1,97 @@
+package base
+
+import (
+	"github.com/banbox/banexg/errs"
+	"testing"
+)
+
+type fakeContExg struct {
+	*Exchange
+	prices map[string]float64
+}
+
+func (e *fakeContExg) FetchOhlcv(symbol, timeframe string, since int64, limit int, params *map[string]interface{}) ([]*Kline, *errs.Error) {
+	res := make([]*Kline, 0)
+	for i := int64(0); i < 40 && len(res) < limit; i++ {
+		stamp := i * msecsPerDay
+		if stamp < since {
+			continue
+		}
+		price := e.prices[symbol]
+		res = append(res, &Kline{Time: stamp, Open: price, High: price, Low: price, Close: price, Volume: 1})
+	}
+	return res, nil
+}
+
+func newFakeContExg() *fakeContExg {
+	e := &fakeContExg{Exchange: &Exchange{Markets: MarketMap{}}, prices: map[string]float64{}}
+	for i, symbol := range []string{"BTC/USD:BTC-240329", "BTC/USD:BTC-240628", "BTC/USD:BTC-240927"} {
+		e.Markets[symbol] = &Market{Symbol: symbol, Base: "BTC", Quote: "USD", Settle: "BTC", Type: MarketInverse,
+			Future: true, Contract: true, Inverse: true, Expiry: int64(i+1) * 10 * msecsPerDay}
+		e.prices[symbol] = []float64{100, 110, 121}[i]
+	}
+	e.Markets["BTC/USD:BTC"] = &Market{Symbol: "BTC/USD:BTC", Base: "BTC", Quote: "USD", Settle: "BTC",
+		Type: MarketInverse, Swap: true, Contract: true, Inverse: true}
+	return e
+}
+
+func TestContResolver(t *testing.T) {
+	for _, bad := range []string{"BTC/USD:BTC", "BTC/USD:BTC-XQ", "BTC/USD:BTC-CQ-a", "BTC/USD:BTC-240628"} {
+		if IsContSymbol(bad) {
+			t.Errorf("%s should not be continuous symbol", bad)
+		}
+	}
+	r := NewContResolver(newFakeContExg(), 1)
+	rolls := make([]*ContRoll, 0)
+	r.OnRoll = func(evt *ContRoll) {
+		rolls = append(rolls, evt)
+	}
+	day := msecsPerDay
+	items := []struct {
+		symbol string
+		time   int64
+		expect string
+	}{
+		{"BTC/USD:BTC-CQ", 5 * day, "BTC/USD:BTC-240329"},
+		{"BTC/USD:BTC-CQ", 9*day + 1, "BTC/USD:BTC-240628"},
+		{"BTC/USD:BTC-CQ", 9*day + 2, "BTC/USD:BTC-240628"},
+		{"BTC/USD:BTC-NQ", 5 * day, "BTC/USD:BTC-240628"},
+		{"BTC/USD:BTC-CQ-0", 9*day + 1, "BTC/USD:BTC-240329"},
+	}
+	for _, it := range items {
+		mar, _, err := r.Update(it.symbol, it.time)
+		if err != nil || mar.Symbol != it.expect {
+			t.Errorf("%s at %v: %v %v, expect %s", it.symbol, it.time, mar, err, it.expect)
+		}
+	}
+	if len(rolls) != 4 || rolls[1].From != "BTC/USD:BTC-240329" || rolls[1].To != "BTC/USD:BTC-240628" {
+		t.Errorf("bad roll events: %v", len(rolls))
+	}
+	if _, err := r.Resolve("BTC/USD:BTC-CQ", 29*day); err == nil {
+		t.Error("should have no contract after last roll")
+	}
+}
+
+func TestContResolverOhlcv(t *testing.T) {
+	day := msecsPerDay
+	for _, adjust := range []string{ContAdjustAdd, ContAdjustRatio} {
+		r := NewContResolver(newFakeContExg(), 1)
+		r.Adjust = adjust
+		r.PageLimit = 5
+		bars, rolls, err := r.FetchOhlcv("BTC/USD:BTC-CQ", "1d", day, 27, nil)
+		if err != nil {
+			t.Fatalf("fetch fail: %v", err)
+		}
+		if len(bars) != 27 || bars[0].Time != day || bars[26].Time != 27*day {
+			t.Fatalf("%s: bad bars: %v", adjust, len(bars))
+		}
+		for i, k := range bars {
+			if k.Time != int64(i+1)*day || k.Close < 120.999 || k.Close > 121.001 {
+				t.Errorf("%s: bad bar %v: %v %v", adjust, i, k.Time, k.Close)
+			}
+		}
+		if len(rolls) != 2 || rolls[0].Time != 9*day || rolls[0].Gap != 10 || rolls[1].Gap != 11 {
+			t.Errorf("%s: bad rolls: %v", adjust, len(rolls))
+		}
+	}
+}
@@ -29,6 +29,11 @@ const (
 	ParamMethod             = "method"
 	ParamInterval           = "interval"
 	ParamAccount            = "account"
+	ParamReloadSecs         = "reloadSecs"    // WatchMarketChanges自动重新加载的间隔秒数
+	ParamRefPrice           = "refPrice"      // ValidateOrder百分比价格检查的参考价
+	ParamFetchRefPrice      = "fetchRefPrice" // ValidateOrder缺少参考价时通过接口获取，默认跳过百分比价格检查
+	ParamLeverageCheck      = "leverageCheck" // SetLeverage按持仓所在杠杆层级检查：ValidateCheck/ValidateAdjust
+	ParamNotional           = "notional"      // 持仓名义价值，SetLeverage检查杠杆时未传入则通过FetchPositions获取
 )
 
 var (
@@ -85,6 +90,14 @@ const (
 	OptWsConn          = "WsConn"
 	OptAuthRefreshSecs = "AuthRefreshSecs"
 	OptPositionMethod  = "PositionMethod"
+	OptKlineClosedOnly = "KlineClosedOnly" // WatchOhlcvs只输出已完结的K线
+	OptWsRecord        = "WsRecord"        // 录制所有websocket消息到此文件路径
+	OptHttpCassette    = "HttpCassette"    // HTTP请求录制/重放文件路径
+	OptCassetteMode    = "CassetteMode"    // CassetteRecord/CassetteReplay，默认重放
+	OptMarketCache     = "MarketCache"     // 市场信息缓存文件路径，为空不缓存
+	OptMarketCacheSecs = "MarketCacheSecs" // 市场缓存有效秒数，默认3600
+	OptValidateOrder   = "ValidateOrder"   // ValidateCheck/ValidateAdjust，CreateOrder前检查订单，默认不检查
+	OptDecimalMode     = "DecimalMode"     // 为true时解析交易所字符串，额外保存decimal精确值
 )
 
 const (
@@ -93,6 +106,12 @@ const (
 	PrecModeTickSize     = utils.PrecModeTickSize
 )
 
+const (
+	RoundNearest = utils.RoundNearest
+	RoundDown    = utils.RoundDown
+	RoundUp      = utils.RoundUp
+)
+
 const (
 	MarketSpot    = "spot"   // 现货交易
 	MarketMargin  = "margin" // 保证金杠杆现货交易 margin trade
@@ -104,6 +123,22 @@ const (
 	MarketFuture = "future" // 有交割日的期货 for expiring futures contracts that have a delivery/settlement date
 )
 
+const (
+	OptionTypeCall = "call"
+	OptionTypePut  = "put"
+)
+
+const (
+	ContCurrentQuarter = "CQ" // 连续合约：当季，即最近一个未到切换时间的交割合约
+	ContNextQuarter    = "NQ" // 连续合约：次季
+)
+
+const (
+	ContAdjustNone  = ""      // 拼接历史K线时不复权
+	ContAdjustAdd   = "add"   // 按价差向后复权
+	ContAdjustRatio = "ratio" // 按比例向后复权
+)
+
 const (
 	MarginCross    = "cross"
 	MarginIsolated = "isolated"
@@ -152,3 +187,10 @@ const (
 const (
 	MidListenKey = "listenKey"
 )
+
+const (
+	AccEvtConfig     = "config"     // 杠杆倍数或联合保证金模式变化
+	AccEvtMarginCall = "marginCall" // 追加保证金通知
+	AccEvtStrategy   = "strategy"   // 策略交易状态变化
+	AccEvtGrid       = "grid"       // 网格交易状态变化
+)
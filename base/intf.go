@@ -1,6 +1,7 @@
 package base
 
 import (
+	"context"
 	"github.com/banbox/banexg/errs"
 	"io"
 )
@@ -8,37 +9,61 @@ import (
 type BanExchange interface {
 	LoadMarkets(reload bool, params *map[string]interface{}) (MarketMap, *errs.Error)
 	GetMarket(symbol string) (*Market, *errs.Error)
+	FindMarkets(baseCode, quote, marketType string) []*Market
+	GetPerpetualFor(spotSymbol string) (*Market, *errs.Error)
+	GetFuturesFor(spotSymbol string) ([]*Market, *errs.Error)
 	FetchTicker(symbol string, params *map[string]interface{}) (*Ticker, *errs.Error)
 	FetchTickers(symbols []string, params *map[string]interface{}) ([]*Ticker, *errs.Error)
 	LoadLeverageBrackets(reload bool, params *map[string]interface{}) *errs.Error
+	FetchLeverageTiers(symbols []string, params *map[string]interface{}) (map[string][]*LeverageTier, *errs.Error)
+	GetLeverageTier(symbol string, notional float64) *LeverageTier
 
 	FetchOhlcv(symbol, timeframe string, since int64, limit int, params *map[string]interface{}) ([]*Kline, *errs.Error)
 	FetchOrders(symbol string, since int64, limit int, params *map[string]interface{}) ([]*Order, *errs.Error)
 	FetchOrderBook(symbol string, limit int, params *map[string]interface{}) (*OrderBook, *errs.Error)
+	FetchOptionChain(underlying string, params *map[string]interface{}) (*OptionChain, *errs.Error)
 
 	FetchBalance(params *map[string]interface{}) (*Balances, *errs.Error)
 	FetchPositions(symbols []string, params *map[string]interface{}) ([]*Position, *errs.Error)
 	FetchOpenOrders(symbol string, since int64, limit int, params *map[string]interface{}) ([]*Order, *errs.Error)
+	FetchOrder(symbol, orderId string, params *map[string]interface{}) (*Order, *errs.Error)
+	FetchMyLiquidations(symbol string, since int64, limit int, params *map[string]interface{}) ([]*Liquidation, *errs.Error)
 
 	CreateOrder(symbol, odType, side string, amount float64, price float64, params *map[string]interface{}) (*Order, *errs.Error)
 	CancelOrder(id string, symbol string, params *map[string]interface{}) (*Order, *errs.Error)
 	CalculateFee(symbol, odType, side string, amount float64, price float64, isMaker bool, params *map[string]interface{}) (*Fee, *errs.Error)
+	ValidateOrder(symbol, odType, side string, amount, price float64, params *map[string]interface{}) (*OrderCheck, *errs.Error)
 	SetLeverage(leverage int, symbol string, params *map[string]interface{}) (map[string]interface{}, *errs.Error)
 
 	WatchOrderBooks(symbols []string, limit int, params *map[string]interface{}) (chan OrderBook, *errs.Error)
 	UnWatchOrderBooks(symbols []string, params *map[string]interface{}) *errs.Error
+	WatchOrderBookSnapshots(symbols []string, levels, speedMs int, params *map[string]interface{}) (chan OrderBook, *errs.Error)
+	UnWatchOrderBookSnapshots(symbols []string, params *map[string]interface{}) *errs.Error
 	WatchOhlcvs(jobs [][2]string, params *map[string]interface{}) (chan SymbolKline, *errs.Error)
 	UnWatchOhlcvs(jobs [][2]string, params *map[string]interface{}) *errs.Error
 	WatchMarkPrices(symbols []string, params *map[string]interface{}) (chan map[string]float64, *errs.Error)
 	UnWatchMarkPrices(symbols []string, params *map[string]interface{}) *errs.Error
+	WatchLiquidations(symbols []string, params *map[string]interface{}) (chan Liquidation, *errs.Error)
+	UnWatchLiquidations(symbols []string, params *map[string]interface{}) *errs.Error
+	WatchOptionChain(underlying string, params *map[string]interface{}) (chan OptionChain, *errs.Error)
+	UnWatchOptionChain(underlying string, params *map[string]interface{}) *errs.Error
 	WatchMyTrades(params *map[string]interface{}) (chan MyTrade, *errs.Error)
+	UnWatchMyTrades(params *map[string]interface{}) *errs.Error
 	WatchBalance(params *map[string]interface{}) (chan Balances, *errs.Error)
+	UnWatchBalance(params *map[string]interface{}) *errs.Error
 	WatchPositions(params *map[string]interface{}) (chan []*Position, *errs.Error)
+	UnWatchPositions(params *map[string]interface{}) *errs.Error
+	WatchAccountEvents(params *map[string]interface{}) (chan AccountEvent, *errs.Error)
+	UnWatchAccountEvents(params *map[string]interface{}) *errs.Error
+	WatchMarketChanges(params *map[string]interface{}) (chan MarketChange, *errs.Error)
+	UnWatchMarketChanges(params *map[string]interface{}) *errs.Error
 
 	PrecAmount(m *Market, amount float64) (string, *errs.Error)
 	PrecPrice(m *Market, price float64) (string, *errs.Error)
 	PrecCost(m *Market, cost float64) (string, *errs.Error)
 	PrecFee(m *Market, fee float64) (string, *errs.Error)
+	PrecAmountRound(m *Market, amount float64, rounding int) (string, *errs.Error)
+	PrecPriceRound(m *Market, price float64, rounding int) (string, *errs.Error)
 
 	HasApi(key string) bool
 	PriceOnePip(symbol string) (float64, *errs.Error)
@@ -46,6 +71,8 @@ type BanExchange interface {
 	MilliSeconds() int64
 
 	GetAccount(id string) (*Account, *errs.Error)
+	GetWsDropped() map[string]int64
+	Close(ctx context.Context) *errs.Error
 }
 
 type WsConn interface {
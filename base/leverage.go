@@ -0,0 +1,44 @@
+package base
+
+/*
+LeverageTier
+杠杆分层。U本位合约MinNotional/MaxNotional为计价币名义价值；
+币本位合约为基础币数量，与Position.Notional一致
+*/
+type LeverageTier struct {
+	Tier            int     `json:"tier"`
+	Symbol          string  `json:"symbol"`
+	Currency        string  `json:"currency"` // MinNotional和MaxNotional的单位
+	MinNotional     float64 `json:"minNotional"`
+	MaxNotional     float64 `json:"maxNotional"`
+	MaintMarginRate float64 `json:"maintMarginRate"`
+	MaxLeverage     int     `json:"maxLeverage"`
+	MaintAmount     float64 `json:"maintAmount"` // 速算数cum：维持保证金=名义价值*维持保证金率-MaintAmount
+}
+
+/*
+GetLeverageTier
+返回名义价值所在的杠杆层级，未加载时返回nil
+*/
+func (e *Exchange) GetLeverageTier(symbol string, notional float64) *LeverageTier {
+	var res *LeverageTier
+	for _, tier := range e.LeverageTiers[symbol] {
+		if notional < tier.MinNotional {
+			break
+		}
+		res = tier
+	}
+	return res
+}
+
+/*
+GetMaxLeverage
+返回名义价值所在层级允许的最大杠杆，未加载时返回0
+*/
+func (e *Exchange) GetMaxLeverage(symbol string, notional float64) int {
+	tier := e.GetLeverageTier(symbol, notional)
+	if tier == nil {
+		return 0
+	}
+	return tier.MaxLeverage
+}
@@ -0,0 +1,115 @@
+package base
+
+import (
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"go.uber.org/zap"
+	"os"
+)
+
+/*
+MarketCache
+Markets、CurrenciesByCode、LeverageBrackets和LeverageTiers的本地缓存，多个进程同时启动时避免重复请求exchangeInfo
+*/
+type MarketCache struct {
+	Time             int64                      `json:"time"` // 13位毫秒时间戳
+	Markets          MarketMap                  `json:"markets"`
+	Currencies       CurrencyMap                `json:"currencies"`
+	LeverageBrackets map[string][][2]float64    `json:"leverageBrackets"`
+	LeverageTiers    map[string][]*LeverageTier `json:"leverageTiers"`
+}
+
+func (e *Exchange) readMarketCache() *MarketCache {
+	var cache MarketCache
+	err := utils.ReadJsonFile(e.MarketCachePath, &cache)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn("read market cache fail", zap.String("path", e.MarketCachePath), zap.Error(err))
+		}
+		return nil
+	}
+	if len(cache.Markets) == 0 {
+		return nil
+	}
+	return &cache
+}
+
+func (e *Exchange) applyMarketCache(cache *MarketCache) {
+	if e.DecodeMarketInfo != nil {
+		for _, mar := range cache.Markets {
+			e.DecodeMarketInfo(mar)
+		}
+	}
+	if len(cache.Currencies) > 0 {
+		setMarkets(e, cache.Currencies, cache.Markets)
+	} else {
+		setMarkets(e, nil, cache.Markets)
+	}
+	if len(cache.LeverageBrackets) > 0 && len(e.LeverageBrackets) == 0 {
+		e.LeverageBrackets = cache.LeverageBrackets
+	}
+	if len(cache.LeverageTiers) > 0 && len(e.LeverageTiers) == 0 {
+		e.LeverageTiers = cache.LeverageTiers
+	}
+	e.marketsTime = cache.Time
+}
+
+/*
+SaveMarketCache
+保存当前的Markets、CurrenciesByCode、LeverageBrackets和LeverageTiers到缓存文件，未启用缓存时忽略。
+LeverageBrackets等更新后也需调用
+*/
+func (e *Exchange) SaveMarketCache() {
+	if e.MarketCachePath == "" || len(e.Markets) == 0 {
+		return
+	}
+	cache := &MarketCache{
+		Time:             e.marketsTime,
+		Markets:          e.Markets,
+		Currencies:       e.CurrenciesByCode,
+		LeverageBrackets: e.LeverageBrackets,
+		LeverageTiers:    e.LeverageTiers,
+	}
+	err := utils.WriteJsonFile(e.MarketCachePath, cache)
+	if err != nil {
+		log.Warn("write market cache fail", zap.String("path", e.MarketCachePath), zap.Error(err))
+	}
+}
+
+/*
+refreshMarkets
+后台请求最新的市场信息，失败时继续使用当前缓存。
+结果不直接替换Markets（其他协程正在读取），由下次LoadMarkets在调用方协程中替换
+*/
+func (e *Exchange) refreshMarkets(params *map[string]interface{}) {
+	currencies, markets, err := fetchMarketsData(e, params)
+	if err != nil {
+		log.Warn("refresh markets fail, keep cached markets", zap.String("exg", e.Name), zap.Error(err))
+		return
+	}
+	if len(markets) == 0 {
+		log.Warn("refresh markets empty, keep cached markets", zap.String("exg", e.Name))
+		return
+	}
+	e.marketLock.Lock()
+	e.refreshed = &MarketCache{Time: e.MilliSeconds(), Markets: markets, Currencies: currencies}
+	e.marketLock.Unlock()
+	log.Info("markets refreshed in background", zap.String("exg", e.Name), zap.Int("num", len(markets)))
+}
+
+/*
+applyRefreshed
+使用后台刷新得到的市场信息替换Markets并更新缓存，没有时忽略
+*/
+func (e *Exchange) applyRefreshed() {
+	e.marketLock.Lock()
+	cache := e.refreshed
+	e.refreshed = nil
+	e.marketLock.Unlock()
+	if cache == nil {
+		return
+	}
+	setMarkets(e, cache.Currencies, cache.Markets)
+	e.marketsTime = cache.Time
+	e.SaveMarketCache()
+}
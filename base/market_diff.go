@@ -0,0 +1,197 @@
+package base
+
+import (
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+)
+
+const (
+	MarketChgListed    = "listed"    // 新上架
+	MarketChgDelisted  = "delisted"  // 已下架，或不再返回
+	MarketChgActive    = "active"    // 交易状态变化，如TRADING -> BREAK
+	MarketChgPrecision = "precision" // 价格、数量等精度变化
+	MarketChgLimits    = "limits"    // 价格、数量、金额等限制变化
+)
+
+// MarketChgChanKey WatchMarketChanges输出通道在WsOutChans中的key
+const MarketChgChanKey = "marketChanges"
+
+/*
+MarketChange
+重新加载市场信息时检测到的变化。
+Field为变化的字段，如precision.price、limits.amount.min；上架和下架时为空
+*/
+type MarketChange struct {
+	Type   string
+	Symbol string
+	Field  string
+	Old    interface{}
+	New    interface{}
+	Market *Market // 新的Market，下架时为旧的
+	Time   int64   // 13位毫秒时间戳
+}
+
+/*
+DiffMarkets
+比较新旧市场信息，返回上架、下架、状态、精度和限制的变化，按Symbol排序
+*/
+func DiffMarkets(old, new MarketMap, stamp int64) []*MarketChange {
+	res := make([]*MarketChange, 0)
+	add := func(chgType, symbol, field string, oldVal, newVal interface{}, mar *Market) {
+		res = append(res, &MarketChange{
+			Type:   chgType,
+			Symbol: symbol,
+			Field:  field,
+			Old:    oldVal,
+			New:    newVal,
+			Market: mar,
+			Time:   stamp,
+		})
+	}
+	for symbol, mar := range new {
+		prev, ok := old[symbol]
+		if !ok {
+			add(MarketChgListed, symbol, "", nil, nil, mar)
+			continue
+		}
+		if prev.Active != mar.Active {
+			add(MarketChgActive, symbol, "active", prev.Active, mar.Active, mar)
+		}
+		oldPrec, newPrec := prev.Precision, mar.Precision
+		if oldPrec == nil {
+			oldPrec = &Precision{}
+		}
+		if newPrec == nil {
+			newPrec = &Precision{}
+		}
+		for _, it := range []struct {
+			field string
+			a, b  float64
+		}{
+			{"precision.amount", oldPrec.Amount, newPrec.Amount},
+			{"precision.price", oldPrec.Price, newPrec.Price},
+			{"precision.base", oldPrec.Base, newPrec.Base},
+			{"precision.quote", oldPrec.Quote, newPrec.Quote},
+		} {
+			if it.a != it.b {
+				add(MarketChgPrecision, symbol, it.field, it.a, it.b, mar)
+			}
+		}
+		oldLim, newLim := prev.Limits, mar.Limits
+		if oldLim == nil {
+			oldLim = &MarketLimits{}
+		}
+		if newLim == nil {
+			newLim = &MarketLimits{}
+		}
+		for _, it := range []struct {
+			field string
+			a, b  *LimitRange
+		}{
+			{"limits.leverage", oldLim.Leverage, newLim.Leverage},
+			{"limits.amount", oldLim.Amount, newLim.Amount},
+			{"limits.price", oldLim.Price, newLim.Price},
+			{"limits.cost", oldLim.Cost, newLim.Cost},
+			{"limits.market", oldLim.Market, newLim.Market},
+		} {
+			a, b := it.a, it.b
+			if a == nil {
+				a = &LimitRange{}
+			}
+			if b == nil {
+				b = &LimitRange{}
+			}
+			if a.Min != b.Min {
+				add(MarketChgLimits, symbol, it.field+".min", a.Min, b.Min, mar)
+			}
+			if a.Max != b.Max {
+				add(MarketChgLimits, symbol, it.field+".max", a.Max, b.Max, mar)
+			}
+		}
+	}
+	for symbol, mar := range old {
+		if _, ok := new[symbol]; !ok {
+			add(MarketChgDelisted, symbol, "", nil, nil, mar)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Symbol < res[j].Symbol
+	})
+	return res
+}
+
+/*
+emitMarketChanges
+有WatchMarketChanges订阅时，比较新旧市场信息并输出变化
+*/
+func (e *Exchange) emitMarketChanges(old, new MarketMap) {
+	if len(old) == 0 {
+		return
+	}
+	if _, ok := e.WsOutChans[MarketChgChanKey]; !ok {
+		return
+	}
+	changes := DiffMarkets(old, new, e.MilliSeconds())
+	for _, chg := range changes {
+		WriteOutChan(e, MarketChgChanKey, *chg, false)
+	}
+	if len(changes) > 0 {
+		log.Info("markets changed", zap.String("exg", e.Name), zap.Int("num", len(changes)))
+	}
+}
+
+/*
+WatchMarketChanges
+监听市场信息变化，每次LoadMarkets重新加载后输出与上次的差异。
+ParamReloadSecs大于0时按此间隔自动重新加载
+*/
+func (e *Exchange) WatchMarketChanges(params *map[string]interface{}) (chan MarketChange, *errs.Error) {
+	_, err := e.LoadMarkets(false, nil)
+	if err != nil {
+		return nil, err
+	}
+	args := utils.SafeParams(params)
+	reloadSecs := utils.PopMapVal(args, ParamReloadSecs, 0)
+	create := func(cap int) chan MarketChange { return make(chan MarketChange, cap) }
+	out := GetWsOutChan(e, MarketChgChanKey, create, args)
+	if reloadSecs > 0 {
+		e.stopMarketReload()
+		stop := make(chan struct{})
+		e.marketReloadStop = stop
+		go e.runMarketReload(time.Duration(reloadSecs)*time.Second, stop)
+	}
+	return out, nil
+}
+
+func (e *Exchange) UnWatchMarketChanges(params *map[string]interface{}) *errs.Error {
+	e.stopMarketReload()
+	e.closeOutChan(MarketChgChanKey)
+	return nil
+}
+
+func (e *Exchange) runMarketReload(intv time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(intv)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			_, err := e.LoadMarkets(true, nil)
+			if err != nil {
+				log.Warn("auto reload markets fail", zap.String("exg", e.Name), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (e *Exchange) stopMarketReload() {
+	if e.marketReloadStop != nil {
+		close(e.marketReloadStop)
+		e.marketReloadStop = nil
+	}
+}
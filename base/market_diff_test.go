@@ -0,0 +1,80 @@
+package base
+
+import (
+	"github.com/banbox/banexg/errs"
+	"testing"
+	"time"
+)
+
+func TestWatchMarketChanges(t *testing.T) {
+	newMar := func(symbol string, active bool, pricePrec, minAmt float64) *Market {
+		return &Market{
+			ID:        symbol,
+			Symbol:    symbol,
+			Base:      "FOO",
+			Quote:     "USDT",
+			Spot:      true,
+			Active:    active,
+			Precision: &Precision{Price: pricePrec, Amount: 3},
+			Limits:    &MarketLimits{Amount: &LimitRange{Min: minAmt}},
+		}
+	}
+	versions := []MarketMap{
+		{
+			"FOO/USDT": newMar("FOO/USDT", true, 2, 0.1),
+			"BAR/USDT": newMar("BAR/USDT", true, 2, 1),
+		},
+		{
+			"FOO/USDT": newMar("FOO/USDT", false, 3, 0.01),
+			"BAZ/USDT": newMar("BAZ/USDT", true, 2, 1),
+		},
+	}
+	loadNum := 0
+	e := Exchange{Name: "fake"}
+	e.Init()
+	e.FetchMarkets = func(params *map[string]interface{}) (MarketMap, *errs.Error) {
+		idx := loadNum
+		if idx >= len(versions) {
+			idx = len(versions) - 1
+		}
+		loadNum += 1
+		return versions[idx], nil
+	}
+	out, err := e.WatchMarketChanges(&map[string]interface{}{ParamReloadSecs: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := make(map[string]MarketChange)
+	timeout := time.After(time.Second * 5)
+	for len(changes) < 5 {
+		select {
+		case chg := <-out:
+			changes[chg.Symbol+"|"+chg.Type+"|"+chg.Field] = chg
+		case <-timeout:
+			t.Fatalf("wait market changes timeout, got: %v", changes)
+		}
+	}
+	expects := map[string][2]interface{}{
+		"BAZ/USDT|listed|":                   {nil, nil},
+		"BAR/USDT|delisted|":                 {nil, nil},
+		"FOO/USDT|active|active":             {true, false},
+		"FOO/USDT|precision|precision.price": {2.0, 3.0},
+		"FOO/USDT|limits|limits.amount.min":  {0.1, 0.01},
+	}
+	for key, vals := range expects {
+		chg, ok := changes[key]
+		if !ok {
+			t.Errorf("missing change: %s", key)
+			continue
+		}
+		if chg.Old != vals[0] || chg.New != vals[1] {
+			t.Errorf("bad change %s: %v -> %v", key, chg.Old, chg.New)
+		}
+	}
+	if err = e.UnWatchMarketChanges(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-out; ok {
+		t.Error("out chan should be closed after UnWatchMarketChanges")
+	}
+}
@@ -0,0 +1,146 @@
+package base
+
+import (
+	"sort"
+)
+
+/*
+OptionQuote
+期权合约的标记价格、隐含波动率和希腊值
+*/
+type OptionQuote struct {
+	Symbol     string  `json:"symbol"`
+	Strike     float64 `json:"strike"`
+	Expiry     int64   `json:"expiry"`
+	OptionType string  `json:"optionType"` // call/put
+	MarkPrice  float64 `json:"markPrice"`
+	BidIV      float64 `json:"bidIV"`
+	AskIV      float64 `json:"askIV"`
+	MarkIV     float64 `json:"markIV"`
+	Delta      float64 `json:"delta"`
+	Gamma      float64 `json:"gamma"`
+	Theta      float64 `json:"theta"`
+	Vega       float64 `json:"vega"`
+	Timestamp  int64   `json:"timestamp"` // 最近更新的13位毫秒时间戳
+}
+
+/*
+OptionStrike
+同一到期日、同一行权价的看涨和看跌期权，没有时为nil
+*/
+type OptionStrike struct {
+	Strike float64      `json:"strike"`
+	Call   *OptionQuote `json:"call"`
+	Put    *OptionQuote `json:"put"`
+}
+
+/*
+OptionChain
+标的资产的期权链：到期时间 -> 行权价 -> 看涨/看跌
+*/
+type OptionChain struct {
+	Underlying string                              `json:"underlying"`
+	Expiries   map[int64]map[float64]*OptionStrike `json:"expiries"`
+	Timestamp  int64                               `json:"timestamp"`
+	quotes     map[string]*OptionQuote             // symbol: quote
+}
+
+/*
+NewOptionChain
+从期权市场信息构建期权链，非期权市场会被忽略
+*/
+func NewOptionChain(underlying string, markets []*Market) *OptionChain {
+	res := &OptionChain{
+		Underlying: underlying,
+		Expiries:   make(map[int64]map[float64]*OptionStrike),
+		quotes:     make(map[string]*OptionQuote),
+	}
+	for _, mar := range markets {
+		if !mar.Option {
+			continue
+		}
+		res.add(&OptionQuote{
+			Symbol:     mar.Symbol,
+			Strike:     mar.Strike,
+			Expiry:     mar.Expiry,
+			OptionType: mar.OptionType,
+		})
+	}
+	return res
+}
+
+func (c *OptionChain) add(q *OptionQuote) {
+	strikes, ok := c.Expiries[q.Expiry]
+	if !ok {
+		strikes = make(map[float64]*OptionStrike)
+		c.Expiries[q.Expiry] = strikes
+	}
+	item, ok := strikes[q.Strike]
+	if !ok {
+		item = &OptionStrike{Strike: q.Strike}
+		strikes[q.Strike] = item
+	}
+	if q.OptionType == OptionTypePut {
+		item.Put = q
+	} else {
+		item.Call = q
+	}
+	c.quotes[q.Symbol] = q
+}
+
+/*
+Get
+按期权symbol查找，不存在时返回nil
+*/
+func (c *OptionChain) Get(symbol string) *OptionQuote {
+	return c.quotes[symbol]
+}
+
+/*
+ExpiryList
+升序返回所有到期时间
+*/
+func (c *OptionChain) ExpiryList() []int64 {
+	res := make([]int64, 0, len(c.Expiries))
+	for expiry := range c.Expiries {
+		res = append(res, expiry)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i] < res[j]
+	})
+	return res
+}
+
+/*
+StrikeList
+按行权价升序返回某个到期日的所有期权
+*/
+func (c *OptionChain) StrikeList(expiry int64) []*OptionStrike {
+	strikes := c.Expiries[expiry]
+	res := make([]*OptionStrike, 0, len(strikes))
+	for _, item := range strikes {
+		res = append(res, item)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Strike < res[j].Strike
+	})
+	return res
+}
+
+/*
+Clone
+深拷贝，用于输出到通道，避免与后续更新并发读写
+*/
+func (c *OptionChain) Clone() *OptionChain {
+	res := &OptionChain{
+		Underlying: c.Underlying,
+		Expiries:   make(map[int64]map[float64]*OptionStrike, len(c.Expiries)),
+		Timestamp:  c.Timestamp,
+		quotes:     make(map[string]*OptionQuote, len(c.quotes)),
+	}
+	for _, q := range c.quotes {
+		item := *q
+		res.add(&item)
+	}
+	return res
+}
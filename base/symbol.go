@@ -0,0 +1,191 @@
+package base
+
+import (
+	"github.com/banbox/banexg/errs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+SymbolParts
+标准symbol的各部分，格式：
+
+	现货：BTC/USDT
+	永续合约：BTC/USDT:USDT
+	交割合约：BTC/USD:BTC-240628
+	期权：BTC/USDT:USDT-240628-60000-C
+*/
+type SymbolParts struct {
+	Base       string
+	Quote      string
+	Settle     string // 结算币，现货为空
+	Expiry     string // 交割日期，与Market.Symbol中的格式相同，现货和永续为空
+	Strike     string // 期权行权价
+	OptionType string // 期权类型：C/P
+}
+
+/*
+ParseSymbol
+解析标准symbol为SymbolParts，格式错误时返回CodeParamInvalid
+*/
+func ParseSymbol(symbol string) (*SymbolParts, *errs.Error) {
+	pair, contract, isContract := strings.Cut(symbol, ":")
+	baseCode, quote, ok := strings.Cut(pair, "/")
+	if !ok || baseCode == "" || quote == "" || strings.Contains(quote, "/") {
+		return nil, errs.NewMsg(errs.CodeParamInvalid, "invalid symbol: %s", symbol)
+	}
+	res := &SymbolParts{Base: baseCode, Quote: quote}
+	if !isContract {
+		return res, nil
+	}
+	parts := strings.Split(contract, "-")
+	res.Settle = parts[0]
+	if res.Settle == "" || len(parts) == 3 || len(parts) > 4 {
+		return nil, errs.NewMsg(errs.CodeParamInvalid, "invalid contract symbol: %s", symbol)
+	}
+	if len(parts) > 1 {
+		res.Expiry = parts[1]
+		if _, err := strconv.Atoi(res.Expiry); err != nil {
+			return nil, errs.NewMsg(errs.CodeParamInvalid, "invalid expiry in symbol: %s", symbol)
+		}
+	}
+	if len(parts) == 4 {
+		res.Strike, res.OptionType = parts[2], parts[3]
+		if _, err := strconv.ParseFloat(res.Strike, 64); err != nil {
+			return nil, errs.NewMsg(errs.CodeParamInvalid, "invalid strike in symbol: %s", symbol)
+		}
+		if res.OptionType != "C" && res.OptionType != "P" {
+			return nil, errs.NewMsg(errs.CodeParamInvalid, "invalid option type in symbol: %s", symbol)
+		}
+	}
+	return res, nil
+}
+
+/*
+BuildSymbol
+从SymbolParts生成标准symbol，是ParseSymbol的逆操作
+*/
+func BuildSymbol(p *SymbolParts) string {
+	symbol := p.Base + "/" + p.Quote
+	if p.Settle == "" {
+		return symbol
+	}
+	symbol += ":" + p.Settle
+	if p.Expiry != "" {
+		symbol += "-" + p.Expiry
+		if p.Strike != "" {
+			symbol += "-" + p.Strike + "-" + p.OptionType
+		}
+	}
+	return symbol
+}
+
+func (p *SymbolParts) IsSpot() bool {
+	return p.Settle == ""
+}
+
+func (p *SymbolParts) IsSwap() bool {
+	return p.Settle != "" && p.Expiry == ""
+}
+
+func (p *SymbolParts) IsFuture() bool {
+	return p.Expiry != "" && p.Strike == ""
+}
+
+func (p *SymbolParts) IsOption() bool {
+	return p.Strike != ""
+}
+
+/*
+MarketType
+返回MarketSpot/MarketLinear/MarketInverse/MarketOption
+*/
+func (p *SymbolParts) MarketType() string {
+	if p.IsSpot() {
+		return MarketSpot
+	} else if p.IsOption() {
+		return MarketOption
+	} else if p.Settle == p.Base {
+		return MarketInverse
+	}
+	return MarketLinear
+}
+
+/*
+FindMarkets
+按基础币、计价币、市场类型查找市场，参数为空表示不限制，按Symbol排序返回。
+marketType支持MarketSpot/MarketMargin/MarketLinear/MarketInverse/MarketOption，以及MarketSwap/MarketFuture
+*/
+func (e *Exchange) FindMarkets(baseCode, quote, marketType string) []*Market {
+	res := make([]*Market, 0)
+	for _, mar := range e.Markets {
+		if baseCode != "" && mar.Base != baseCode || quote != "" && mar.Quote != quote {
+			continue
+		}
+		if marketType != "" && !marketTypeMatch(mar, marketType) {
+			continue
+		}
+		res = append(res, mar)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Symbol < res[j].Symbol
+	})
+	return res
+}
+
+func marketTypeMatch(mar *Market, marketType string) bool {
+	switch marketType {
+	case MarketSwap:
+		return mar.Swap
+	case MarketFuture:
+		return mar.Future
+	case MarketMargin:
+		return mar.Margin
+	default:
+		return mar.Type == marketType
+	}
+}
+
+/*
+GetPerpetualFor
+返回现货交易对对应的U本位永续合约，如BTC/USDT -> BTC/USDT:USDT
+*/
+func (e *Exchange) GetPerpetualFor(spotSymbol string) (*Market, *errs.Error) {
+	if len(e.Markets) == 0 {
+		return nil, errs.MarketNotLoad
+	}
+	parts, err := ParseSymbol(spotSymbol)
+	if err != nil {
+		return nil, err
+	}
+	symbol := BuildSymbol(&SymbolParts{Base: parts.Base, Quote: parts.Quote, Settle: parts.Quote})
+	if mar, ok := e.Markets[symbol]; ok {
+		return mar, nil
+	}
+	return nil, errs.NewMsg(errs.CodeNoMarketForPair, "no perpetual for %s", spotSymbol)
+}
+
+/*
+GetFuturesFor
+返回现货交易对对应的U本位交割合约，按到期时间升序，没有时返回空列表
+*/
+func (e *Exchange) GetFuturesFor(spotSymbol string) ([]*Market, *errs.Error) {
+	if len(e.Markets) == 0 {
+		return nil, errs.MarketNotLoad
+	}
+	parts, err := ParseSymbol(spotSymbol)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*Market, 0)
+	for _, mar := range e.FindMarkets(parts.Base, parts.Quote, MarketFuture) {
+		if mar.Settle == parts.Quote {
+			res = append(res, mar)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Expiry < res[j].Expiry
+	})
+	return res, nil
+}
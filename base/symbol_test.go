@@ -0,0 +1,79 @@
+package base
+
+import (
+	"testing"
+)
+
+func TestParseSymbol(t *testing.T) {
+	items := []struct {
+		symbol  string
+		marType string
+		parts   SymbolParts
+	}{
+		{"BTC/USDT", MarketSpot, SymbolParts{Base: "BTC", Quote: "USDT"}},
+		{"BTC/USDT:USDT", MarketLinear, SymbolParts{Base: "BTC", Quote: "USDT", Settle: "USDT"}},
+		{"BTC/USD:BTC-240628", MarketInverse, SymbolParts{Base: "BTC", Quote: "USD", Settle: "BTC", Expiry: "240628"}},
+		{"BTC/USDT:USDT-240628-60000-C", MarketOption, SymbolParts{Base: "BTC", Quote: "USDT", Settle: "USDT",
+			Expiry: "240628", Strike: "60000", OptionType: "C"}},
+	}
+	for _, it := range items {
+		parts, err := ParseSymbol(it.symbol)
+		if err != nil {
+			t.Errorf("parse %s fail: %v", it.symbol, err)
+			continue
+		}
+		if *parts != it.parts {
+			t.Errorf("parse %s got %+v", it.symbol, *parts)
+		}
+		if parts.MarketType() != it.marType {
+			t.Errorf("%s market type %s != %s", it.symbol, parts.MarketType(), it.marType)
+		}
+		if res := BuildSymbol(parts); res != it.symbol {
+			t.Errorf("build %s got %s", it.symbol, res)
+		}
+	}
+	for _, bad := range []string{"BTCUSDT", "BTC/", "/USDT:USDT", "BTC/USDT:", "BTC/USDT:USDT-24a628",
+		"BTC/USDT:USDT-240628-60000", "BTC/USDT:USDT-240628-60000-X"} {
+		if _, err := ParseSymbol(bad); err == nil {
+			t.Errorf("%s should be invalid", bad)
+		}
+	}
+}
+
+func TestFindMarkets(t *testing.T) {
+	e := Exchange{Markets: MarketMap{}}
+	for _, symbol := range []string{"BTC/USDT", "BTC/USDT:USDT", "BTC/USDT:USDT-240927", "BTC/USDT:USDT-240628",
+		"BTC/USD:BTC", "ETH/USDT:USDT"} {
+		parts, _ := ParseSymbol(symbol)
+		e.Markets[symbol] = &Market{
+			Symbol:  symbol,
+			Base:    parts.Base,
+			Quote:   parts.Quote,
+			Settle:  parts.Settle,
+			Type:    parts.MarketType(),
+			Spot:    parts.IsSpot(),
+			Swap:    parts.IsSwap(),
+			Future:  parts.IsFuture(),
+			Expiry:  map[string]int64{"240628": 1719561600000, "240927": 1727424000000}[parts.Expiry],
+			Linear:  parts.MarketType() == MarketLinear,
+			Inverse: parts.MarketType() == MarketInverse,
+		}
+	}
+	if res := e.FindMarkets("BTC", "", MarketSwap); len(res) != 2 || res[0].Symbol != "BTC/USD:BTC" {
+		t.Errorf("bad swap markets: %v", len(res))
+	}
+	if res := e.FindMarkets("", "USDT", MarketLinear); len(res) != 4 {
+		t.Errorf("bad linear markets: %v", len(res))
+	}
+	perp, err := e.GetPerpetualFor("BTC/USDT")
+	if err != nil || perp.Symbol != "BTC/USDT:USDT" {
+		t.Errorf("bad perpetual: %v %v", perp, err)
+	}
+	if _, err = e.GetPerpetualFor("ETH/BTC"); err == nil {
+		t.Error("ETH/BTC should have no perpetual")
+	}
+	futs, err := e.GetFuturesFor("BTC/USDT")
+	if err != nil || len(futs) != 2 || futs[0].Symbol != "BTC/USDT:USDT-240628" {
+		t.Errorf("bad futures: %v %v", futs, err)
+	}
+}
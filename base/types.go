@@ -2,16 +2,25 @@ package base
 
 import (
 	"github.com/banbox/banexg/errs"
+	"github.com/shopspring/decimal"
 	"net/http"
 	"net/url"
+	"sync"
 )
 
 type FuncSign = func(api Entry, params *map[string]interface{}) *HttpReq
 type FuncFetchCurr = func(params *map[string]interface{}) (CurrencyMap, *errs.Error)
 type FuncFetchMarkets = func(params *map[string]interface{}) (MarketMap, *errs.Error)
 type FuncAuth = func(params *map[string]interface{}) (*Account, *errs.Error)
+type FuncCheckOdType = func(m *Market, odType string, args map[string]interface{}) bool
 
 type FuncOnWsMsg = func(client *WsClient, msg *WsMsg)
+
+// FuncOnWsEvent 根据事件类型直接解析原始消息，返回false时回退到FuncOnWsMsg
+type FuncOnWsEvent = func(client *WsClient, event, stream, payload string) bool
+
+// FuncOnWsRaw 收到原始消息时调用，可用于录制、统计或调试输出，未设置时不做任何处理
+type FuncOnWsRaw = func(url string, data []byte)
 type FuncOnWsMethod = func(client *WsClient, msg map[string]string, info *WsJobInfo)
 type FuncOnWsErr = func(client *WsClient, err *errs.Error)
 type FuncOnWsClose = func(client *WsClient, err *errs.Error)
@@ -36,11 +45,14 @@ type Exchange struct {
 	EnableRateLimit int   // 是否启用请求速率控制:BoolNull/BoolTrue/BoolFalse
 	RateLimit       int64 // 请求速率控制毫秒数，最小间隔单位
 	lastRequestMS   int64 // 上次请求的13位时间戳
+	rateLock        sync.Mutex
 
 	UserAgent  string            // UserAgent of http request
 	ReqHeaders map[string]string // http headers for request exchange
 
 	MarketsWait chan interface{} // whether is loading markets
+	refreshed   *MarketCache     // 后台刷新得到的市场信息，下次LoadMarkets时替换
+	marketLock  sync.Mutex       // lock for refreshed
 	Markets     MarketMap        //cache for all markets
 	MarketsById MarketArrMap     // markets index by id
 	CareMarkets []string         // markets to be fetch: spot/linear/inverse/option
@@ -64,29 +76,52 @@ type Exchange struct {
 	ContractType  string // MarketSwap/MarketFuture
 	MarginMode    string // MarginCross/MarginIsolated
 	TimeInForce   string // GTC/IOC/FOK
-
-	LeverageBrackets map[string][][2]float64 // symbol: [floorValue, maintMarginPct] 按floorValue升序
-
-	OrderBooks map[string]*OrderBook         // symbol: OrderBook update by wss
-	MarkPrices map[string]map[string]float64 // marketType: symbol: mark price
-
-	WSClients  map[string]*WsClient           // accName@url: websocket clients
-	WsIntvs    map[string]int                 // milli secs interval for ws endpoints
-	WsOutChans map[string]interface{}         // accName@url+msgHash: chan Type
-	WsChanRefs map[string]map[string]struct{} // accName@url+msgHash: symbols use this chan
+	ValidateMode  string // ValidateCheck/ValidateAdjust CreateOrder前检查订单，为空不检查
+	DecimalMode   bool   // 为true时订单、成交、余额、持仓、订单簿额外保存decimal精确值
+
+	LeverageBrackets map[string][][2]float64    // symbol: [floorValue, maintMarginPct] 按floorValue升序
+	LeverageTiers    map[string][]*LeverageTier // symbol: 完整的杠杆分层，按MinNotional升序
+	MarketCachePath  string                     // 市场信息缓存文件，为空不缓存
+	MarketCacheSecs  int                        // 缓存有效秒数，过期后重新请求，失败时使用过期缓存
+	marketsTime      int64                      // Markets的获取时间，保存缓存时使用
+	marketReloadStop chan struct{}              // 关闭时停止WatchMarketChanges的自动重新加载
+
+	OrderBooks  map[string]*OrderBook         // symbol: OrderBook update by wss
+	OdBookStats map[string]*OdBookStat        // symbol: OdBookStat
+	statLock    sync.Mutex                    // lock for OdBookStats
+	MarkPrices  map[string]map[string]float64 // marketType: symbol: mark price
+
+	WSClients       map[string]*WsClient           // accName@url: websocket clients
+	WsLock          sync.Mutex                     // lock for WSClients
+	WsIntvs         map[string]int                 // milli secs interval for ws endpoints
+	KlineClosedOnly bool                           // WatchOhlcvs only emit closed bars
+	WsRecorder      *WsRecorder                    // record all ws frames if not nil
+	WsOutChans      map[string]interface{}         // accName@url+msgHash: chan Type
+	WsChanRefs      map[string]map[string]struct{} // accName@url+msgHash: symbols use this chan
+	WsChanPolicies  map[string]*WsChanPolicy       // accName@url+msgHash: overflow policy
+	wsDropped       map[string]int64               // accName@url+msgHash: dropped msg count
+	coalescers      map[string]*outCoalescer       // accName@url+msgHash: coalesce goroutine
+	chanLock        sync.Mutex                     // lock for WsChanPolicies, wsDropped, coalescers
 
 	KeyTimeStamps map[string]int64 // key: int64 更新的时间戳
 
 	// for calling sub struct func in parent struct
-	Sign            FuncSign
-	FetchCurrencies FuncFetchCurr
-	FetchMarkets    FuncFetchMarkets
-	Authenticate    FuncAuth
-	GetRetryWait    func(e *errs.Error) int // 根据错误信息计算重试间隔秒数，<0表示无需重试
+	Sign             FuncSign
+	FetchCurrencies  FuncFetchCurr
+	FetchMarkets     FuncFetchMarkets
+	DecodeMarketInfo func(m *Market) // 从缓存读取后将Market.Info还原为交易所的类型
+	CheckOrderType   FuncCheckOdType // 交易所是否支持此订单类型，为nil不检查
+	Authenticate     FuncAuth
+	GetRetryWait     func(e *errs.Error) int                // 根据错误信息计算重试间隔秒数，<0表示无需重试
+	FetchRefPrice    func(m *Market) (float64, *errs.Error) // ValidateOrder缺少参考价且ParamFetchRefPrice为true时获取，如现货的平均价
 
 	OnWsMsg   FuncOnWsMsg
+	OnWsEvent FuncOnWsEvent
+	OnRawMsg  FuncOnWsRaw
 	OnWsErr   FuncOnWsErr
 	OnWsClose FuncOnWsClose
+	// 连接断开且不再重连时关闭其输出通道，返回关闭的数量；为nil时关闭client.Prefix("")开头的所有通道
+	CloseClientChans func(client *WsClient) int
 
 	Flags map[string]string
 }
@@ -245,16 +280,22 @@ type Market struct {
 	OptionType     string        `json:"optionType"`
 	Precision      *Precision    `json:"precision"`
 	Limits         *MarketLimits `json:"limits"`
+	Rules          *MarketRules  `json:"rules"`
 	Created        int64         `json:"created"`
 	FeeSide        string        `json:"feeSide"` // get/give/base/quote/other
 	Info           interface{}   `json:"info"`
 }
 
+/*
+Precision
+含义由Exchange.PrecisionMode决定：PrecModeDecimalPlace时为小数位数，如2；
+PrecModeTickSize时为最小变动单位，如0.01、0.5、5；PrecModeSignifDigits时为有效数字个数
+*/
 type Precision struct {
-	Amount int `json:"amount"`
-	Price  int `json:"price"`
-	Base   int `json:"base"`
-	Quote  int `json:"quote"`
+	Amount float64 `json:"amount"`
+	Price  float64 `json:"price"`
+	Base   float64 `json:"base"`
+	Quote  float64 `json:"quote"`
 }
 
 type MarketLimits struct {
@@ -265,6 +306,37 @@ type MarketLimits struct {
 	Market   *LimitRange `json:"market"`
 }
 
+/*
+MarketRules
+MarketLimits之外的下单规则，用于下单前检查。为0表示交易所未限制
+*/
+type MarketRules struct {
+	// 委托价格相对参考价的倍数范围；合约参考标记价格，现货参考AvgPriceMins分钟均价
+	PriceMultUp   float64 `json:"priceMultUp"`
+	PriceMultDown float64 `json:"priceMultDown"`
+	// 按买卖方向区分的价格倍数范围，现货PERCENT_PRICE_BY_SIDE
+	BidMultUp    float64 `json:"bidMultUp"`
+	BidMultDown  float64 `json:"bidMultDown"`
+	AskMultUp    float64 `json:"askMultUp"`
+	AskMultDown  float64 `json:"askMultDown"`
+	AvgPriceMins int     `json:"avgPriceMins"` // 计算参考均价的分钟数，0表示最新价
+
+	MinCostToMarket bool `json:"minCostToMarket"` // Limits.Cost.Min是否对市价单生效
+	MaxCostToMarket bool `json:"maxCostToMarket"` // Limits.Cost.Max是否对市价单生效
+	CostAvgMins     int  `json:"costAvgMins"`     // 市价单按此分钟数的均价计算名义价值
+
+	MaxNumOrders        int `json:"maxNumOrders"`        // 最大挂单数
+	MaxNumAlgoOrders    int `json:"maxNumAlgoOrders"`    // 最大条件单数
+	MaxNumIcebergOrders int `json:"maxNumIcebergOrders"` // 最大冰山单数
+	IcebergParts        int `json:"icebergParts"`        // 冰山单最多拆分数
+
+	// 跟踪止损的trailingDelta范围，单位BIPS
+	MinTrailingAboveDelta int `json:"minTrailingAboveDelta"`
+	MaxTrailingAboveDelta int `json:"maxTrailingAboveDelta"`
+	MinTrailingBelowDelta int `json:"minTrailingBelowDelta"`
+	MaxTrailingBelowDelta int `json:"maxTrailingBelowDelta"`
+}
+
 type MarketMap = map[string]*Market
 
 type MarketArrMap = map[string][]*Market
@@ -304,6 +376,13 @@ type Kline struct {
 	Low    float64
 	Close  float64
 	Volume float64
+
+	Closed              bool    // 是否已完结；历史K线始终为true
+	QuoteVolume         float64 // 成交额
+	TradeCount          int64   // 成交笔数
+	TakerBuyVolume      float64 // 主动买入成交量
+	TakerBuyQuoteVolume float64 // 主动买入成交额
+	ContractVolume      float64 // 币本位合约的成交张数，此时Volume为币数，QuoteVolume为张数*合约面值
 }
 
 type SymbolKline struct {
@@ -327,6 +406,18 @@ type Asset struct {
 	Used  float64
 	Total float64
 	Debt  float64
+	Dec   *AssetDec `json:"dec,omitempty"` // DecimalMode时的精确值
+}
+
+/*
+AssetDec
+Asset中数量的decimal精确值，仅DecimalMode时设置
+*/
+type AssetDec struct {
+	Free  decimal.Decimal `json:"free"`
+	Used  decimal.Decimal `json:"used"`
+	Total decimal.Decimal `json:"total"`
+	Debt  decimal.Decimal `json:"debt"`
 }
 
 type Position struct {
@@ -353,6 +444,21 @@ type Position struct {
 	MarginRatio      float64     `json:"marginRatio"`
 	Percentage       float64     `json:"percentage"` // 未实现盈亏百分比
 	Info             interface{} `json:"info"`
+	Dec              *PosDec     `json:"dec,omitempty"` // DecimalMode时的精确值
+}
+
+/*
+PosDec
+Position中交易所直接返回字段的decimal精确值，仅DecimalMode时设置
+*/
+type PosDec struct {
+	Contracts        decimal.Decimal `json:"contracts"`
+	EntryPrice       decimal.Decimal `json:"entryPrice"`
+	MarkPrice        decimal.Decimal `json:"markPrice"`
+	Notional         decimal.Decimal `json:"notional"`
+	UnrealizedPnl    decimal.Decimal `json:"unrealizedPnl"`
+	LiquidationPrice decimal.Decimal `json:"liquidationPrice"`
+	Collateral       decimal.Decimal `json:"collateral"`
 }
 
 type Order struct {
@@ -382,6 +488,22 @@ type Order struct {
 	ReduceOnly          bool        `json:"reduceOnly"`
 	Trades              []*Trade    `json:"trades"`
 	Fee                 *Fee        `json:"fee"`
+	Dec                 *OrderDec   `json:"dec,omitempty"` // DecimalMode时的精确值
+}
+
+/*
+OrderDec
+Order中价格数量的decimal精确值，仅DecimalMode时设置
+*/
+type OrderDec struct {
+	Price        decimal.Decimal `json:"price"`
+	Average      decimal.Decimal `json:"average"`
+	Amount       decimal.Decimal `json:"amount"`
+	Filled       decimal.Decimal `json:"filled"`
+	Remaining    decimal.Decimal `json:"remaining"`
+	TriggerPrice decimal.Decimal `json:"triggerPrice"`
+	Cost         decimal.Decimal `json:"cost"`
+	FeeCost      decimal.Decimal `json:"feeCost"`
 }
 
 type Trade struct {
@@ -397,6 +519,20 @@ type Trade struct {
 	Maker     bool        `json:"maker"`     // 是否maker
 	Fee       *Fee        `json:"fee"`       // 手续费
 	Info      interface{} `json:"info"`
+	Dec       *TradeDec   `json:"dec,omitempty"` // DecimalMode时的精确值
+}
+
+/*
+TradeDec
+Trade中价格数量的decimal精确值，仅DecimalMode时设置。Filled和Average仅MyTrade有
+*/
+type TradeDec struct {
+	Amount  decimal.Decimal `json:"amount"`
+	Price   decimal.Decimal `json:"price"`
+	Cost    decimal.Decimal `json:"cost"`
+	FeeCost decimal.Decimal `json:"feeCost"`
+	Filled  decimal.Decimal `json:"filled"`
+	Average decimal.Decimal `json:"average"`
 }
 
 type MyTrade struct {
@@ -409,6 +545,41 @@ type MyTrade struct {
 	Info     interface{} `json:"info"`
 }
 
+/*
+Liquidation
+强平订单，可能是全市场的强平，也可能是当前账户的强平
+*/
+type Liquidation struct {
+	Symbol       string      `json:"symbol"`
+	Side         string      `json:"side"`         // buy/sell
+	Price        float64     `json:"price"`        // 强平成交均价，未成交时为委托价
+	Contracts    float64     `json:"contracts"`    // 成交数量（合约张数）
+	ContractSize float64     `json:"contractSize"` // 每张合约大小
+	BaseValue    float64     `json:"baseValue"`    // 以基础币计价的价值
+	QuoteValue   float64     `json:"quoteValue"`   // 以计价币计价的价值
+	Status       string      `json:"status"`
+	Timestamp    int64       `json:"timestamp"`
+	Datetime     string      `json:"datetime"`
+	Info         interface{} `json:"info"`
+}
+
+/*
+AccountEvent
+账户配置变化、追加保证金通知、策略状态变化等用户数据流事件
+*/
+type AccountEvent struct {
+	Event       string      `json:"event"` // AccEvtConfig/AccEvtMarginCall/AccEvtStrategy/AccEvtGrid
+	Symbol      string      `json:"symbol"`
+	Leverage    int         `json:"leverage"`    // 调整后的杠杆倍数，仅AccEvtConfig
+	MultiAssets bool        `json:"multiAssets"` // 是否联合保证金模式，仅AccEvtConfig
+	CrossWallet float64     `json:"crossWallet"` // 全仓钱包余额，仅AccEvtMarginCall
+	Positions   []*Position `json:"positions"`   // 需追加保证金的仓位，仅AccEvtMarginCall
+	StrategyID  int64       `json:"strategyId"`  // 策略ID，AccEvtStrategy/AccEvtGrid
+	Status      string      `json:"status"`      // 策略状态，AccEvtStrategy/AccEvtGrid
+	Timestamp   int64       `json:"timestamp"`
+	Info        interface{} `json:"info"`
+}
+
 type Fee struct {
 	IsMaker  bool    `json:"isMaker"` // for calculate fee
 	Currency string  `json:"currency"`
@@ -422,7 +593,19 @@ type OrderBook struct {
 	Asks      *OrderBookSide `json:"asks"`
 	Bids      *OrderBookSide `json:"bids"`
 	Nonce     int64          // latest update id
-	Cache     []map[string]string
+	Cache     []interface{}  // 快照未就绪时缓存的增量消息，类型由交易所决定
+	Reset     bool           `json:"reset"` // true表示订单簿由快照重建，之前收到的订单簿应丢弃
+}
+
+/*
+OdBookStat
+订单簿增量同步的统计信息
+*/
+type OdBookStat struct {
+	Gaps        int   `json:"gaps"`        // 序列号断档次数
+	Resyncs     int   `json:"resyncs"`     // 重新同步成功次数
+	ResyncFails int   `json:"resyncFails"` // 重新同步失败次数
+	LastGapMS   int64 `json:"lastGapMS"`   // 最近一次断档的13位时间戳
 }
 
 /*
@@ -430,10 +613,12 @@ OrderBookSide
 订单簿一侧。不需要加锁，因为只有一个goroutine可以修改
 */
 type OrderBookSide struct {
-	IsBuy bool
-	Rows  [][2]float64
-	Index []float64
-	Depth int
+	IsBuy   bool
+	Rows    [][2]float64
+	Index   []float64
+	Depth   int
+	Exact   bool                 // 为true时同时维护DecRows，需在写入任何档位前设置
+	DecRows [][2]decimal.Decimal // 与Rows一一对应的decimal精确值，仅Exact时有
 }
 
 /*
@@ -461,6 +646,7 @@ WsMsg
 type WsMsg struct {
 	Event   string
 	ID      string
+	Stream  string // stream name for combined streams: /stream?streams=
 	IsArray bool
 	Text    string
 	Object  map[string]string
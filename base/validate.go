@@ -0,0 +1,330 @@
+package base
+
+import (
+	"fmt"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/utils"
+	"math"
+	"strings"
+)
+
+const (
+	ViolInactive     = "inactive"     // 市场不可交易
+	ViolOrderType    = "orderType"    // 交易所不支持此订单类型
+	ViolTimeInForce  = "timeInForce"  // postOnly和timeInForce冲突，或市价单postOnly
+	ViolReduceOnly   = "reduceOnly"   // 现货不支持reduceOnly，或与closePosition冲突
+	ViolStepSize     = "stepSize"     // 数量不是最小步长的整数倍
+	ViolTickSize     = "tickSize"     // 价格不是最小变动价位的整数倍
+	ViolMinAmount    = "minAmount"    // 数量低于最小值
+	ViolMaxAmount    = "maxAmount"    // 数量超过最大值
+	ViolMinPrice     = "minPrice"     // 价格低于最小值
+	ViolMaxPrice     = "maxPrice"     // 价格超过最大值
+	ViolMinCost      = "minCost"      // 名义价值低于最小值
+	ViolMaxCost      = "maxCost"      // 名义价值超过最大值
+	ViolPercentPrice = "percentPrice" // 价格超出参考价的倍数范围
+	ViolNoRefPrice   = "noRefPrice"   // 缺少参考价，未检查百分比价格，仅提示
+)
+
+const (
+	ValidateCheck  = "check"  // 下单前检查，不通过时返回错误
+	ValidateAdjust = "adjust" // 下单前检查，可调整时使用调整后的数量和价格，否则返回错误
+)
+
+/*
+OrderViolation
+订单不满足的一条规则。Limit为规则的限制值，Adjustable表示可通过调整数量或价格满足，
+Warning表示仅提示，不影响检查结果
+*/
+type OrderViolation struct {
+	Code       string
+	Field      string // amount/price/cost/type/timeInForce/reduceOnly/market
+	Value      float64
+	Limit      float64
+	Adjustable bool
+	Warning    bool
+	Msg        string
+}
+
+func (v *OrderViolation) String() string {
+	return v.Msg
+}
+
+/*
+OrderCheck
+ValidateOrder的结果。Amount和Price为调整后能通过检查的数量和价格，无法调整时与输入相同
+*/
+type OrderCheck struct {
+	Symbol     string
+	Violations []*OrderViolation
+	Amount     float64
+	Price      float64
+}
+
+/*
+Valid
+除仅提示的Warning外没有违规
+*/
+func (c *OrderCheck) Valid() bool {
+	for _, v := range c.Violations {
+		if !v.Warning {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Adjustable
+所有违规都可通过调整数量或价格解决
+*/
+func (c *OrderCheck) Adjustable() bool {
+	for _, v := range c.Violations {
+		if !v.Adjustable {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ToError
+转为CodeOrderInvalid错误，通过检查时返回nil
+*/
+func (c *OrderCheck) ToError() *errs.Error {
+	if c.Valid() {
+		return nil
+	}
+	texts := make([]string, 0, len(c.Violations))
+	for _, v := range c.Violations {
+		if !v.Warning {
+			texts = append(texts, v.Msg)
+		}
+	}
+	return errs.NewMsg(errs.CodeOrderInvalid, "%s order invalid: %s", c.Symbol, strings.Join(texts, "; "))
+}
+
+func (c *OrderCheck) add(code, field string, value, limit float64, adjustable bool, msg string, args ...interface{}) {
+	c.Violations = append(c.Violations, &OrderViolation{
+		Code:       code,
+		Field:      field,
+		Value:      value,
+		Limit:      limit,
+		Adjustable: adjustable,
+		Msg:        fmt.Sprintf(msg, args...),
+	})
+}
+
+/*
+ValidateOrder
+下单前按Market.Limits、Precision、Rules检查订单，返回所有不满足的规则和调整后的数量价格。
+params同CreateOrder，额外支持ParamRefPrice作为百分比价格检查的参考价，未提供时使用MarkPrices；
+ParamFetchRefPrice为true时，缺少参考价会通过接口获取，否则跳过百分比价格检查并添加ViolNoRefPrice提示
+*/
+func (e *Exchange) ValidateOrder(symbol, odType, side string, amount, price float64, params *map[string]interface{}) (*OrderCheck, *errs.Error) {
+	market, err := e.GetMarket(symbol)
+	if err != nil {
+		return nil, err
+	}
+	args := utils.SafeParams(params)
+	res := &OrderCheck{Symbol: symbol, Amount: amount, Price: price}
+	isMarket := odType == OdTypeMarket
+	if !market.Active {
+		res.add(ViolInactive, "market", 0, 0, false, "market is not active")
+	}
+	if e.CheckOrderType != nil && !e.CheckOrderType(market, odType, args) {
+		res.add(ViolOrderType, "type", 0, 0, false, "order type %s not supported", odType)
+	}
+	postOnly := utils.GetMapVal(args, ParamPostOnly, false)
+	timeInForce := utils.GetMapVal(args, ParamTimeInForce, "")
+	if postOnly || timeInForce == TimeInForcePO || odType == OdTypeLimitMaker {
+		if timeInForce == TimeInForceIOC || timeInForce == TimeInForceFOK {
+			res.add(ViolTimeInForce, "timeInForce", 0, 0, false, "postOnly orders cannot have timeInForce: %s", timeInForce)
+		} else if isMarket {
+			res.add(ViolTimeInForce, "timeInForce", 0, 0, false, "market orders cannot be postOnly")
+		}
+	}
+	if utils.GetMapVal(args, ParamReduceOnly, false) {
+		marginMode := utils.GetMapVal(args, ParamMarginMode, "")
+		if market.Spot && market.Type != MarketMargin && marginMode == "" {
+			res.add(ViolReduceOnly, "reduceOnly", 0, 0, false, "reduceOnly not supported for spot")
+		} else if utils.GetMapVal(args, ParamClosePosition, false) {
+			res.add(ViolReduceOnly, "reduceOnly", 0, 0, false, "reduceOnly cannot be used with closePosition")
+		}
+	}
+	if err = e.checkOrderPrice(res, market, side, isMarket, args); err != nil {
+		return nil, err
+	}
+	e.checkOrderAmount(res, market, isMarket)
+	return res, nil
+}
+
+/*
+checkOrderPrice
+检查价格范围、百分比价格和最小变动价位。百分比价格的参考价依次使用ParamRefPrice、MarkPrices，
+ParamFetchRefPrice为true时再通过FetchRefPrice获取；都没有时跳过百分比价格检查，添加仅提示的ViolNoRefPrice
+*/
+func (e *Exchange) checkOrderPrice(res *OrderCheck, market *Market, side string, isMarket bool, args map[string]interface{}) *errs.Error {
+	if isMarket || res.Price <= 0 {
+		return nil
+	}
+	price := res.Price
+	if market.Limits != nil && market.Limits.Price != nil {
+		lim := market.Limits.Price
+		if lim.Min > 0 && price < lim.Min {
+			res.add(ViolMinPrice, "price", price, lim.Min, true, "price %v < min %v", price, lim.Min)
+			res.Price = lim.Min
+		} else if lim.Max > 0 && price > lim.Max {
+			res.add(ViolMaxPrice, "price", price, lim.Max, true, "price %v > max %v", price, lim.Max)
+			res.Price = lim.Max
+		}
+	}
+	if rules := market.Rules; rules != nil {
+		multUp, multDown := rules.PriceMultUp, rules.PriceMultDown
+		if side == OdSideBuy && rules.BidMultUp > 0 {
+			multUp, multDown = rules.BidMultUp, rules.BidMultDown
+		} else if side == OdSideSell && rules.AskMultUp > 0 {
+			multUp, multDown = rules.AskMultUp, rules.AskMultDown
+		}
+		refPrice := float64(0)
+		if multUp > 0 {
+			var err *errs.Error
+			refPrice, err = e.getRefPrice(market, args)
+			if err != nil {
+				return err
+			}
+			if refPrice <= 0 {
+				res.Violations = append(res.Violations, &OrderViolation{
+					Code:       ViolNoRefPrice,
+					Field:      "price",
+					Value:      res.Price,
+					Adjustable: true,
+					Warning:    true,
+					Msg:        fmt.Sprintf("percent price not checked: %s required", ParamRefPrice),
+				})
+			}
+		}
+		if refPrice > 0 && multUp > 0 {
+			upper, lower := refPrice*multUp, refPrice*multDown
+			if res.Price > upper {
+				res.add(ViolPercentPrice, "price", res.Price, upper, true, "price %v > %v (ref %v * %v)",
+					res.Price, upper, refPrice, multUp)
+				res.Price = e.roundPrice(market, upper, RoundDown)
+			} else if res.Price < lower {
+				res.add(ViolPercentPrice, "price", res.Price, lower, true, "price %v < %v (ref %v * %v)",
+					res.Price, lower, refPrice, multDown)
+				res.Price = e.roundPrice(market, lower, RoundUp)
+			}
+		}
+	}
+	if market.Precision != nil {
+		prec, err := e.PrecNumFloat(res.Price, market.Precision.Price, RoundNearest)
+		if err == nil && !sameFloat(prec, res.Price) {
+			if sameFloat(res.Price, price) {
+				res.add(ViolTickSize, "price", price, prec, true, "price %v not multiple of tick size", price)
+			}
+			res.Price = prec
+		}
+	}
+	return nil
+}
+
+func (e *Exchange) getRefPrice(market *Market, args map[string]interface{}) (float64, *errs.Error) {
+	refPrice := utils.GetMapVal(args, ParamRefPrice, float64(0))
+	if refPrice > 0 {
+		return refPrice, nil
+	}
+	if prices, ok := e.MarkPrices[market.Type]; ok && prices[market.Symbol] > 0 {
+		return prices[market.Symbol], nil
+	}
+	if e.FetchRefPrice != nil && utils.GetMapVal(args, ParamFetchRefPrice, false) {
+		// 需调用方开启，避免每次下单都阻塞请求接口
+		return e.FetchRefPrice(market)
+	}
+	return 0, nil
+}
+
+func (e *Exchange) checkOrderAmount(res *OrderCheck, market *Market, isMarket bool) {
+	amount := res.Amount
+	if market.Precision != nil {
+		prec, err := e.PrecNumFloat(amount, market.Precision.Amount, RoundDown)
+		if err == nil && !sameFloat(prec, amount) {
+			res.add(ViolStepSize, "amount", amount, prec, true, "amount %v not multiple of step size", amount)
+			res.Amount = prec
+		}
+	}
+	if market.Limits == nil {
+		return
+	}
+	lim := market.Limits.Amount
+	if isMarket && market.Limits.Market != nil && market.Limits.Market.Max > 0 {
+		lim = market.Limits.Market
+	}
+	if lim != nil {
+		if lim.Min > 0 && res.Amount < lim.Min {
+			res.add(ViolMinAmount, "amount", amount, lim.Min, true, "amount %v < min %v", amount, lim.Min)
+			res.Amount = lim.Min
+		} else if lim.Max > 0 && res.Amount > lim.Max {
+			res.add(ViolMaxAmount, "amount", amount, lim.Max, true, "amount %v > max %v", amount, lim.Max)
+			res.Amount = lim.Max
+		}
+	}
+	costLim := market.Limits.Cost
+	if costLim == nil || res.Price <= 0 || market.Inverse {
+		// 市价单无价格时无法计算名义价值；币本位合约按张数计算，无名义价值限制
+		return
+	}
+	applyMin, applyMax := true, true
+	if isMarket && !market.Contract && market.Rules != nil {
+		applyMin, applyMax = market.Rules.MinCostToMarket, market.Rules.MaxCostToMarket
+	}
+	cost := res.Amount * res.Price
+	if market.ContractSize > 0 {
+		cost *= market.ContractSize
+	}
+	if applyMin && costLim.Min > 0 && cost < costLim.Min {
+		minAmt := costLim.Min / res.Price
+		if market.ContractSize > 0 {
+			minAmt /= market.ContractSize
+		}
+		minAmt = e.roundAmount(market, minAmt, RoundUp)
+		adjustable := lim == nil || lim.Max == 0 || minAmt <= lim.Max
+		res.add(ViolMinCost, "cost", cost, costLim.Min, adjustable, "cost %v < min %v", cost, costLim.Min)
+		if adjustable {
+			res.Amount = minAmt
+		}
+	} else if applyMax && costLim.Max > 0 && cost > costLim.Max {
+		maxAmt := costLim.Max / res.Price
+		if market.ContractSize > 0 {
+			maxAmt /= market.ContractSize
+		}
+		maxAmt = e.roundAmount(market, maxAmt, RoundDown)
+		res.add(ViolMaxCost, "cost", cost, costLim.Max, true, "cost %v > max %v", cost, costLim.Max)
+		res.Amount = maxAmt
+	}
+}
+
+func (e *Exchange) roundPrice(market *Market, price float64, rounding int) float64 {
+	if market.Precision == nil {
+		return price
+	}
+	res, err := e.PrecNumFloat(price, market.Precision.Price, rounding)
+	if err != nil {
+		return price
+	}
+	return res
+}
+
+func (e *Exchange) roundAmount(market *Market, amount float64, rounding int) float64 {
+	if market.Precision == nil {
+		return amount
+	}
+	res, err := e.PrecNumFloat(amount, market.Precision.Amount, rounding)
+	if err != nil {
+		return amount
+	}
+	return res
+}
+
+func sameFloat(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-12*math.Max(1, math.Abs(a))
+}
@@ -0,0 +1,94 @@
+package base
+
+import (
+	"github.com/banbox/banexg/errs"
+	"testing"
+)
+
+func TestValidateOrder(t *testing.T) {
+	symbol := "FOO/USDT"
+	e := Exchange{
+		Markets: map[string]*Market{
+			symbol: {
+				ID:        "FOOUSDT",
+				Symbol:    symbol,
+				Type:      MarketSpot,
+				Spot:      true,
+				Active:    true,
+				Precision: &Precision{Price: 2, Amount: 3},
+				Limits: &MarketLimits{
+					Amount: &LimitRange{Min: 0.01, Max: 100},
+					Price:  &LimitRange{Min: 0.01, Max: 10000},
+					Cost:   &LimitRange{Min: 5},
+					Market: &LimitRange{},
+				},
+				Rules: &MarketRules{BidMultUp: 1.1, BidMultDown: 0.9, AskMultUp: 1.1, AskMultDown: 0.9},
+			},
+		},
+	}
+	codes := func(c *OrderCheck) map[string]bool {
+		res := make(map[string]bool)
+		for _, v := range c.Violations {
+			res[v.Code] = true
+		}
+		return res
+	}
+
+	refCalls := 0
+	e.FetchRefPrice = func(m *Market) (float64, *errs.Error) {
+		refCalls += 1
+		return 100, nil
+	}
+	// 未开启ParamFetchRefPrice时不请求参考价，跳过百分比价格检查并提示
+	check, err := e.ValidateOrder(symbol, OdTypeLimit, OdSideSell, 1, 80, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refCalls != 0 || !codes(check)[ViolNoRefPrice] || !check.Valid() || check.ToError() != nil {
+		t.Errorf("expect noRefPrice warning without fetch, calls: %v, got: %v", refCalls, check.Violations)
+	}
+	fetchArgs := map[string]interface{}{ParamFetchRefPrice: true}
+	check, err = e.ValidateOrder(symbol, OdTypeLimit, OdSideBuy, 1, 100, &fetchArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refCalls != 1 {
+		t.Errorf("FetchRefPrice should be called once, got %v", refCalls)
+	}
+	if len(check.Violations) > 0 {
+		t.Errorf("valid order has violations: %v", check.Violations)
+	}
+	check, _ = e.ValidateOrder(symbol, OdTypeLimit, OdSideSell, 1, 80, &fetchArgs)
+	if !codes(check)[ViolPercentPrice] || check.Price != 90 {
+		t.Errorf("expect percentPrice from fetched ref price, got %v, %v", check.ToError(), check.Price)
+	}
+
+	check, _ = e.ValidateOrder(symbol, OdTypeLimit, OdSideBuy, 0.0123456, 100.005, nil)
+	got := codes(check)
+	if !got[ViolStepSize] || !got[ViolTickSize] || !got[ViolMinCost] {
+		t.Errorf("expect stepSize, tickSize, minCost, got: %v", check.ToError())
+	}
+	if !check.Adjustable() || check.Amount != 0.05 || check.Price != 100.01 {
+		t.Errorf("bad adjusted order: %v %v", check.Amount, check.Price)
+	}
+	check, _ = e.ValidateOrder(symbol, OdTypeLimit, OdSideBuy, check.Amount, check.Price, nil)
+	if !check.Valid() {
+		t.Errorf("adjusted order should pass: %v", check.ToError())
+	}
+
+	args := map[string]interface{}{ParamRefPrice: 100.0}
+	check, _ = e.ValidateOrder(symbol, OdTypeLimit, OdSideBuy, 1, 120, &args)
+	if !codes(check)[ViolPercentPrice] || check.Price != 110 {
+		t.Errorf("expect percentPrice and price 110, got %v, %v", check.ToError(), check.Price)
+	}
+
+	args = map[string]interface{}{ParamPostOnly: true, ParamTimeInForce: TimeInForceIOC, ParamReduceOnly: true}
+	check, _ = e.ValidateOrder(symbol, OdTypeLimit, OdSideSell, 1, 100, &args)
+	got = codes(check)
+	if !got[ViolTimeInForce] || !got[ViolReduceOnly] || check.Adjustable() {
+		t.Errorf("expect timeInForce and reduceOnly, got: %v", check.ToError())
+	}
+	if err = check.ToError(); err == nil || err.Code != errs.CodeOrderInvalid {
+		t.Errorf("bad error: %v", err)
+	}
+}
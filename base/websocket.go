@@ -1,7 +1,7 @@
 package base
 
 import (
-	"fmt"
+	"context"
 	"github.com/banbox/banexg/errs"
 	"github.com/banbox/banexg/log"
 	"github.com/banbox/banexg/utils"
@@ -12,9 +12,9 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -24,14 +24,25 @@ type WsClient struct {
 	AccName    string
 	MarketType string
 	Send       chan []byte
+	sendWait   chan *wsWriteReq      // WriteWait的消息，写入后通过done返回结果
 	control    chan int              // 用于内部同步控制命令
+	readDone   chan struct{}         // read协程退出后关闭
+	writeDone  chan struct{}         // write协程退出后关闭
 	JobInfos   map[string]*WsJobInfo // request id: Sub Data
+	jobLock    sync.Mutex            // lock for JobInfos
 	ChanCaps   map[string]int        // msgHash: cap size of cache msg
 	OnMessage  func(client *WsClient, msg *WsMsg)
+	OnEvent    FuncOnWsEvent // 可选，按事件类型直接解析消息，跳过WsMsg的通用解析
+	OnRawMsg   FuncOnWsRaw   // 可选，收到的每条原始消息
 	OnError    func(client *WsClient, err *errs.Error)
 	OnClose    func(client *WsClient, err *errs.Error)
 }
 
+type wsWriteReq struct {
+	data []byte
+	done chan error
+}
+
 type WebSocket struct {
 	Conn *websocket.Conn
 }
@@ -74,6 +85,16 @@ var (
 	ParamHandshakeTimeout = "HandshakeTimeout"
 	ParamChanCaps         = "ChanCaps"
 	ParamChanCap          = "ChanCap"
+	ParamWsRecorder       = "WsRecorder"
+	ParamOverflow         = "Overflow"     // 输出通道满时的处理策略：OverflowBlock等
+	ParamBlockTimeout     = "BlockTimeout" // OverflowBlock的最长等待，time.Duration或毫秒数
+)
+
+const (
+	OverflowBlock      = "block"      // 阻塞等待直到BlockTimeout，超时丢弃新消息
+	OverflowDropOldest = "dropOldest" // 丢弃最早的消息
+	OverflowDropNewest = "dropNewest" // 丢弃新消息
+	OverflowCoalesce   = "coalesce"   // 每个品种只保留最新的待发送消息，适用于订单簿和标记价格
 )
 
 const (
@@ -87,16 +108,20 @@ var (
 	}
 )
 
-func newWsClient(reqUrl string, onMsg FuncOnWsMsg, onErr FuncOnWsErr, onClose FuncOnWsClose,
-	params *map[string]interface{}) (*WsClient, *errs.Error) {
+func newWsClient(reqUrl string, onMsg FuncOnWsMsg, onEvent FuncOnWsEvent, onErr FuncOnWsErr,
+	onClose FuncOnWsClose, params *map[string]interface{}) (*WsClient, *errs.Error) {
 	var result = &WsClient{
 		URL:       reqUrl,
+		OnEvent:   onEvent,
 		Send:      make(chan []byte, 1024),
+		sendWait:  make(chan *wsWriteReq),
 		JobInfos:  make(map[string]*WsJobInfo),
 		OnMessage: onMsg,
 		OnError:   onErr,
 		OnClose:   onClose,
 		control:   make(chan int, 1),
+		readDone:  make(chan struct{}),
+		writeDone: make(chan struct{}),
 	}
 	args := utils.SafeParams(params)
 	result.ChanCaps = DefChanCaps
@@ -113,15 +138,29 @@ func newWsClient(reqUrl string, onMsg FuncOnWsMsg, onErr FuncOnWsErr, onClose Fu
 			return nil, errs.New(errs.CodeConnectFail, err)
 		}
 	}
+	if recorder, ok := args[ParamWsRecorder].(*WsRecorder); ok && recorder != nil {
+		conn = recorder.Wrap(reqUrl, conn)
+	}
 	result.Conn = conn
 	go result.read()
 	go result.write()
 	return result, nil
 }
 
+/*
+GetWsClient
+按accName@url查找websocket客户端
+*/
+func (e *Exchange) GetWsClient(clientKey string) (*WsClient, bool) {
+	e.WsLock.Lock()
+	client, ok := e.WSClients[clientKey]
+	e.WsLock.Unlock()
+	return client, ok
+}
+
 func (e *Exchange) GetClient(wsUrl string, marketType, accName string) (*WsClient, *errs.Error) {
 	clientKey := accName + "@" + wsUrl
-	client, ok := e.WSClients[clientKey]
+	client, ok := e.GetWsClient(clientKey)
 	if ok && client.Conn != nil {
 		return client, nil
 	}
@@ -132,6 +171,9 @@ func (e *Exchange) GetClient(wsUrl string, marketType, accName string) (*WsClien
 	if conn, ok := e.Options[OptWsConn]; ok {
 		params[OptWsConn] = conn
 	}
+	if e.WsRecorder != nil {
+		params[ParamWsRecorder] = e.WsRecorder
+	}
 	if e.OnWsMsg == nil {
 		return nil, errs.NewMsg(errs.CodeParamInvalid, "OnWsMsg is required for ws client")
 	}
@@ -139,16 +181,24 @@ func (e *Exchange) GetClient(wsUrl string, marketType, accName string) (*WsClien
 		if e.OnWsClose != nil {
 			e.OnWsClose(client, err)
 		}
+		if cur, ok := e.GetWsClient(clientKey); !ok || cur != client {
+			// 已被主动移除的客户端（如合并组合流分片），输出通道可能被其他连接共享，不关闭
+			log.Info("ws client removed, keep out chans", zap.String("url", client.URL))
+			return
+		}
 		num := e.handleWsClientClosed(client)
 		log.Info("closed out chan for ws client", zap.Int("num", num))
 	}
-	client, err := newWsClient(wsUrl, e.OnWsMsg, e.OnWsErr, onClosed, &params)
+	client, err := newWsClient(wsUrl, e.OnWsMsg, e.OnWsEvent, e.OnWsErr, onClosed, &params)
 	if err != nil {
 		return nil, err
 	}
 	client.MarketType = marketType
 	client.AccName = accName
+	client.OnRawMsg = e.OnRawMsg
+	e.WsLock.Lock()
 	e.WSClients[clientKey] = client
+	e.WsLock.Unlock()
 	return client, nil
 }
 
@@ -158,6 +208,7 @@ GetWsOutChan
 如果不存在则创建新的并存储
 */
 func GetWsOutChan[T any](e *Exchange, chanKey string, create func(int) T, args map[string]interface{}) T {
+	e.setChanPolicy(chanKey, args)
 	outRaw, oldChan := e.WsOutChans[chanKey]
 	if oldChan {
 		res := outRaw.(T)
@@ -170,27 +221,63 @@ func GetWsOutChan[T any](e *Exchange, chanKey string, create func(int) T, args m
 	}
 }
 
+/*
+WriteOutChan
+写入输出通道，通道满时按chanKey的WsChanPolicy处理；
+未设置策略时，popIfNeed为true丢弃最早的消息，否则丢弃新消息
+*/
 func WriteOutChan[T any](e *Exchange, chanKey string, msg T, popIfNeed bool) bool {
 	outRaw, outOk := e.WsOutChans[chanKey]
-	if outOk {
-		out, ok := outRaw.(chan T)
-		if !ok {
-			log.Error("out chan type error", zap.String("k", chanKey))
-			return false
+	if !outOk {
+		return false
+	}
+	out, ok := outRaw.(chan T)
+	if !ok {
+		log.Error("out chan type error", zap.String("k", chanKey))
+		return false
+	}
+	policy := e.getChanPolicy(chanKey, popIfNeed)
+	if policy.Overflow == OverflowCoalesce {
+		c := e.getCoalescer(chanKey, func(c *outCoalescer) {
+			go runCoalescer(c, out)
+		})
+		if c.push(msgSymbol(msg), msg) {
+			e.addWsDropped(chanKey, 1)
 		}
+		return true
+	}
+	select {
+	case out <- msg:
+		return true
+	default:
+	}
+	switch policy.Overflow {
+	case OverflowBlock:
+		timer := time.NewTimer(policy.BlockTimeout)
+		defer timer.Stop()
 		select {
 		case out <- msg:
-		default:
-			if !popIfNeed {
-				log.Error("out chan full", zap.String("k", chanKey))
-				return false
+			return true
+		case <-timer.C:
+		}
+	case OverflowDropOldest:
+		// chan通道满了，弹出最早的消息，重新发送；都不阻塞，避免和消费者竞争时卡住
+		for i := 0; i < 3; i++ {
+			select {
+			case <-out:
+				e.addWsDropped(chanKey, 1)
+			default:
+			}
+			select {
+			case out <- msg:
+				return true
+			default:
 			}
-			// chan通道满了，弹出最早的消息，重新发送
-			<-out
-			out <- msg
 		}
 	}
-	return outOk
+	log.Warn("out chan full, drop msg", zap.String("k", chanKey), zap.String("policy", policy.Overflow))
+	e.addWsDropped(chanKey, 1)
+	return false
 }
 
 func (e *Exchange) AddWsChanRefs(chanKey string, keys ...string) {
@@ -214,32 +301,82 @@ func (e *Exchange) DelWsChanRefs(chanKey string, keys ...string) int {
 	}
 	hasNum := len(data)
 	if hasNum == 0 {
-		if out, ok := e.WsOutChans[chanKey]; ok {
-			val := reflect.ValueOf(out)
-			if val.Kind() == reflect.Chan {
-				val.Close()
-			}
-			delete(e.WsOutChans, chanKey)
+		if e.closeOutChan(chanKey) {
 			log.Info("remove chan", zap.String("key", chanKey))
 		}
 	}
 	return hasNum
 }
 
+/*
+Close
+关闭所有websocket连接并等待读写协程退出，然后关闭所有输出通道，释放http空闲连接。
+关闭后不应再使用此交易所对象
+*/
+func (e *Exchange) Close(ctx context.Context) *errs.Error {
+	e.WsLock.Lock()
+	clients := make([]*WsClient, 0, len(e.WSClients))
+	for key, client := range e.WSClients {
+		// 先移除，断开时不再触发重连或关闭输出通道
+		delete(e.WSClients, key)
+		clients = append(clients, client)
+	}
+	e.WsLock.Unlock()
+	e.stopMarketReload()
+	var res *errs.Error
+	for _, client := range clients {
+		err := client.CloseWait(ctx)
+		if err != nil {
+			log.Warn("close ws client fail", zap.String("url", client.URL), zap.Error(err))
+			res = err
+		}
+	}
+	num := 0
+	for key := range e.WsOutChans {
+		if e.closeOutChan(key) {
+			num += 1
+		}
+	}
+	e.WsChanRefs = map[string]map[string]struct{}{}
+	if e.WsRecorder != nil {
+		_ = e.WsRecorder.Close()
+	}
+	if e.HttpClient != nil {
+		e.HttpClient.CloseIdleConnections()
+	}
+	log.Info("exchange closed", zap.String("name", e.Name), zap.Int("clients", len(clients)),
+		zap.Int("chans", num))
+	return res
+}
+
 func (e *Exchange) handleWsClientClosed(client *WsClient) int {
-	prefix := client.Prefix("")
+	if e.CloseClientChans != nil {
+		return e.CloseClientChans(client)
+	}
+	return e.CloseWsChans(client.Prefix(""))
+}
+
+/*
+CloseWsChan
+关闭并删除指定key的输出通道
+*/
+func (e *Exchange) CloseWsChan(chanKey string) bool {
+	delete(e.WsChanRefs, chanKey)
+	return e.closeOutChan(chanKey)
+}
+
+/*
+CloseWsChans
+关闭并删除key以prefix开头的所有输出通道，返回关闭的数量
+*/
+func (e *Exchange) CloseWsChans(prefix string) int {
 	removeNum := 0
 	for key, _ := range e.WsChanRefs {
 		if !strings.HasPrefix(key, prefix) {
 			continue
 		}
 		delete(e.WsChanRefs, key)
-		if out, ok := e.WsOutChans[key]; ok {
-			val := reflect.ValueOf(out)
-			if val.Kind() == reflect.Chan {
-				val.Close()
-			}
-			delete(e.WsOutChans, key)
+		if e.closeOutChan(key) {
 			removeNum += 1
 		}
 	}
@@ -252,10 +389,9 @@ CheckWsError
 */
 func CheckWsError(msg map[string]string) *errs.Error {
 	errRaw, ok := msg["error"]
-	if ok {
+	if ok && errRaw != "" {
 		var err = &errs.Error{}
-		errData, _ := sonic.Marshal(errRaw)
-		_ = sonic.Unmarshal(errData, err)
+		_ = sonic.UnmarshalString(errRaw, err)
 		return err
 	}
 	status, ok := msg["status"]
@@ -277,28 +413,118 @@ jobID: 此次消息的任务ID，唯一标识此次请求
 jobInfo: 此次任务的主要信息，在收到任务结果时使用
 */
 func (c *WsClient) Write(msg interface{}, info *WsJobInfo) *errs.Error {
+	data, err := c.prepareWrite(msg, info)
+	if err != nil {
+		return err
+	}
+	c.Send <- data
+	return nil
+}
+
+/*
+WriteWait
+发送消息并等待写入连接后返回。连接已关闭或写入失败时返回CodeConnectFail，表示消息未发出
+*/
+func (c *WsClient) WriteWait(ctx context.Context, msg interface{}, info *WsJobInfo) *errs.Error {
+	data, err := c.prepareWrite(msg, info)
+	if err != nil {
+		return err
+	}
+	fail := func(err *errs.Error) *errs.Error {
+		if info != nil {
+			c.DelJobInfo(info.ID)
+		}
+		return err
+	}
+	req := &wsWriteReq{data: data, done: make(chan error, 1)}
+	select {
+	case c.sendWait <- req:
+	case <-c.writeDone:
+		return fail(errs.NewMsg(errs.CodeConnectFail, "ws closed: %s", c.URL))
+	case <-ctx.Done():
+		return fail(errs.New(errs.CodeConnectFail, ctx.Err()))
+	}
+	select {
+	case err2 := <-req.done:
+		if err2 != nil {
+			return fail(errs.New(errs.CodeConnectFail, err2))
+		}
+		return nil
+	case <-ctx.Done():
+		return fail(errs.New(errs.CodeNetFail, ctx.Err()))
+	}
+}
+
+func (c *WsClient) prepareWrite(msg interface{}, info *WsJobInfo) ([]byte, *errs.Error) {
 	data, err2 := sonic.Marshal(msg)
 	if err2 != nil {
-		return errs.New(errs.CodeUnmarshalFail, err2)
+		return nil, errs.New(errs.CodeUnmarshalFail, err2)
 	}
 	if info != nil {
 		if info.ID == "" {
-			return errs.NewMsg(errs.CodeParamRequired, "WsJobInfo.ID is required")
+			return nil, errs.NewMsg(errs.CodeParamRequired, "WsJobInfo.ID is required")
 		}
+		c.jobLock.Lock()
 		if _, ok := c.JobInfos[info.ID]; !ok {
 			c.JobInfos[info.ID] = info
 		}
+		c.jobLock.Unlock()
 	}
 	if log.GetLevel() >= zapcore.DebugLevel {
 		msgText := string(data)
 		log.Debug("write ws msg", zap.String("url", c.URL), zap.String("msg", msgText))
 	}
-	c.Send <- data
-	return nil
+	return data, nil
+}
+
+/*
+IsClosed
+读或写协程已退出时，连接不可再用
+*/
+func (c *WsClient) IsClosed() bool {
+	select {
+	case <-c.readDone:
+		return true
+	case <-c.writeDone:
+		return true
+	default:
+		return false
+	}
+}
+
+/*
+DelJobInfo
+删除未收到结果的任务，如请求超时
+*/
+func (c *WsClient) DelJobInfo(id string) {
+	c.jobLock.Lock()
+	delete(c.JobInfos, id)
+	c.jobLock.Unlock()
 }
 
 func (c *WsClient) Close() {
-	c.control <- ctrlDoClose
+	select {
+	case c.control <- ctrlDoClose:
+	case <-c.writeDone:
+	}
+}
+
+/*
+CloseWait
+发送关闭帧，等待服务器关闭连接及读写协程退出。ctx结束时强制关闭底层连接
+*/
+func (c *WsClient) CloseWait(ctx context.Context) *errs.Error {
+	c.Close()
+	select {
+	case <-c.readDone:
+		<-c.writeDone
+		return nil
+	case <-ctx.Done():
+		if conn := c.Conn; conn != nil {
+			_ = conn.Close()
+		}
+		return errs.NewMsg(errs.CodeNetFail, "close ws %s timeout: %v", c.URL, ctx.Err())
+	}
 }
 
 func (c *WsClient) write() {
@@ -309,8 +535,8 @@ func (c *WsClient) write() {
 		if err != nil {
 			log.Error("close ws error", zapUrl, zap.Error(err))
 		}
-		close(c.control)
 		c.Conn = nil // 置为nil表示连接已关闭
+		close(c.writeDone)
 	}()
 	for {
 		select {
@@ -342,33 +568,49 @@ func (c *WsClient) write() {
 				log.Info("WsClient.Send closed", zapUrl)
 				return
 			}
-			w, err := c.Conn.NextWriter()
-			if err != nil {
-				log.Error("failed to create Ws.Writer", zapUrl, zap.Error(err))
+			if broken, _ := c.writeFrame(msg); broken {
 				return
 			}
-			_, err = w.Write(msg)
-			if err != nil {
-				log.Error("write ws fail", zapUrl, zap.Error(err))
-			}
-			n := len(c.Send)
-			for i := 0; i < n; i++ {
-				_, err = w.Write(<-c.Send)
-				if err != nil {
-					log.Error("write ws fail", zapUrl, zap.Error(err))
-				}
-			}
-			if err := w.Close(); err != nil {
-				log.Error("close WriteCloser fail", zapUrl, zap.Error(err))
+		case req := <-c.sendWait:
+			broken, err := c.writeFrame(req.data)
+			req.done <- err
+			if broken {
 				return
 			}
 		}
 	}
 }
 
+/*
+writeFrame
+写入一帧消息，broken为true表示连接已不可用，需退出写协程
+*/
+func (c *WsClient) writeFrame(msg []byte) (broken bool, err error) {
+	zapUrl := zap.String("url", c.URL)
+	w, err := c.Conn.NextWriter()
+	if err != nil {
+		log.Error("failed to create Ws.Writer", zapUrl, zap.Error(err))
+		return true, err
+	}
+	// 每个消息单独一帧，合并写入会导致服务器无法解析
+	_, err = w.Write(msg)
+	if err != nil {
+		log.Error("write ws fail", zapUrl, zap.Error(err))
+	}
+	if err2 := w.Close(); err2 != nil {
+		log.Error("close WriteCloser fail", zapUrl, zap.Error(err2))
+		return true, err2
+	}
+	return false, err
+}
+
 func (c *WsClient) read() {
 	defer func() {
-		c.control <- ctrlClosed
+		close(c.readDone)
+		select {
+		case c.control <- ctrlClosed:
+		case <-c.writeDone:
+		}
 	}()
 	for {
 		msgRaw, err := c.Conn.ReadMsg()
@@ -385,8 +627,16 @@ func (c *WsClient) read() {
 }
 
 func (c *WsClient) handleRawMsg(msgRaw []byte) {
+	if c.OnRawMsg != nil {
+		c.OnRawMsg(c.URL, msgRaw)
+	}
 	msgText := string(msgRaw)
-	fmt.Printf("receive %s\n", msgText)
+	if c.OnEvent != nil {
+		event, stream, payload := PeekWsEvent(msgText)
+		if event != "" && c.OnEvent(c, event, stream, payload) {
+			return
+		}
+	}
 	msg, err := NewWsMsg(msgText)
 	if err != nil {
 		if c.OnError != nil {
@@ -396,10 +646,15 @@ func (c *WsClient) handleRawMsg(msgRaw []byte) {
 		return
 	}
 	if !msg.IsArray && msg.ID != "" {
-		if sub, ok := c.JobInfos[msg.ID]; ok && sub.Method != nil {
+		c.jobLock.Lock()
+		sub, ok := c.JobInfos[msg.ID]
+		if ok && sub.Method != nil {
+			delete(c.JobInfos, msg.ID)
+		}
+		c.jobLock.Unlock()
+		if ok && sub.Method != nil {
 			// 订阅信息中提供了处理函数，则调用处理函数
 			sub.Method(c, msg.Object, sub)
-			delete(c.JobInfos, msg.ID)
 			return
 		}
 	}
@@ -408,16 +663,94 @@ func (c *WsClient) handleRawMsg(msgRaw []byte) {
 }
 
 func (c *WsClient) Prefix(key string) string {
-	var arr = []string{c.AccName, "@", c.URL, "#", key}
+	return WsPrefix(c.AccName, c.URL, key)
+}
+
+/*
+WsPrefix
+输出通道key的前缀。URL中#之后是组合流分片的序号，同一组合流的多个分片连接共享输出通道，
+因此分片断开时不能按此前缀关闭通道，需设置Exchange.CloseClientChans
+*/
+func WsPrefix(accName, url, key string) string {
+	if idx := strings.IndexByte(url, '#'); idx >= 0 {
+		url = url[:idx]
+	}
+	var arr = []string{accName, "@", url, "#", key}
 	return strings.Join(arr, "")
 }
 
+/*
+PeekWsEvent
+只读取消息的事件类型，不解析其他字段。组合流消息返回stream和data部分，否则payload为原消息。
+非对象消息或没有事件类型时，event为空
+*/
+func PeekWsEvent(msgText string) (string, string, string) {
+	if !strings.HasPrefix(msgText, "{") {
+		return "", "", msgText
+	}
+	var stream string
+	payload := msgText
+	// 组合流的stream不一定在第一个字段，不能只判断前缀
+	if node, err := sonic.GetFromString(msgText, "stream"); err == nil {
+		stream, _ = node.String()
+		node, err = sonic.GetFromString(msgText, "data")
+		if err != nil {
+			return "", stream, msgText
+		}
+		payload, err = node.Raw()
+		if err != nil || !strings.HasPrefix(payload, "{") {
+			return "", stream, payload
+		}
+	}
+	node, err := sonic.GetFromString(payload, "e")
+	if err != nil {
+		return "", stream, payload
+	}
+	event, _ := node.String()
+	return event, stream, payload
+}
+
+/*
+newCombinedWsMsg
+解析组合流消息的data部分，stream记录到WsMsg.Stream
+*/
+func newCombinedWsMsg(stream string, data interface{}, msgText string) *WsMsg {
+	switch val := data.(type) {
+	case map[string]interface{}:
+		var obj = utils.MapValStr(val)
+		event, _ := utils.SafeMapVal(obj, "e", "")
+		return &WsMsg{Event: event, Stream: stream, Object: obj, Text: msgText}
+	case []interface{}:
+		var event string
+		var itemList = make([]map[string]string, 0, len(val))
+		for _, it := range val {
+			itMap, ok := it.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			var obj = utils.MapValStr(itMap)
+			if len(itemList) == 0 {
+				event, _ = utils.SafeMapVal(obj, "e", "")
+			}
+			itemList = append(itemList, obj)
+		}
+		return &WsMsg{Event: event, Stream: stream, IsArray: true, List: itemList, Text: msgText}
+	}
+	return nil
+}
+
 func NewWsMsg(msgText string) (*WsMsg, *errs.Error) {
 	var err_ error
 	if strings.HasPrefix(msgText, "{") {
 		var msg = make(map[string]interface{})
 		err_ = sonic.UnmarshalString(msgText, &msg)
 		if err_ == nil {
+			if stream, ok := msg["stream"].(string); ok {
+				// combined stream: {"stream":"<streamName>","data":<rawPayload>}
+				if res := newCombinedWsMsg(stream, msg["data"], msgText); res != nil {
+					return res, nil
+				}
+			}
 			var obj = utils.MapValStr(msg)
 			event, _ := utils.SafeMapVal(obj, "e", "")
 			id, _ := utils.SafeMapVal(obj, "id", "")
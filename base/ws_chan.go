@@ -0,0 +1,246 @@
+package base
+
+import (
+	"github.com/banbox/banexg/log"
+	"go.uber.org/zap"
+	"reflect"
+	"sync"
+	"time"
+)
+
+/*
+WsChanPolicy
+输出通道满时的处理策略，通过Watch*的params中ParamOverflow和ParamBlockTimeout指定
+*/
+type WsChanPolicy struct {
+	Overflow     string        // OverflowBlock/OverflowDropOldest/OverflowDropNewest/OverflowCoalesce
+	BlockTimeout time.Duration // OverflowBlock时最长等待时间，超时后丢弃新消息
+}
+
+/*
+outCoalescer
+按品种合并待发送的消息，每个品种只保留最新的一条，由单独的协程按顺序写入输出通道
+*/
+type outCoalescer struct {
+	lock    sync.Mutex
+	keys    []string               // 待发送品种的顺序
+	pending map[string]interface{} // symbol: latest msg
+	notify  chan struct{}
+	done    chan struct{}
+	exited  chan struct{}
+}
+
+func (c *outCoalescer) push(key string, msg interface{}) bool {
+	c.lock.Lock()
+	old, replaced := c.pending[key]
+	if !replaced {
+		c.keys = append(c.keys, key)
+	} else if oldMap, ok := old.(map[string]float64); ok {
+		// 标记价格等按品种的map，合并而非覆盖，避免丢失其他品种
+		if newMap, ok := msg.(map[string]float64); ok {
+			merged := make(map[string]float64, len(oldMap)+len(newMap))
+			for k, v := range oldMap {
+				merged[k] = v
+			}
+			for k, v := range newMap {
+				merged[k] = v
+			}
+			msg = merged
+		}
+	}
+	c.pending[key] = msg
+	c.lock.Unlock()
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+	return replaced
+}
+
+func (c *outCoalescer) pop() (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.keys) == 0 {
+		return nil, false
+	}
+	key := c.keys[0]
+	c.keys = c.keys[1:]
+	msg := c.pending[key]
+	delete(c.pending, key)
+	return msg, true
+}
+
+func runCoalescer[T any](c *outCoalescer, out chan T) {
+	defer close(c.exited)
+	for {
+		select {
+		case <-c.notify:
+		case <-c.done:
+			return
+		}
+		for {
+			msg, ok := c.pop()
+			if !ok {
+				break
+			}
+			select {
+			case out <- msg.(T):
+			case <-c.done:
+				return
+			}
+		}
+	}
+}
+
+/*
+symbolGetter
+自定义消息类型实现此接口后，OverflowCoalesce可按品种合并
+*/
+type symbolGetter interface {
+	GetSymbol() string
+}
+
+/*
+msgSymbol
+返回消息的Symbol，用于按品种合并；没有时返回空字符串，即所有消息只保留最新一条。
+在写入通道的热路径上调用，按已知消息类型判断，不使用反射
+*/
+func msgSymbol(msg interface{}) string {
+	switch val := msg.(type) {
+	case OrderBook:
+		return val.Symbol
+	case *OrderBook:
+		return val.Symbol
+	case SymbolKline:
+		return val.Symbol
+	case *SymbolKline:
+		return val.Symbol
+	case Ticker:
+		return val.Symbol
+	case *Ticker:
+		return val.Symbol
+	case Trade:
+		return val.Symbol
+	case *Trade:
+		return val.Symbol
+	case MyTrade:
+		return val.Symbol
+	case *MyTrade:
+		return val.Symbol
+	case Order:
+		return val.Symbol
+	case *Order:
+		return val.Symbol
+	case Liquidation:
+		return val.Symbol
+	case *Liquidation:
+		return val.Symbol
+	case AccountEvent:
+		return val.Symbol
+	case *AccountEvent:
+		return val.Symbol
+	case symbolGetter:
+		return val.GetSymbol()
+	}
+	return ""
+}
+
+/*
+setChanPolicy
+从参数中读取输出通道的溢出策略，未指定时不设置，使用WriteOutChan调用方的默认策略
+*/
+func (e *Exchange) setChanPolicy(chanKey string, args map[string]interface{}) {
+	overflow, _ := args[ParamOverflow].(string)
+	if overflow == "" {
+		return
+	}
+	delete(args, ParamOverflow)
+	policy := &WsChanPolicy{Overflow: overflow, BlockTimeout: time.Second}
+	switch val := args[ParamBlockTimeout].(type) {
+	case time.Duration:
+		policy.BlockTimeout = val
+	case int:
+		policy.BlockTimeout = time.Duration(val) * time.Millisecond
+	}
+	delete(args, ParamBlockTimeout)
+	e.chanLock.Lock()
+	e.WsChanPolicies[chanKey] = policy
+	e.chanLock.Unlock()
+}
+
+func (e *Exchange) getChanPolicy(chanKey string, popIfNeed bool) *WsChanPolicy {
+	e.chanLock.Lock()
+	policy, ok := e.WsChanPolicies[chanKey]
+	e.chanLock.Unlock()
+	if ok {
+		return policy
+	}
+	if popIfNeed {
+		return &WsChanPolicy{Overflow: OverflowDropOldest}
+	}
+	return &WsChanPolicy{Overflow: OverflowDropNewest}
+}
+
+func (e *Exchange) getCoalescer(chanKey string, start func(c *outCoalescer)) *outCoalescer {
+	e.chanLock.Lock()
+	defer e.chanLock.Unlock()
+	c, ok := e.coalescers[chanKey]
+	if !ok {
+		c = &outCoalescer{
+			pending: map[string]interface{}{},
+			notify:  make(chan struct{}, 1),
+			done:    make(chan struct{}),
+			exited:  make(chan struct{}),
+		}
+		e.coalescers[chanKey] = c
+		start(c)
+	}
+	return c
+}
+
+func (e *Exchange) addWsDropped(chanKey string, num int64) {
+	e.chanLock.Lock()
+	e.wsDropped[chanKey] += num
+	e.chanLock.Unlock()
+	log.Debug("out chan drop msg", zap.String("k", chanKey), zap.Int64("num", num))
+}
+
+/*
+GetWsDropped
+返回各输出通道因消费过慢而丢弃或被合并的消息数量，key与WsOutChans相同
+*/
+func (e *Exchange) GetWsDropped() map[string]int64 {
+	e.chanLock.Lock()
+	defer e.chanLock.Unlock()
+	res := make(map[string]int64, len(e.wsDropped))
+	for k, v := range e.wsDropped {
+		res[k] = v
+	}
+	return res
+}
+
+/*
+closeOutChan
+停止合并协程后关闭并删除输出通道，保证每个通道只关闭一次
+*/
+func (e *Exchange) closeOutChan(chanKey string) bool {
+	e.chanLock.Lock()
+	c, ok := e.coalescers[chanKey]
+	delete(e.coalescers, chanKey)
+	delete(e.WsChanPolicies, chanKey)
+	e.chanLock.Unlock()
+	if ok {
+		close(c.done)
+		<-c.exited
+	}
+	out, ok := e.WsOutChans[chanKey]
+	if !ok {
+		return false
+	}
+	delete(e.WsOutChans, chanKey)
+	val := reflect.ValueOf(out)
+	if val.Kind() == reflect.Chan {
+		val.Close()
+	}
+	return true
+}
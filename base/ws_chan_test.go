@@ -0,0 +1,87 @@
+package base
+
+import (
+	"testing"
+	"time"
+)
+
+type symbolMsg struct {
+	Symbol string
+	Val    int
+}
+
+func (m symbolMsg) GetSymbol() string {
+	return m.Symbol
+}
+
+func TestWriteOutChanPolicy(t *testing.T) {
+	e := Exchange{}
+	e.Init()
+	create := func(cap int) chan symbolMsg { return make(chan symbolMsg, cap) }
+
+	newest := GetWsOutChan(&e, "newest", create, map[string]interface{}{
+		ParamChanCap: 1, ParamOverflow: OverflowDropNewest})
+	WriteOutChan(&e, "newest", symbolMsg{"a", 1}, true)
+	WriteOutChan(&e, "newest", symbolMsg{"a", 2}, true)
+	if msg := <-newest; msg.Val != 1 {
+		t.Errorf("dropNewest should keep first msg, got %v", msg.Val)
+	}
+
+	oldest := GetWsOutChan(&e, "oldest", create, map[string]interface{}{ParamChanCap: 1})
+	WriteOutChan(&e, "oldest", symbolMsg{"a", 1}, true)
+	WriteOutChan(&e, "oldest", symbolMsg{"a", 2}, true)
+	if msg := <-oldest; msg.Val != 2 {
+		t.Errorf("dropOldest should keep last msg, got %v", msg.Val)
+	}
+
+	GetWsOutChan(&e, "block", create, map[string]interface{}{
+		ParamChanCap: 1, ParamOverflow: OverflowBlock, ParamBlockTimeout: 10})
+	WriteOutChan(&e, "block", symbolMsg{"a", 1}, false)
+	start := time.Now()
+	if WriteOutChan(&e, "block", symbolMsg{"a", 2}, false) {
+		t.Error("block should timeout")
+	}
+	if time.Since(start) < time.Millisecond*10 {
+		t.Error("block should wait BlockTimeout")
+	}
+
+	coalesce := GetWsOutChan(&e, "coalesce", create, map[string]interface{}{
+		ParamChanCap: 1, ParamOverflow: OverflowCoalesce})
+	e.AddWsChanRefs("coalesce", "a", "b")
+	for i := 1; i <= 5; i++ {
+		WriteOutChan(&e, "coalesce", symbolMsg{"a", i}, true)
+		WriteOutChan(&e, "coalesce", symbolMsg{"b", i}, true)
+	}
+	time.Sleep(time.Millisecond * 50)
+	var last = map[string]int{}
+	for len(coalesce) > 0 || len(last) < 2 || last["a"] != 5 || last["b"] != 5 {
+		select {
+		case msg := <-coalesce:
+			last[msg.Symbol] = msg.Val
+		case <-time.After(time.Second):
+			t.Fatalf("coalesce should deliver latest per symbol, got %v", last)
+		}
+	}
+
+	dropped := e.GetWsDropped()
+	if dropped["newest"] != 1 || dropped["oldest"] != 1 || dropped["block"] != 1 || dropped["coalesce"] == 0 {
+		t.Errorf("bad dropped counters: %v", dropped)
+	}
+	e.DelWsChanRefs("coalesce", "a", "b")
+	if _, ok := <-coalesce; ok {
+		t.Error("coalesce chan should be closed")
+	}
+}
+
+func TestMsgSymbol(t *testing.T) {
+	items := []interface{}{OrderBook{Symbol: "a"}, &SymbolKline{Symbol: "a"}, Ticker{Symbol: "a"},
+		&MyTrade{Trade: Trade{Symbol: "a"}}, symbolMsg{Symbol: "a"}}
+	for _, msg := range items {
+		if got := msgSymbol(msg); got != "a" {
+			t.Errorf("bad symbol for %T: %v", msg, got)
+		}
+	}
+	if got := msgSymbol(map[string]float64{"a": 1}); got != "" {
+		t.Errorf("map msg should have no symbol: %v", got)
+	}
+}
@@ -0,0 +1,267 @@
+package base
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"github.com/banbox/banexg/errs"
+	"github.com/bytedance/sonic"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	WsFrameIn  = "in"  // 从服务器收到的消息
+	WsFrameOut = "out" // 发送到服务器的消息
+)
+
+/*
+WsFrame
+录制的一条websocket消息，文件中每行一条，按时间顺序
+*/
+type WsFrame struct {
+	Time int64  `json:"t"`   // 13位毫秒时间戳
+	URL  string `json:"url"` // WsClient.URL，组合流分片带#序号
+	Dir  string `json:"dir"` // WsFrameIn/WsFrameOut
+	Data string `json:"data"`
+}
+
+/*
+WsRecorder
+将所有websocket收发的消息带时间戳写入文件，可通过OptWsRecord启用，用于离线复现问题
+*/
+type WsRecorder struct {
+	file *os.File
+	lock sync.Mutex
+}
+
+func NewWsRecorder(path string) (*WsRecorder, *errs.Error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errs.New(errs.CodeIOWriteFail, err)
+	}
+	return &WsRecorder{file: file}, nil
+}
+
+func (r *WsRecorder) Record(url, dir string, data []byte) {
+	frame := &WsFrame{
+		Time: time.Now().UnixMilli(),
+		URL:  url,
+		Dir:  dir,
+		Data: string(data),
+	}
+	line, err := sonic.Marshal(frame)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file != nil {
+		_, _ = r.file.Write(line)
+	}
+}
+
+func (r *WsRecorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+/*
+Wrap
+包装WsConn，收发的消息都写入录制文件
+*/
+func (r *WsRecorder) Wrap(url string, conn WsConn) WsConn {
+	return &recordWsConn{WsConn: conn, url: url, rec: r}
+}
+
+type recordWsConn struct {
+	WsConn
+	url string
+	rec *WsRecorder
+}
+
+func (c *recordWsConn) ReadMsg() ([]byte, error) {
+	data, err := c.WsConn.ReadMsg()
+	if err == nil {
+		c.rec.Record(c.url, WsFrameIn, data)
+	}
+	return data, err
+}
+
+func (c *recordWsConn) NextWriter() (io.WriteCloser, error) {
+	w, err := c.WsConn.NextWriter()
+	if err != nil {
+		return nil, err
+	}
+	return &recordWriter{WriteCloser: w, conn: c}, nil
+}
+
+type recordWriter struct {
+	io.WriteCloser
+	conn *recordWsConn
+	buf  bytes.Buffer
+}
+
+func (w *recordWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	return w.WriteCloser.Write(p)
+}
+
+func (w *recordWriter) Close() error {
+	w.conn.rec.Record(w.conn.url, WsFrameOut, w.buf.Bytes())
+	return w.WriteCloser.Close()
+}
+
+/*
+ReadWsFrames
+读取录制文件中的消息，url不为空时只返回此URL的消息
+*/
+func ReadWsFrames(path, url string) ([]*WsFrame, *errs.Error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errs.New(errs.CodeIOReadFail, err)
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	res := make([]*WsFrame, 0)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var frame WsFrame
+			if err_ := sonic.Unmarshal(line, &frame); err_ != nil {
+				return nil, errs.New(errs.CodeUnmarshalFail, err_)
+			}
+			if url == "" || frame.URL == url {
+				res = append(res, &frame)
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, errs.New(errs.CodeIOReadFail, err)
+		}
+	}
+	return res, nil
+}
+
+/*
+ReplayWsConn
+按录制的时间间隔重放收到的消息，可通过OptWsConn传入交易所，离线复现订单簿、K线等问题。
+Speed为重放速度倍数，1表示真实速度，<=0表示不等待立即返回。
+所有消息重放完成后Done被关闭，ReadMsg阻塞直到Close。发送的消息保存在Sent中。
+*/
+type ReplayWsConn struct {
+	Speed  float64
+	frames []*WsFrame
+	index  int
+	start  time.Time
+	closed chan struct{}
+	done   chan struct{}
+	once   sync.Once
+	lock   sync.Mutex
+	Sent   []string
+}
+
+/*
+NewReplayWsConn
+从录制文件创建重放连接，只重放url的收到消息，url为空时重放所有收到的消息
+*/
+func NewReplayWsConn(path, url string, speed float64) (*ReplayWsConn, *errs.Error) {
+	frames, err := ReadWsFrames(path, url)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayWsConnFrames(frames, speed), nil
+}
+
+func NewReplayWsConnFrames(frames []*WsFrame, speed float64) *ReplayWsConn {
+	inFrames := make([]*WsFrame, 0, len(frames))
+	for _, f := range frames {
+		if f.Dir == WsFrameIn {
+			inFrames = append(inFrames, f)
+		}
+	}
+	return &ReplayWsConn{
+		Speed:  speed,
+		frames: inFrames,
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (c *ReplayWsConn) ReadMsg() ([]byte, error) {
+	if c.index >= len(c.frames) {
+		c.once.Do(func() { close(c.done) })
+		<-c.closed
+		return nil, io.EOF
+	}
+	frame := c.frames[c.index]
+	if c.index == 0 {
+		c.start = time.Now()
+	} else if c.Speed > 0 {
+		offset := float64(frame.Time-c.frames[0].Time) / c.Speed
+		wait := time.Until(c.start.Add(time.Duration(offset * float64(time.Millisecond))))
+		if wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-c.closed:
+				return nil, io.EOF
+			}
+		}
+	}
+	c.index += 1
+	return []byte(frame.Data), nil
+}
+
+/*
+Done
+所有消息重放完成后关闭
+*/
+func (c *ReplayWsConn) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *ReplayWsConn) NextWriter() (io.WriteCloser, error) {
+	return &replayWriter{conn: c}, nil
+}
+
+func (c *ReplayWsConn) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+	}
+	return nil
+}
+
+func (c *ReplayWsConn) WriteClose() error {
+	return c.Close()
+}
+
+type replayWriter struct {
+	conn *ReplayWsConn
+	buf  bytes.Buffer
+}
+
+func (w *replayWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *replayWriter) Close() error {
+	w.conn.lock.Lock()
+	w.conn.Sent = append(w.conn.Sent, w.buf.String())
+	w.conn.lock.Unlock()
+	return nil
+}
@@ -0,0 +1,95 @@
+package base
+
+import (
+	"context"
+	"github.com/banbox/banexg/errs"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWsRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ws.jsonl")
+	rec, err := NewWsRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "wss://fstream.binance.com/stream#0"
+	src := NewReplayWsConnFrames([]*WsFrame{
+		{Time: 1000, URL: url, Dir: WsFrameIn, Data: `{"a":1}`},
+		{Time: 1200, URL: url, Dir: WsFrameIn, Data: `{"a":2}`},
+	}, 0)
+	conn := rec.Wrap(url, src)
+	w, _ := conn.NextWriter()
+	_, _ = w.Write([]byte(`{"method":"SUBSCRIBE"}`))
+	_ = w.Close()
+	for i := 0; i < 2; i++ {
+		if _, err_ := conn.ReadMsg(); err_ != nil {
+			t.Fatal(err_)
+		}
+	}
+	_ = rec.Close()
+	if len(src.Sent) != 1 {
+		t.Errorf("sent msg not passed through: %d", len(src.Sent))
+	}
+
+	frames, err := ReadWsFrames(path, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 3 || frames[0].Dir != WsFrameOut || frames[2].Data != `{"a":2}` {
+		t.Fatalf("bad recorded frames: %d", len(frames))
+	}
+	// 模拟200ms的间隔，10倍速重放
+	frames[2].Time = frames[1].Time + 200
+	replay := NewReplayWsConnFrames(frames, 10)
+	start := time.Now()
+	for _, want := range []string{`{"a":1}`, `{"a":2}`} {
+		data, err_ := replay.ReadMsg()
+		if err_ != nil || string(data) != want {
+			t.Fatalf("replay got %s, want %s", data, want)
+		}
+	}
+	if cost := time.Since(start); cost < time.Millisecond*15 || cost > time.Millisecond*150 {
+		t.Errorf("replay speed wrong, cost: %v", cost)
+	}
+	go func() {
+		<-replay.Done()
+		_ = replay.Close()
+	}()
+	if _, err_ := replay.ReadMsg(); err_ == nil {
+		t.Error("should return EOF after all frames replayed")
+	}
+}
+
+func TestWsClientWriteWait(t *testing.T) {
+	conn := NewReplayWsConnFrames(nil, 0)
+	params := map[string]interface{}{OptWsConn: conn}
+	client, err := newWsClient("wss://fake/ws", func(client *WsClient, msg *WsMsg) {}, nil, nil, nil, &params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err = client.WriteWait(ctx, map[string]interface{}{"id": 1}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.Sent) != 1 || conn.Sent[0] != `{"id":1}` {
+		t.Fatalf("frame not written: %v", conn.Sent)
+	}
+	_ = conn.Close()
+	deadline := time.Now().Add(time.Second)
+	for !client.IsClosed() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if !client.IsClosed() {
+		t.Fatal("client should be closed")
+	}
+	info := &WsJobInfo{ID: "2"}
+	err = client.WriteWait(ctx, map[string]interface{}{"id": 2}, info)
+	if err == nil || err.Code != errs.CodeConnectFail {
+		t.Fatalf("expect connect fail for closed client, got %v", err)
+	}
+	if _, ok := client.JobInfos["2"]; ok {
+		t.Error("job info should be removed when frame not sent")
+	}
+}
@@ -1,10 +1,20 @@
 package binance
 
 import (
+	"github.com/banbox/banexg/base"
 	"github.com/banbox/banexg/log"
 	"github.com/banbox/banexg/utils"
+	"os"
 )
 
+/*
+getBinance
+创建测试用的交易所，local.json中的配置会覆盖参数。
+设置环境变量BANEXG_CASSETTE=record时请求真实接口并录制到testdata/cassette.json，
+设置为replay时从录制文件返回，无需网络和密钥。刷新测试数据：
+
+	BANEXG_CASSETTE=record go test -run "TestLoadMarkets|TestFetchBalances" ./binance
+*/
 func getBinance(param *map[string]interface{}) *Binance {
 	log.SetupByArgs(true, "")
 	args := utils.SafeParams(param)
@@ -13,6 +23,17 @@ func getBinance(param *map[string]interface{}) *Binance {
 	for k, v := range local {
 		args[k] = v
 	}
+	mode := os.Getenv("BANEXG_CASSETTE")
+	if mode != "" {
+		args[base.OptHttpCassette] = "testdata/cassette.json"
+		args[base.OptCassetteMode] = mode
+		_, hasKey := args[base.OptApiKey]
+		_, hasCreds := args[base.OptAccCreds]
+		if !hasKey && !hasCreds && mode == base.CassetteReplay {
+			args[base.OptApiKey] = "fake"
+			args[base.OptApiSecret] = "fake"
+		}
+	}
 	exg, err := New(args)
 	if err != nil {
 		panic(err)
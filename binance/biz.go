@@ -11,10 +11,12 @@ import (
 	"github.com/bytedance/sonic/decoder"
 	"go.uber.org/zap"
 	"maps"
+	"math"
 	"net/http"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var secretApis = map[string]bool{
@@ -35,20 +37,39 @@ func (e *Binance) Init() *errs.Error {
 	if err != nil {
 		return err
 	}
+	if _, ok := e.Options[base.OptPrecisionMode]; !ok {
+		// 币安的tickSize/stepSize如0.5、5无法用小数位数表示，默认按步长精度
+		e.PrecisionMode = base.PrecModeTickSize
+	}
 	utils.SetFieldBy(&e.RecvWindow, e.Options, OptRecvWindow, 10000)
+	utils.SetFieldBy(&e.UseWsApi, e.Options, OptUseWsApi, false)
 	if e.CareMarkets == nil || len(e.CareMarkets) == 0 {
 		e.CareMarkets = DefCareMarkets
 	}
-	e.streamIndex = -1
+	e.streamPools = map[string]*wsStreamPool{}
+	// https://binance-docs.github.io/apidocs/spot/en/#websocket-limits
 	e.streamLimits = map[string]int{
-		base.MarketSpot:    50,
-		base.MarketMargin:  50,
-		base.MarketLinear:  50,
-		base.MarketInverse: 50,
-		base.MarketOption:  50,
+		base.MarketSpot:    1024,
+		base.MarketMargin:  1024,
+		base.MarketLinear:  1024,
+		base.MarketInverse: 1024,
+		base.MarketOption:  1024,
+	}
+	e.subMsgLimits = map[string]int{
+		base.MarketSpot:    5,
+		base.MarketMargin:  5,
+		base.MarketLinear:  10,
+		base.MarketInverse: 10,
+		base.MarketOption:  10,
 	}
-	e.streamBySubHash = map[string]string{}
 	e.wsRequestId = map[string]int{}
+	e.wsApiLogons = map[string]bool{}
+	e.bookSnapStreams = map[string]map[string]bool{}
+	e.userStreams = map[string]*map[string]interface{}{}
+	e.authTimers = map[string]*time.Timer{}
+	e.bookJobs = map[string]*base.WsJobInfo{}
+	e.bookSyncing = map[string]bool{}
+	e.optionChains = map[string]*base.OptionChain{}
 	return nil
 }
 
@@ -109,18 +130,10 @@ func makeSign(e *Binance) base.FuncSign {
 			} else {
 				query = append(query, utils.UrlEncodeMap(extendParams, false))
 			}
-			var sign, method, hash string
+			var sign string
 			var digest = "hex"
 			var secret = creds.Secret
-			if strings.Contains(secret, "PRIVATE KEY") {
-				if len(secret) > 120 {
-					method, hash = "rsa", "sha256"
-				} else {
-					method, hash = "eddsa", "ed25519"
-				}
-			} else {
-				method, hash = "hmac", "sha256"
-			}
+			method, hash := getSignMethod(secret)
 			queryText := strings.Join(query, "&")
 			sign, err = utils.Signature(queryText, secret, method, hash, digest)
 			if err != nil {
@@ -141,6 +154,20 @@ func makeSign(e *Binance) base.FuncSign {
 	}
 }
 
+/*
+getSignMethod
+根据密钥格式返回签名方法和哈希算法：rsa/eddsa/hmac
+*/
+func getSignMethod(secret string) (string, string) {
+	if strings.Contains(secret, "PRIVATE KEY") {
+		if len(secret) > 120 {
+			return "rsa", "sha256"
+		}
+		return "eddsa", "ed25519"
+	}
+	return "hmac", "sha256"
+}
+
 /*
 fetches all available currencies on an exchange
 :see: https://binance-docs.github.io/apidocs/spot/en/#all-coins-39-information-user_data
@@ -259,6 +286,10 @@ func (e *Binance) mapMarket(mar *BnbMarket) *base.Market {
 	isSwap, isFuture, isOption := false, false, false
 	var symParts = strings.Split(mar.Symbol, "-")
 	var baseId = mar.BaseAsset
+	if baseId == "" && mar.Underlying != "" {
+		// 期权没有baseAsset，从BTC-240628-60000-C中获取
+		baseId = symParts[0]
+	}
 	var quoteId = mar.QuoteAsset
 	var baseCode = e.SafeCurrency(baseId).Code
 	var quote = e.SafeCurrency(quoteId).Code
@@ -341,13 +372,8 @@ func (e *Binance) mapMarket(mar *BnbMarket) *base.Market {
 	}
 	strikePrice, _ := strconv.ParseFloat(mar.StrikePrice, 64)
 	prec := mar.GetPrecision()
-	limits, pricePrec, amountPrec := mar.GetMarketLimits()
-	if pricePrec > 0 {
-		prec.Price = pricePrec
-	}
-	if amountPrec > 0 {
-		prec.Amount = amountPrec
-	}
+	limits, priceTick, amountStep := mar.GetMarketLimits()
+	setPrecision(prec, e.PrecisionMode, priceTick, amountStep)
 	var market = base.Market{
 		ID:             mar.Symbol,
 		LowercaseID:    strings.ToLower(mar.Symbol),
@@ -377,6 +403,7 @@ func (e *Binance) mapMarket(mar *BnbMarket) *base.Market {
 		OptionType:     strings.ToLower(mar.Side),
 		Precision:      prec,
 		Limits:         limits,
+		Rules:          mar.GetMarketRules(),
 		Created:        mar.OnboardDate,
 		Info:           mar,
 	}
@@ -430,8 +457,8 @@ func makeFetchMarkets(e *Binance) base.FuncFetchMarkets {
 				log.Error("Unmarshal bnb market fail", zap.String("text", rsp.Content))
 				continue
 			}
-			if res.Symbols != nil {
-				for _, item := range res.Symbols {
+			for _, items := range [][]*BnbMarket{res.Symbols, res.OptionSymbols} {
+				for _, item := range items {
 					market := e.mapMarket(item)
 					result[market.Symbol] = market
 				}
@@ -441,6 +468,26 @@ func makeFetchMarkets(e *Binance) base.FuncFetchMarkets {
 	}
 }
 
+/*
+decodeMarketInfo
+从缓存读取的Market.Info是map，转为*BnbMarket
+*/
+func decodeMarketInfo(m *base.Market) {
+	if _, ok := m.Info.(*BnbMarket); ok || m.Info == nil {
+		return
+	}
+	data, err := sonic.Marshal(m.Info)
+	if err != nil {
+		return
+	}
+	var info BnbMarket
+	if err = sonic.Unmarshal(data, &info); err != nil {
+		log.Warn("decode cached market info fail", zap.String("symbol", m.Symbol), zap.Error(err))
+		return
+	}
+	m.Info = &info
+}
+
 func parseOptionOhlcv(rsp *base.HttpRes) ([]*base.Kline, *errs.Error) {
 	var klines = make([]*BnbOptionKline, 0)
 	err := sonic.UnmarshalString(rsp.Content, &klines)
@@ -448,12 +495,16 @@ func parseOptionOhlcv(rsp *base.HttpRes) ([]*base.Kline, *errs.Error) {
 		return nil, errs.NewMsg(errs.CodeUnmarshalFail, "decode option kline fail %v", err)
 	}
 	var res = make([]*base.Kline, len(klines))
+	nowMS := time.Now().UnixMilli()
 	for i, bar := range klines {
 		open, _ := strconv.ParseFloat(bar.Open, 64)
 		high, _ := strconv.ParseFloat(bar.High, 64)
 		low, _ := strconv.ParseFloat(bar.Low, 64)
 		closeP, _ := strconv.ParseFloat(bar.Close, 64)
 		volume, _ := strconv.ParseFloat(bar.Amount, 64)
+		quoteVol, _ := strconv.ParseFloat(bar.Volume, 64)
+		takerVol, _ := strconv.ParseFloat(bar.TakerAmount, 64)
+		takerQuote, _ := strconv.ParseFloat(bar.TakerVolume, 64)
 		res[i] = &base.Kline{
 			Time:   bar.OpenTime,
 			Open:   open,
@@ -461,12 +512,37 @@ func parseOptionOhlcv(rsp *base.HttpRes) ([]*base.Kline, *errs.Error) {
 			Low:    low,
 			Close:  closeP,
 			Volume: volume,
+
+			Closed:              bar.CloseTime < nowMS,
+			QuoteVolume:         quoteVol,
+			TradeCount:          int64(bar.TradeCount),
+			TakerBuyVolume:      takerVol,
+			TakerBuyQuoteVolume: takerQuote,
 		}
 	}
 	return res, nil
 }
 
-func parseBnbOhlcv(rsp *base.HttpRes, volIndex int) ([]*base.Kline, *errs.Error) {
+/*
+anyToInt64
+sonic不支持当前go版本时会回退到标准库解析，UseInt64可能无效，整数被解析为float64
+*/
+func anyToInt64(val interface{}) int64 {
+	switch v := val.(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	default:
+		return 0
+	}
+}
+
+/*
+parseBnbOhlcv
+volIndex为7时是币本位合约，contSize为合约面值，用于将张数换算为成交额
+*/
+func parseBnbOhlcv(rsp *base.HttpRes, volIndex int, contSize float64) ([]*base.Kline, *errs.Error) {
 	var klines = make([][]interface{}, 0)
 	dc := decoder.NewDecoder(rsp.Content)
 	dc.UseInt64()
@@ -476,10 +552,11 @@ func parseBnbOhlcv(rsp *base.HttpRes, volIndex int) ([]*base.Kline, *errs.Error)
 		return nil, errs.NewMsg(errs.CodeUnmarshalFail, "parse bnb ohlcv fail: %v", err)
 	}
 	var res = make([]*base.Kline, len(klines))
+	nowMS := time.Now().UnixMilli()
 	v := reflect.TypeOf(klines[0][0])
 	log.Info("time format", zap.String("type", v.Name()))
 	for i, bar := range klines {
-		barTime, _ := bar[0].(int64)
+		barTime := anyToInt64(bar[0])
 		openStr, _ := bar[1].(string)
 		highStr, _ := bar[2].(string)
 		lowStr, _ := bar[3].(string)
@@ -491,7 +568,7 @@ func parseBnbOhlcv(rsp *base.HttpRes, volIndex int) ([]*base.Kline, *errs.Error)
 		low, _ := strconv.ParseFloat(lowStr, 64)
 		closeP, _ := strconv.ParseFloat(closeStr, 64)
 		volume, _ := strconv.ParseFloat(volStr, 64)
-		res[i] = &base.Kline{
+		kline := &base.Kline{
 			Time:   int64(barTime),
 			Open:   open,
 			High:   high,
@@ -499,6 +576,30 @@ func parseBnbOhlcv(rsp *base.HttpRes, volIndex int) ([]*base.Kline, *errs.Error)
 			Close:  closeP,
 			Volume: volume,
 		}
+		if len(bar) > 10 {
+			// [openTime, o, h, l, c, v, closeTime, quoteVolume, tradeCount, takerBuyVol, takerBuyQuoteVol]
+			// 币本位合约的5和9是张数，7和10是币数，此时volIndex=7，成交额为张数*合约面值
+			quoteIdx, takerIdx, takerQuoteIdx := 7, 9, 10
+			if volIndex == 7 {
+				quoteIdx, takerIdx, takerQuoteIdx = 5, 10, 9
+			}
+			closeTime := anyToInt64(bar[6])
+			tradeNum := anyToInt64(bar[8])
+			quoteStr, _ := bar[quoteIdx].(string)
+			takerStr, _ := bar[takerIdx].(string)
+			takerQuoteStr, _ := bar[takerQuoteIdx].(string)
+			kline.Closed = closeTime < nowMS
+			kline.TradeCount = tradeNum
+			kline.QuoteVolume, _ = strconv.ParseFloat(quoteStr, 64)
+			kline.TakerBuyVolume, _ = strconv.ParseFloat(takerStr, 64)
+			kline.TakerBuyQuoteVolume, _ = strconv.ParseFloat(takerQuoteStr, 64)
+			if volIndex == 7 {
+				kline.ContractVolume = kline.QuoteVolume
+				kline.QuoteVolume *= contSize
+				kline.TakerBuyQuoteVolume *= contSize
+			}
+		}
+		res[i] = kline
 	}
 	return res, nil
 }
@@ -593,7 +694,7 @@ func (e *Binance) FetchOhlcv(symbol, timeframe string, since int64, limit int, p
 		if market.Inverse {
 			volIndex = 7
 		}
-		return parseBnbOhlcv(rsp, volIndex)
+		return parseBnbOhlcv(rsp, volIndex, market.ContractSize)
 	}
 }
 
@@ -606,6 +707,9 @@ set the level of leverage for a market
 	:param float leverage: the rate of leverage
 	:param str symbol: unified market symbol
 	:param dict [params]: extra parameters specific to the exchange API endpoint
+	:param str [params.leverageCheck]: ValidateCheck/ValidateAdjust 超过持仓所在杠杆层级的最大杠杆时，拒绝或降到最大杠杆
+	:param float [params.notional]: 持仓名义价值，检查杠杆时未传入则通过FetchPositions获取
+	:param str [params.positionSide]: long/short 获取持仓时只计算此方向，默认取名义价值较大的一侧
 	:returns dict: response from the exchange
 */
 func (e *Binance) SetLeverage(leverage int, symbol string, params *map[string]interface{}) (map[string]interface{}, *errs.Error) {
@@ -619,6 +723,19 @@ func (e *Binance) SetLeverage(leverage int, symbol string, params *map[string]in
 	if err != nil {
 		return nil, err
 	}
+	lvgCheck := utils.PopMapVal(args, base.ParamLeverageCheck, "")
+	posSide := strings.ToLower(utils.PopMapVal(args, base.ParamPositionSide, ""))
+	notional := float64(-1)
+	if _, ok := args[base.ParamNotional]; ok {
+		notional = utils.GetMapFloat(args, base.ParamNotional)
+		delete(args, base.ParamNotional)
+	}
+	if lvgCheck != "" && (market.Linear || market.Inverse) {
+		leverage, err = e.checkLeverage(market, leverage, lvgCheck, posSide, notional)
+		if err != nil {
+			return nil, err
+		}
+	}
 	var method string
 	if market.Linear {
 		method = "fapiPrivatePostLeverage"
@@ -642,8 +759,53 @@ func (e *Binance) SetLeverage(leverage int, symbol string, params *map[string]in
 	return res, nil
 }
 
+/*
+checkLeverage
+按持仓名义价值所在的杠杆层级检查杠杆，mode为ValidateAdjust时降到该层的最大杠杆，否则返回错误。
+notional小于0时通过FetchPositions获取当前持仓的名义价值：posSide为空时取双向持仓中较大的一侧，否则取posSide一侧
+*/
+func (e *Binance) checkLeverage(market *base.Market, leverage int, mode, posSide string, notional float64) (int, *errs.Error) {
+	if _, ok := e.LeverageTiers[market.Symbol]; !ok {
+		_, err := e.FetchLeverageTiers([]string{market.Symbol}, nil)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if notional < 0 {
+		posList, err := e.FetchPositions([]string{market.Symbol}, nil)
+		if err != nil {
+			return 0, err
+		}
+		sides := make(map[string]float64)
+		for _, pos := range posList {
+			if pos.Symbol == market.Symbol {
+				sides[pos.Side] += math.Abs(pos.Notional)
+			}
+		}
+		notional = 0
+		if posSide != "" {
+			notional = sides[posSide]
+		} else {
+			for _, val := range sides {
+				notional = max(notional, val)
+			}
+		}
+	}
+	maxLvg := e.GetMaxLeverage(market.Symbol, notional)
+	if maxLvg <= 0 || leverage <= maxLvg {
+		return leverage, nil
+	}
+	if mode != base.ValidateAdjust {
+		return 0, errs.NewMsg(errs.CodeParamInvalid, "leverage %v exceeds max %v of %s for notional %v",
+			leverage, maxLvg, market.Symbol, notional)
+	}
+	log.Info("clamp leverage by tier", zap.String("symbol", market.Symbol), zap.Int("leverage", leverage),
+		zap.Int("max", maxLvg), zap.Float64("notional", notional))
+	return maxLvg, nil
+}
+
 func (e *Binance) LoadLeverageBrackets(reload bool, params *map[string]interface{}) *errs.Error {
-	if len(e.LeverageBrackets) > 0 && !reload {
+	if len(e.LeverageBrackets) > 0 && len(e.LeverageTiers) > 0 && !reload {
 		return nil
 	}
 	args := utils.SafeParams(params)
@@ -651,38 +813,75 @@ func (e *Binance) LoadLeverageBrackets(reload bool, params *map[string]interface
 	if err != nil {
 		return err
 	}
+	brackets, tiers, err := e.fetchLvgBrackets(marketType, args)
+	if err != nil {
+		return err
+	}
+	e.LeverageBrackets = brackets
+	e.LeverageTiers = tiers
+	e.SaveMarketCache()
+	return nil
+}
+
+/*
+FetchLeverageTiers
+获取合约的完整杠杆分层，包括每层的最大杠杆、名义价值上下限、维持保证金率和速算数。
+同时更新LeverageBrackets和LeverageTiers，symbols为空时返回所有交易对
+
+	:see: https://binance-docs.github.io/apidocs/futures/en/#notional-and-leverage-brackets-user_data
+	:see: https://binance-docs.github.io/apidocs/delivery/en/#notional-bracket-for-symbol-user_data
+	:param []string symbols: unified market symbols, must be the same market type
+	:param dict [params]: extra parameters specific to the exchange API endpoint
+*/
+func (e *Binance) FetchLeverageTiers(symbols []string, params *map[string]interface{}) (map[string][]*base.LeverageTier, *errs.Error) {
+	args := utils.SafeParams(params)
+	marketType, _, err := e.LoadArgsMarketType(args, symbols...)
+	if err != nil {
+		return nil, err
+	}
+	brackets, tiers, err := e.fetchLvgBrackets(marketType, args)
+	if err != nil {
+		return nil, err
+	}
+	if e.LeverageBrackets == nil {
+		e.LeverageBrackets = make(map[string][][2]float64)
+	}
+	if e.LeverageTiers == nil {
+		e.LeverageTiers = make(map[string][]*base.LeverageTier)
+	}
+	maps.Copy(e.LeverageBrackets, brackets)
+	maps.Copy(e.LeverageTiers, tiers)
+	e.SaveMarketCache()
+	if len(symbols) == 0 {
+		return tiers, nil
+	}
+	var res = make(map[string][]*base.LeverageTier)
+	for _, symbol := range symbols {
+		if items, ok := tiers[symbol]; ok {
+			res[symbol] = items
+		}
+	}
+	return res, nil
+}
+
+func (e *Binance) fetchLvgBrackets(marketType string, args map[string]interface{}) (map[string][][2]float64, map[string][]*base.LeverageTier, *errs.Error) {
 	var method string
 	if marketType == base.MarketLinear {
 		method = "fapiPrivateGetLeverageBracket"
 	} else if marketType == base.MarketInverse {
 		method = "dapiPrivateV2GetLeverageBracket"
 	} else {
-		return errs.NewMsg(errs.CodeUnsupportMarket, "LoadLeverageBrackets support linear/inverse contracts only")
+		return nil, nil, errs.NewMsg(errs.CodeUnsupportMarket, "LoadLeverageBrackets support linear/inverse contracts only")
 	}
 	retryNum := e.GetRetryNum("LoadLeverageBrackets", 1)
 	rsp := e.RequestApiRetry(context.Background(), method, &args, retryNum)
 	if rsp.Error != nil {
-		return rsp.Error
-	}
-	var res = make([]LinearSymbolLvgBrackets, 0)
-	err2 := sonic.UnmarshalString(rsp.Content, &res)
-	if err2 != nil {
-		return errs.New(errs.CodeUnmarshalFail, err2)
+		return nil, nil, rsp.Error
 	}
-	mapSymbol := func(id string) string {
-		return e.SafeSymbol(id, "", marketType)
-	}
-	var brackets map[string][][2]float64
 	if marketType == base.MarketLinear {
-		brackets, err = parseLvgBrackets[*LinearSymbolLvgBrackets](mapSymbol, rsp)
-	} else {
-		brackets, err = parseLvgBrackets[*InversePairLvgBrackets](mapSymbol, rsp)
-	}
-	if err != nil {
-		return err
+		return parseLvgBrackets[*LinearSymbolLvgBrackets](e, marketType, rsp)
 	}
-	e.LeverageBrackets = brackets
-	return nil
+	return parseLvgBrackets[*InversePairLvgBrackets](e, marketType, rsp)
 }
 
 /*
@@ -703,16 +902,27 @@ func (e *Binance) GetMaintMarginPct(symbol string, notional float64) float64 {
 	return maintMarginPct
 }
 
-func parseLvgBrackets[T ISymbolLvgBracket](mapSymbol func(string) string, rsp *base.HttpRes) (map[string][][2]float64, *errs.Error) {
+func parseLvgBrackets[T ISymbolLvgBracket](e *Binance, marketType string, rsp *base.HttpRes) (map[string][][2]float64, map[string][]*base.LeverageTier, *errs.Error) {
 	var data = make([]T, 0)
 	err := sonic.UnmarshalString(rsp.Content, &data)
 	if err != nil {
-		return nil, errs.New(errs.CodeUnmarshalFail, err)
+		return nil, nil, errs.New(errs.CodeUnmarshalFail, err)
 	}
 	var res = make(map[string][][2]float64)
+	var tiers = make(map[string][]*base.LeverageTier)
 	for _, item := range data {
-		symbol := mapSymbol(item.GetSymbol())
+		symbol := e.SafeSymbol(item.GetSymbol(), "", marketType)
 		res[symbol] = item.ToStdBracket()
+		currency := ""
+		if mar, ok := e.Markets[symbol]; ok {
+			// 币本位合约按基础币数量分层
+			if mar.Inverse {
+				currency = mar.Base
+			} else {
+				currency = mar.Quote
+			}
+		}
+		tiers[symbol] = item.ToStdTiers(symbol, currency)
 	}
-	return res, nil
+	return res, tiers, nil
 }
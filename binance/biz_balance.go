@@ -6,6 +6,7 @@ import (
 	"github.com/banbox/banexg/errs"
 	"github.com/banbox/banexg/utils"
 	"github.com/bytedance/sonic"
+	"github.com/shopspring/decimal"
 	"math"
 	"strconv"
 	"strings"
@@ -73,15 +74,15 @@ func (e *Binance) FetchBalance(params *map[string]interface{}) (*base.Balances,
 	}
 	switch method {
 	case "privateGetAccount":
-		return parseSpotBalances(getCurrCode, rsp)
+		return parseSpotBalances(getCurrCode, rsp, e.DecimalMode)
 	case "sapiGetMarginAccount":
-		return parseMarginCrossBalances(getCurrCode, rsp)
+		return parseMarginCrossBalances(getCurrCode, rsp, e.DecimalMode)
 	case "sapiGetMarginIsolatedAccount":
 		return parseMarginIsolatedBalances(e, rsp)
 	case "fapiPrivateV2GetAccount":
-		return parseLinearBalances(getCurrCode, rsp)
+		return parseLinearBalances(getCurrCode, rsp, e.DecimalMode)
 	case "dapiPrivateGetAccount":
-		return parseInverseBalances(getCurrCode, rsp)
+		return parseInverseBalances(getCurrCode, rsp, e.DecimalMode)
 	case "sapiPostAssetGetFundingAsset":
 		return parseFundingBalances(e, rsp)
 	default:
@@ -258,6 +259,16 @@ func parseAccountPosition(e *Binance, p *FuturePosition, a *FutureAsset, market
 	}
 	res.MarginMode = marginMode
 	res.Collateral = collateral
+	if e.DecimalMode {
+		dec := p.BaseContPosition.ToDecPos()
+		dec.Notional = base.ParseDec(notional).Abs()
+		if p.Isolated {
+			dec.Collateral = base.ParseDec(p.IsolatedWallet).Add(dec.UnrealizedPnl)
+		} else {
+			dec.Collateral = base.ParseDec(a.CrossWalletBalance).Add(base.ParseDec(a.CrossUnPnl))
+		}
+		res.Dec = dec
+	}
 	// 计算marginRatio
 	marginRatio, _ := utils.PrecFloat64(maintMargin/collateral, 4, true)
 	res.MarginRatio = marginRatio
@@ -280,7 +291,7 @@ func parseAccountPosition(e *Binance, p *FuturePosition, a *FutureAsset, market
 		}
 		leftSide := walletBalance / (res.Contracts * revtMaintMarginPct)
 		rightSide := entryPriceSign / revtMaintMarginPct
-		liquidationPrice, _ := utils.PrecFloat64(leftSide+rightSide, market.Precision.Price, true)
+		liquidationPrice, _ := e.PrecNumFloat(leftSide+rightSide, market.Precision.Price, base.RoundNearest)
 		res.LiquidationPrice = liquidationPrice
 	} else {
 		// liquidationPrice = (contracts * contractSize(±1 - mmp)) / (±1/entryPrice * contracts * contractSize - walletBalance)
@@ -293,7 +304,7 @@ func parseAccountPosition(e *Binance, p *FuturePosition, a *FutureAsset, market
 		size := res.Contracts * res.ContractSize
 		leftSide := size * revtMaintMarginPct
 		rightSide := size/entryPriceSign - walletBalance
-		liquidationPrice, _ := utils.PrecFloat64(leftSide/rightSide, market.Precision.Price, true)
+		liquidationPrice, _ := e.PrecNumFloat(leftSide/rightSide, market.Precision.Price, base.RoundNearest)
 		res.LiquidationPrice = liquidationPrice
 	}
 	res.Hedged = res.Side != base.PosSideBoth
@@ -365,6 +376,14 @@ func (p *BaseContPosition) ToStdPos() *base.Position {
 	return &pos
 }
 
+func (p *BaseContPosition) ToDecPos() *base.PosDec {
+	return &base.PosDec{
+		Contracts:     base.ParseDec(p.PositionAmt).Abs(),
+		EntryPrice:    base.ParseDec(p.EntryPrice),
+		UnrealizedPnl: base.ParseDec(p.UnRealizedProfit),
+	}
+}
+
 func (p *ContPositionRisk) ToStdPos() *base.Position {
 	var res = p.BaseContPosition.ToStdPos()
 	if res == nil {
@@ -378,6 +397,13 @@ func (p *ContPositionRisk) ToStdPos() *base.Position {
 	return res
 }
 
+func (p *ContPositionRisk) ToDecPos() *base.PosDec {
+	var res = p.BaseContPosition.ToDecPos()
+	res.LiquidationPrice = base.ParseDec(p.LiquidationPrice)
+	res.MarkPrice = base.ParseDec(p.MarkPrice)
+	return res
+}
+
 func (p *LinearPositionRisk) ToStdPos(e *Binance) (*base.Position, *errs.Error) {
 	var res = p.ContPositionRisk.ToStdPos()
 	if res == nil {
@@ -388,6 +414,10 @@ func (p *LinearPositionRisk) ToStdPos(e *Binance) (*base.Position, *errs.Error)
 	notional, _ := strconv.ParseFloat(p.Notional, 64)
 	res.Notional = notional
 	res.Info = p
+	if e.DecimalMode {
+		res.Dec = p.ContPositionRisk.ToDecPos()
+		res.Dec.Notional = base.ParseDec(p.Notional).Abs()
+	}
 	market := e.GetMarketById(p.Symbol, base.MarketLinear)
 	if market == nil {
 		return nil, errs.NewMsg(errs.CodeNoMarketForPair, "no market for %s, total %d", p.Symbol, len(e.Markets))
@@ -405,6 +435,10 @@ func (p *InversePositionRisk) ToStdPos(e *Binance) (*base.Position, *errs.Error)
 	notional, _ := strconv.ParseFloat(p.NotionalValue, 64)
 	res.Notional = notional
 	res.Info = p
+	if e.DecimalMode {
+		res.Dec = p.ContPositionRisk.ToDecPos()
+		res.Dec.Notional = base.ParseDec(p.NotionalValue).Abs()
+	}
 	market := e.GetMarketById(p.Symbol, base.MarketInverse)
 	if market == nil {
 		return nil, errs.NewMsg(errs.CodeNoMarketForPair, "no market for %s, total %d", p.Symbol, len(e.Markets))
@@ -435,7 +469,7 @@ func calcPositionRisk(res *base.Position, e *Binance, market *base.Market, isola
 		} else {
 			revMaintPct = -1.0 + maintMarginPct*mmpSign
 		}
-		var prec int
+		var prec float64
 		if market.Type == base.MarketLinear {
 			// walletBalance = (liquidationPrice * (±1 + mmp) ± entryPrice) * contracts
 			leftSide := res.LiquidationPrice*revMaintPct + entryPriceSign
@@ -454,10 +488,10 @@ func calcPositionRisk(res *base.Position, e *Binance, market *base.Market, isola
 			collateral = leftSide * rightSide
 		}
 		if prec != 0 {
-			var err error
-			collateral, err = utils.PrecFloat64(collateral, prec, false)
+			var err *errs.Error
+			collateral, err = e.PrecNumFloat(collateral, prec, base.RoundDown)
 			if err != nil {
-				return nil, errs.New(errs.CodePrecDecFail, err)
+				return nil, err
 			}
 		}
 	} else {
@@ -469,6 +503,13 @@ func calcPositionRisk(res *base.Position, e *Binance, market *base.Market, isola
 	marginRatio, _ := utils.PrecFloat64(maintMargin/collateral, 4, true)
 	percentage, _ := utils.PrecFloat64(res.UnrealizedPnl*100/initMargin, 2, true)
 	res.Collateral = collateral
+	if res.Dec != nil {
+		if res.MarginMode == base.MarginCross {
+			res.Dec.Collateral = decimal.NewFromFloat(collateral)
+		} else {
+			res.Dec.Collateral = base.ParseDec(isolatedMarginStr)
+		}
+	}
 	res.Hedged = res.Side != base.PosSideBoth
 	res.Notional = notional
 	res.InitialMargin = initMargin
@@ -492,7 +533,7 @@ func unmarshalBalance(content string, data interface{}) (*base.Balances, *errs.E
 	return &result, nil
 }
 
-func parseSpotBalances(getCurrCode func(string) string, rsp *base.HttpRes) (*base.Balances, *errs.Error) {
+func parseSpotBalances(getCurrCode func(string) string, rsp *base.HttpRes, exact bool) (*base.Balances, *errs.Error) {
 	var data = SpotAccount{}
 	result, err := unmarshalBalance(rsp.Content, &data)
 	if err != nil {
@@ -501,6 +542,9 @@ func parseSpotBalances(getCurrCode func(string) string, rsp *base.HttpRes) (*bas
 	result.TimeStamp = data.UpdateTime
 	for _, item := range data.Balances {
 		asset := item.ToStdAsset(getCurrCode)
+		if exact {
+			asset.Dec = item.ToDecAsset()
+		}
 		if asset.IsEmpty() {
 			continue
 		}
@@ -509,7 +553,7 @@ func parseSpotBalances(getCurrCode func(string) string, rsp *base.HttpRes) (*bas
 	return result.Init(), nil
 }
 
-func parseMarginCrossBalances(getCurrCode func(string) string, rsp *base.HttpRes) (*base.Balances, *errs.Error) {
+func parseMarginCrossBalances(getCurrCode func(string) string, rsp *base.HttpRes, exact bool) (*base.Balances, *errs.Error) {
 	var data = MarginCrossBalances{}
 	result, err := unmarshalBalance(rsp.Content, &data)
 	if err != nil {
@@ -517,6 +561,9 @@ func parseMarginCrossBalances(getCurrCode func(string) string, rsp *base.HttpRes
 	}
 	for _, item := range data.UserAssets {
 		asset := item.ToStdAsset(getCurrCode)
+		if exact {
+			asset.Dec = item.ToDecAsset()
+		}
 		if asset.IsEmpty() {
 			continue
 		}
@@ -539,6 +586,9 @@ func parseMarginIsolatedBalances(e *Binance, rsp *base.HttpRes) (*base.Balances,
 		itemRes := make(map[string]*base.Asset)
 		if item.BaseAsset != nil {
 			asset := item.BaseAsset.ToStdAsset(getCurrCode)
+			if e.DecimalMode {
+				asset.Dec = item.BaseAsset.ToDecAsset()
+			}
 			if asset.IsEmpty() {
 				continue
 			}
@@ -546,6 +596,9 @@ func parseMarginIsolatedBalances(e *Binance, rsp *base.HttpRes) (*base.Balances,
 		}
 		if item.QuoteAsset != nil {
 			asset := item.QuoteAsset.ToStdAsset(getCurrCode)
+			if e.DecimalMode {
+				asset.Dec = item.QuoteAsset.ToDecAsset()
+			}
 			if asset.IsEmpty() {
 				continue
 			}
@@ -556,7 +609,7 @@ func parseMarginIsolatedBalances(e *Binance, rsp *base.HttpRes) (*base.Balances,
 	return result.Init(), nil
 }
 
-func parseLinearBalances(getCurrCode func(string) string, rsp *base.HttpRes) (*base.Balances, *errs.Error) {
+func parseLinearBalances(getCurrCode func(string) string, rsp *base.HttpRes, exact bool) (*base.Balances, *errs.Error) {
 	var data = LinearBalances{}
 	result, err := unmarshalBalance(rsp.Content, &data)
 	if err != nil {
@@ -564,6 +617,9 @@ func parseLinearBalances(getCurrCode func(string) string, rsp *base.HttpRes) (*b
 	}
 	for _, item := range data.Assets {
 		asset := item.ToStdAsset(getCurrCode)
+		if exact {
+			asset.Dec = item.ToDecAsset()
+		}
 		if asset.IsEmpty() {
 			continue
 		}
@@ -572,7 +628,7 @@ func parseLinearBalances(getCurrCode func(string) string, rsp *base.HttpRes) (*b
 	return result.Init(), nil
 }
 
-func parseInverseBalances(getCurrCode func(string) string, rsp *base.HttpRes) (*base.Balances, *errs.Error) {
+func parseInverseBalances(getCurrCode func(string) string, rsp *base.HttpRes, exact bool) (*base.Balances, *errs.Error) {
 	var data = InverseBalances{}
 	result, err := unmarshalBalance(rsp.Content, &data)
 	if err != nil {
@@ -580,6 +636,9 @@ func parseInverseBalances(getCurrCode func(string) string, rsp *base.HttpRes) (*
 	}
 	for _, item := range data.Assets {
 		asset := item.ToStdAsset(getCurrCode)
+		if exact {
+			asset.Dec = item.ToDecAsset()
+		}
 		if asset.IsEmpty() {
 			continue
 		}
@@ -605,6 +664,10 @@ func parseFundingBalances(e *Binance, rsp *base.HttpRes) (*base.Balances, *errs.
 			Free: free,
 			Used: freeze + withdraw + lock,
 		}
+		if e.DecimalMode {
+			used := base.ParseDec(item.Freeze).Add(base.ParseDec(item.Withdrawing)).Add(base.ParseDec(item.Locked))
+			asset.Dec = &base.AssetDec{Free: base.ParseDec(item.Free), Used: used}
+		}
 		if asset.IsEmpty() {
 			continue
 		}
@@ -628,6 +691,16 @@ func (a SpotAsset) ToStdAsset(getCurrCode func(string) string) *base.Asset {
 	}
 }
 
+func (a SpotAsset) ToDecAsset() *base.AssetDec {
+	free, lock := base.ParseDec(a.Free), base.ParseDec(a.Locked)
+	return &base.AssetDec{
+		Free:  free,
+		Used:  lock,
+		Total: free.Add(lock),
+		Debt:  base.ParseDec(a.Borrowed).Add(base.ParseDec(a.Interest)),
+	}
+}
+
 func (a *FutureAsset) ToStdAsset(getCurrCode func(string) string) *base.Asset {
 	code := getCurrCode(a.Asset)
 	free, _ := strconv.ParseFloat(a.AvailableBalance, 64)
@@ -640,3 +713,11 @@ func (a *FutureAsset) ToStdAsset(getCurrCode func(string) string) *base.Asset {
 		Total: total,
 	}
 }
+
+func (a *FutureAsset) ToDecAsset() *base.AssetDec {
+	return &base.AssetDec{
+		Free:  base.ParseDec(a.AvailableBalance),
+		Used:  base.ParseDec(a.InitialMargin),
+		Total: base.ParseDec(a.MarginBalance),
+	}
+}
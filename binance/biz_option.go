@@ -0,0 +1,85 @@
+package binance
+
+import (
+	"context"
+	"github.com/banbox/banexg/base"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/utils"
+	"github.com/bytedance/sonic"
+	"strconv"
+	"strings"
+)
+
+/*
+FetchOptionChain
+获取标的资产的期权链，包含标记价格、隐含波动率和希腊值。需在CareMarkets中加入option
+
+	:see: https://binance-docs.github.io/apidocs/voptions/en/#option-mark-price
+	:param string underlying: 标的资产，如BTC，或BTC/USDT
+	:param dict [params]: extra parameters specific to the exchange API endpoint
+*/
+func (e *Binance) FetchOptionChain(underlying string, params *map[string]interface{}) (*base.OptionChain, *errs.Error) {
+	_, err := e.LoadMarkets(false, nil)
+	if err != nil {
+		return nil, err
+	}
+	markets, err := e.getOptionMarkets(underlying)
+	if err != nil {
+		return nil, err
+	}
+	chain := base.NewOptionChain(underlying, markets)
+	args := utils.SafeParams(params)
+	tryNum := e.GetRetryNum("FetchOptionChain", 1)
+	rsp := e.RequestApiRetry(context.Background(), "eapiPublicGetMark", &args, tryNum)
+	if rsp.Error != nil {
+		return nil, rsp.Error
+	}
+	var data = make([]*OptionMark, 0)
+	err2 := sonic.UnmarshalString(rsp.Content, &data)
+	if err2 != nil {
+		return nil, errs.New(errs.CodeUnmarshalFail, err2)
+	}
+	stamp := e.MilliSeconds()
+	for _, item := range data {
+		symbol := e.SafeSymbol(item.Symbol, "", base.MarketOption)
+		q := chain.Get(symbol)
+		if q == nil {
+			continue
+		}
+		item.setQuote(q)
+		q.Timestamp = stamp
+	}
+	chain.Timestamp = stamp
+	return chain, nil
+}
+
+/*
+getOptionMarkets
+返回标的资产的所有期权市场，underlying为BTC时不限制计价币
+*/
+func (e *Binance) getOptionMarkets(underlying string) ([]*base.Market, *errs.Error) {
+	baseCode, quote := underlying, ""
+	if strings.Contains(underlying, "/") {
+		parts, err := base.ParseSymbol(underlying)
+		if err != nil {
+			return nil, err
+		}
+		baseCode, quote = parts.Base, parts.Quote
+	}
+	markets := e.FindMarkets(baseCode, quote, base.MarketOption)
+	if len(markets) == 0 {
+		return nil, errs.NewMsg(errs.CodeNoMarketForPair, "no option markets for %s", underlying)
+	}
+	return markets, nil
+}
+
+func (m *OptionMark) setQuote(q *base.OptionQuote) {
+	q.MarkPrice, _ = strconv.ParseFloat(m.MarkPrice, 64)
+	q.BidIV, _ = strconv.ParseFloat(m.BidIV, 64)
+	q.AskIV, _ = strconv.ParseFloat(m.AskIV, 64)
+	q.MarkIV, _ = strconv.ParseFloat(m.MarkIV, 64)
+	q.Delta, _ = strconv.ParseFloat(m.Delta, 64)
+	q.Gamma, _ = strconv.ParseFloat(m.Gamma, 64)
+	q.Theta, _ = strconv.ParseFloat(m.Theta, 64)
+	q.Vega, _ = strconv.ParseFloat(m.Vega, 64)
+}
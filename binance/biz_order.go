@@ -54,15 +54,15 @@ func (e *Binance) FetchOrders(symbol string, since int64, limit int, params *map
 	}
 	switch method {
 	case "privateGetAllOrders":
-		return parseOrders[*SpotOrder](mapSymbol, rsp)
+		return parseOrders[*SpotOrder](mapSymbol, rsp, e.DecimalMode)
 	case "eapiPrivateGetHistoryOrders":
-		return parseOrders[*OptionOrder](mapSymbol, rsp)
+		return parseOrders[*OptionOrder](mapSymbol, rsp, e.DecimalMode)
 	case "fapiPrivateGetAllOrders":
-		return parseOrders[*FutureOrder](mapSymbol, rsp)
+		return parseOrders[*FutureOrder](mapSymbol, rsp, e.DecimalMode)
 	case "dapiPrivateGetAllOrders":
-		return parseOrders[*InverseOrder](mapSymbol, rsp)
+		return parseOrders[*InverseOrder](mapSymbol, rsp, e.DecimalMode)
 	case "sapiGetMarginAllOrders":
-		return parseOrders[*MarginOrder](mapSymbol, rsp)
+		return parseOrders[*MarginOrder](mapSymbol, rsp, e.DecimalMode)
 	default:
 		return nil, errs.NewMsg(errs.CodeNotSupport, "not support order method %s", method)
 	}
@@ -127,7 +127,7 @@ func (e *Binance) FetchOpenOrders(symbol string, since int64, limit int, params
 		}
 	}
 	tryNum := e.GetRetryNum("FetchOpenOrders", 1)
-	rsp := e.RequestApiRetry(context.Background(), method, &args, tryNum)
+	rsp := e.requestRetry(context.Background(), method, &args, tryNum)
 	if rsp.Error != nil {
 		return nil, rsp.Error
 	}
@@ -142,20 +142,87 @@ func (e *Binance) FetchOpenOrders(symbol string, since int64, limit int, params
 	}
 	switch method {
 	case "privateGetOpenOrders":
-		return parseOrders[*SpotOrder](mapSymbol, rsp)
+		return parseOrders[*SpotOrder](mapSymbol, rsp, e.DecimalMode)
 	case "eapiPrivateGetOpenOrders":
-		return parseOrders[*OptionOrder](mapSymbol, rsp)
+		return parseOrders[*OptionOrder](mapSymbol, rsp, e.DecimalMode)
 	case "fapiPrivateGetOpenOrders":
-		return parseOrders[*FutureOrder](mapSymbol, rsp)
+		return parseOrders[*FutureOrder](mapSymbol, rsp, e.DecimalMode)
 	case "dapiPrivateGetOpenOrders":
-		return parseOrders[*InverseOrder](mapSymbol, rsp)
+		return parseOrders[*InverseOrder](mapSymbol, rsp, e.DecimalMode)
 	case "sapiGetMarginOpenOrders":
-		return parseOrders[*MarginOrder](mapSymbol, rsp)
+		return parseOrders[*MarginOrder](mapSymbol, rsp, e.DecimalMode)
 	default:
 		return nil, errs.NewMsg(errs.CodeNotSupport, "not support order method %s", method)
 	}
 }
 
+/*
+FetchOrder
+fetches information on an order made by the user
+
+	:see: https://binance-docs.github.io/apidocs/spot/en/#query-order-user_data
+	:see: https://binance-docs.github.io/apidocs/futures/en/#query-order-user_data
+	:see: https://binance-docs.github.io/apidocs/delivery/en/#query-order-user_data
+	:see: https://binance-docs.github.io/apidocs/voptions/en/#query-single-order-trade
+	:see: https://binance-docs.github.io/apidocs/spot/en/#query-margin-account-39-s-order-user_data
+	:param str symbol: unified symbol of the market the order was made in
+	:param str orderId: order id
+	:param dict [params]: extra parameters specific to the exchange API endpoint
+	:param str [params.marginMode]: 'cross' or 'isolated', for spot margin trading
+	:returns dict: An `order structure <https://docs.ccxt.com/#/?id=order-structure>`
+*/
+func (e *Binance) FetchOrder(symbol, orderId string, params *map[string]interface{}) (*base.Order, *errs.Error) {
+	args, market, err := e.LoadArgsMarket(symbol, params)
+	if err != nil {
+		return nil, err
+	}
+	marginMode := utils.PopMapVal(args, base.ParamMarginMode, "")
+	clientOrderId := utils.PopMapVal(args, base.ParamClientOrderId, "")
+	args["symbol"] = market.ID
+	if clientOrderId != "" {
+		if market.Option {
+			args["clientOrderId"] = clientOrderId
+		} else {
+			args["origClientOrderId"] = clientOrderId
+		}
+	} else {
+		args["orderId"] = orderId
+	}
+	method := "privateGetOrder"
+	if market.Option {
+		method = "eapiPrivateGetOrder"
+	} else if market.Linear {
+		method = "fapiPrivateGetOrder"
+	} else if market.Inverse {
+		method = "dapiPrivateGetOrder"
+	} else if market.Type == base.MarketMargin || marginMode != "" {
+		method = "sapiGetMarginOrder"
+		if marginMode == base.MarginIsolated {
+			args["isIsolated"] = true
+		}
+	}
+	tryNum := e.GetRetryNum("FetchOrder", 1)
+	rsp := e.requestRetry(context.Background(), method, &args, tryNum)
+	if rsp.Error != nil {
+		return nil, rsp.Error
+	}
+	var mapSymbol = func(mid string) string {
+		return market.Symbol
+	}
+	switch method {
+	case "fapiPrivateGetOrder":
+		return parseOrder[*FutureOrder](mapSymbol, rsp, e.DecimalMode)
+	case "dapiPrivateGetOrder":
+		return parseOrder[*InverseOrder](mapSymbol, rsp, e.DecimalMode)
+	case "eapiPrivateGetOrder":
+		return parseOrder[*OptionOrder](mapSymbol, rsp, e.DecimalMode)
+	case "sapiGetMarginOrder":
+		return parseOrder[*MarginOrder](mapSymbol, rsp, e.DecimalMode)
+	default:
+		return parseOrder[*SpotOrder](mapSymbol, rsp, e.DecimalMode)
+	}
+}
+
 /*
 CancelOrder
 cancels an open order
@@ -201,7 +268,7 @@ func (e *Binance) CancelOrder(id string, symbol string, params *map[string]inter
 		}
 	}
 	tryNum := e.GetRetryNum("CancelOrder", 1)
-	rsp := e.RequestApiRetry(context.Background(), method, &args, tryNum)
+	rsp := e.requestRetry(context.Background(), method, &args, tryNum)
 	if rsp.Error != nil {
 		return nil, rsp.Error
 	}
@@ -209,18 +276,187 @@ func (e *Binance) CancelOrder(id string, symbol string, params *map[string]inter
 		return market.Symbol
 	}
 	if method == "fapiPrivateDeleteOrder" {
-		return parseOrder[*FutureOrder](mapSymbol, rsp)
+		return parseOrder[*FutureOrder](mapSymbol, rsp, e.DecimalMode)
 	} else if method == "dapiPrivateDeleteOrder" {
-		return parseOrder[*InverseOrder](mapSymbol, rsp)
+		return parseOrder[*InverseOrder](mapSymbol, rsp, e.DecimalMode)
 	} else if method == "eapiPrivateDeleteOrder" {
-		return parseOrder[*OptionOrder](mapSymbol, rsp)
+		return parseOrder[*OptionOrder](mapSymbol, rsp, e.DecimalMode)
 	} else {
 		// spot margin sor
-		return parseOrder[*SpotOrder](mapSymbol, rsp)
+		return parseOrder[*SpotOrder](mapSymbol, rsp, e.DecimalMode)
 	}
 }
 
-func parseOrders[T IBnbOrder](mapSymbol func(string) string, rsp *base.HttpRes) ([]*base.Order, *errs.Error) {
+/*
+FetchMyLiquidations
+retrieves the users liquidated positions
+
+	:see: https://binance-docs.github.io/apidocs/spot/en/#get-force-liquidation-record-user_data
+	:see: https://binance-docs.github.io/apidocs/futures/en/#user-39-s-force-orders-user_data
+	:see: https://binance-docs.github.io/apidocs/delivery/en/#user-39-s-force-orders-user_data
+	:param str [symbol]: unified CCXT market symbol
+	:param int [since]: the earliest time in ms to fetch liquidations for
+	:param int [limit]: the maximum number of liquidation structures to retrieve
+	:param dict [params]: exchange specific parameters for the binance api endpoint
+	:param str [params.marginMode]: 'cross' or 'isolated', for spot margin trading
+	:returns dict: an array of `liquidation structures <https://docs.ccxt.com/#/?id=liquidation-structure>`
+*/
+func (e *Binance) FetchMyLiquidations(symbol string, since int64, limit int, params *map[string]interface{}) ([]*base.Liquidation, *errs.Error) {
+	var args map[string]interface{}
+	var marketType string
+	if symbol != "" {
+		argsIn, market, err := e.LoadArgsMarket(symbol, params)
+		if err != nil {
+			return nil, err
+		}
+		args = argsIn
+		args["symbol"] = market.ID
+		marketType = market.Type
+	} else {
+		_, err := e.LoadMarkets(false, nil)
+		if err != nil {
+			return nil, err
+		}
+		args = utils.SafeParams(params)
+		marketType, _ = e.GetArgsMarketType(args, "")
+	}
+	marginMode := utils.PopMapVal(args, base.ParamMarginMode, "")
+	if since > 0 {
+		args["startTime"] = since
+	}
+	method := "sapiGetMarginForceLiquidationRec"
+	if marketType == base.MarketLinear {
+		method = "fapiPrivateGetForceOrders"
+	} else if marketType == base.MarketInverse {
+		method = "dapiPrivateGetForceOrders"
+	} else if marketType == base.MarketMargin || marginMode != "" {
+		if marginMode == base.MarginIsolated {
+			args["isolatedSymbol"] = utils.PopMapVal(args, "symbol", "")
+		}
+	} else {
+		return nil, errs.NewMsg(errs.CodeUnsupportMarket, "FetchMyLiquidations support margin/linear/inverse, current: %s", marketType)
+	}
+	if method == "sapiGetMarginForceLiquidationRec" {
+		if limit > 0 {
+			args["size"] = limit
+		}
+	} else {
+		if limit > 0 {
+			args["limit"] = limit
+		}
+		if _, ok := args["autoCloseType"]; !ok {
+			args["autoCloseType"] = "LIQUIDATION"
+		}
+	}
+	tryNum := e.GetRetryNum("FetchMyLiquidations", 1)
+	rsp := e.RequestApiRetry(context.Background(), method, &args, tryNum)
+	if rsp.Error != nil {
+		return nil, rsp.Error
+	}
+	var marketMap = make(map[string]*base.Market)
+	var getMarket = func(mid string) *base.Market {
+		if market, ok := marketMap[mid]; ok {
+			return market
+		}
+		market := e.GetMarketById(mid, marketType)
+		marketMap[mid] = market
+		return market
+	}
+	var mapSymbol = func(mid string) string {
+		if market := getMarket(mid); market != nil {
+			return market.Symbol
+		}
+		return mid
+	}
+	if method == "sapiGetMarginForceLiquidationRec" {
+		var data = MarginForceLiquidationRsp{}
+		err := sonic.UnmarshalString(rsp.Content, &data)
+		if err != nil {
+			return nil, errs.New(errs.CodeUnmarshalFail, err)
+		}
+		var result = make([]*base.Liquidation, 0, len(data.Rows))
+		for _, item := range data.Rows {
+			result = append(result, item.ToStdLiquidation(getMarket(item.Symbol)))
+		}
+		return result, nil
+	}
+	var orders []*base.Order
+	var err *errs.Error
+	if method == "fapiPrivateGetForceOrders" {
+		orders, err = parseOrders[*FutureOrder](mapSymbol, rsp, e.DecimalMode)
+	} else {
+		orders, err = parseOrders[*InverseOrder](mapSymbol, rsp, e.DecimalMode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result = make([]*base.Liquidation, 0, len(orders))
+	for _, od := range orders {
+		price := od.Average
+		if price == 0 {
+			price = od.Price
+		}
+		res := &base.Liquidation{
+			Symbol:    od.Symbol,
+			Side:      od.Side,
+			Price:     price,
+			Contracts: od.Filled,
+			Status:    od.Status,
+			Timestamp: od.Timestamp,
+			Datetime:  od.Datetime,
+			Info:      od.Info,
+		}
+		setLiquidationValue(res, e.Markets[od.Symbol])
+		result = append(result, res)
+	}
+	return result, nil
+}
+
+func (o *MarginForceLiquidation) ToStdLiquidation(market *base.Market) *base.Liquidation {
+	price, _ := strconv.ParseFloat(o.AvgPrice, 64)
+	if price == 0 {
+		price, _ = strconv.ParseFloat(o.Price, 64)
+	}
+	filled, _ := strconv.ParseFloat(o.ExecutedQty, 64)
+	symbol := o.Symbol
+	if market != nil {
+		symbol = market.Symbol
+	}
+	res := &base.Liquidation{
+		Symbol:    symbol,
+		Side:      strings.ToLower(o.Side),
+		Price:     price,
+		Contracts: filled,
+		Status:    base.OdStatusClosed,
+		Timestamp: o.UpdatedTime,
+		Datetime:  utils.ISO8601(o.UpdatedTime),
+		Info:      o,
+	}
+	setLiquidationValue(res, market)
+	return res
+}
+
+/*
+setLiquidationValue
+根据成交数量和价格，计算强平的基础币价值和计价币价值
+*/
+func setLiquidationValue(res *base.Liquidation, market *base.Market) {
+	res.ContractSize = 1
+	if market != nil && market.ContractSize > 0 {
+		res.ContractSize = market.ContractSize
+	}
+	if market != nil && market.Inverse {
+		res.QuoteValue = res.Contracts * res.ContractSize
+		if res.Price > 0 {
+			res.BaseValue = res.QuoteValue / res.Price
+		}
+	} else {
+		res.BaseValue = res.Contracts * res.ContractSize
+		res.QuoteValue = res.BaseValue * res.Price
+	}
+}
+
+func parseOrders[T IBnbOrder](mapSymbol func(string) string, rsp *base.HttpRes, exact bool) ([]*base.Order, *errs.Error) {
 	var data = make([]T, 0)
 	err := sonic.UnmarshalString(rsp.Content, &data)
 	if err != nil {
@@ -228,21 +464,35 @@ func parseOrders[T IBnbOrder](mapSymbol func(string) string, rsp *base.HttpRes)
 	}
 	var result = make([]*base.Order, len(data))
 	for i, item := range data {
-		result[i] = item.ToStdOrder(mapSymbol)
+		result[i] = toStdOrder(item, mapSymbol, exact)
 	}
 	return result, nil
 }
 
-func parseOrder[T IBnbOrder](mapSymbol func(string) string, rsp *base.HttpRes) (*base.Order, *errs.Error) {
+func parseOrder[T IBnbOrder](mapSymbol func(string) string, rsp *base.HttpRes, exact bool) (*base.Order, *errs.Error) {
 	var data = new(T)
 	err := sonic.UnmarshalString(rsp.Content, &data)
 	if err != nil {
 		return nil, errs.New(errs.CodeUnmarshalFail, err)
 	}
-	result := (*data).ToStdOrder(mapSymbol)
+	result := toStdOrder(*data, mapSymbol, exact)
 	return result, nil
 }
 
+/*
+toStdOrder
+转为标准订单，exact为true时额外解析decimal精确值
+*/
+func toStdOrder(item IBnbOrder, mapSymbol func(string) string, exact bool) *base.Order {
+	result := item.ToStdOrder(mapSymbol)
+	if exact {
+		dec := item.ToDecOrder()
+		dec.Remaining = dec.Amount.Sub(dec.Filled)
+		result.Dec = dec
+	}
+	return result
+}
+
 var orderStateMap = map[string]string{
 	OdStatusNew:             base.OdStatusOpen,
 	OdStatusPartiallyFilled: base.OdStatusOpen,
@@ -324,6 +574,21 @@ func (o *SpotBase) ToStdOrder(mapSymbol func(string) string) *base.Order {
 	return result
 }
 
+func (o *OrderBase) ToDecOrder() *base.OrderDec {
+	return &base.OrderDec{
+		Price:  base.ParseDec(o.Price),
+		Filled: base.ParseDec(o.ExecutedQty),
+	}
+}
+
+func (o *SpotBase) ToDecOrder() *base.OrderDec {
+	result := o.OrderBase.ToDecOrder()
+	result.TriggerPrice = base.ParseDec(o.StopPrice)
+	result.Amount = base.ParseDec(o.OrigQty)
+	result.Cost = base.ParseDec(o.CummulativeQuoteQty)
+	return result
+}
+
 func (o *SpotOrder) ToStdOrder(mapSymbol func(string) string) *base.Order {
 	result := o.SpotBase.ToStdOrder(mapSymbol)
 	result.Info = o
@@ -354,19 +619,29 @@ func (o *OptionOrder) ToStdOrder(mapSymbol func(string) string) *base.Order {
 		timeStamp = o.UpdateTime
 	}
 	avgPrice, _ := strconv.ParseFloat(o.AvgPrice, 64)
+	amount, _ := strconv.ParseFloat(o.Quantity, 64)
+	fee, _ := strconv.ParseFloat(o.Fee, 64)
 	result := o.OrderBase.ToStdOrder(mapSymbol)
 	result.Info = o
 	result.Timestamp = timeStamp
 	result.Datetime = utils.ISO8601(timeStamp)
 	result.ReduceOnly = o.ReduceOnly
 	result.Average = avgPrice
-	result.Amount = o.Quantity
+	result.Amount = amount
 	result.Fee.Currency = o.QuoteAsset
-	result.Fee.Cost = o.Fee
+	result.Fee.Cost = fee
 	result.PostOnly = o.PostOnly
 	return result
 }
 
+func (o *OptionOrder) ToDecOrder() *base.OrderDec {
+	result := o.OrderBase.ToDecOrder()
+	result.Average = base.ParseDec(o.AvgPrice)
+	result.Amount = base.ParseDec(o.Quantity)
+	result.FeeCost = base.ParseDec(o.Fee)
+	return result
+}
+
 func (o *FutureBase) ToStdOrder(mapSymbol func(string) string) *base.Order {
 	timeStamp := o.Time
 	if timeStamp == 0 {
@@ -385,6 +660,14 @@ func (o *FutureBase) ToStdOrder(mapSymbol func(string) string) *base.Order {
 	return result
 }
 
+func (o *FutureBase) ToDecOrder() *base.OrderDec {
+	result := o.OrderBase.ToDecOrder()
+	result.Average = base.ParseDec(o.AvgPrice)
+	result.Amount = base.ParseDec(o.OrigQty)
+	result.TriggerPrice = base.ParseDec(o.StopPrice)
+	return result
+}
+
 func (o *FutureOrder) ToStdOrder(mapSymbol func(string) string) *base.Order {
 	cost, _ := strconv.ParseFloat(o.CumQuote, 64)
 	result := o.FutureBase.ToStdOrder(mapSymbol)
@@ -400,3 +683,15 @@ func (o *InverseOrder) ToStdOrder(mapSymbol func(string) string) *base.Order {
 	result.Cost = cost
 	return result
 }
+
+func (o *FutureOrder) ToDecOrder() *base.OrderDec {
+	result := o.FutureBase.ToDecOrder()
+	result.Cost = base.ParseDec(o.CumQuote)
+	return result
+}
+
+func (o *InverseOrder) ToDecOrder() *base.OrderDec {
+	result := o.FutureBase.ToDecOrder()
+	result.Cost = base.ParseDec(o.CumBase)
+	return result
+}
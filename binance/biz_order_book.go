@@ -5,7 +5,6 @@ import (
 	"github.com/banbox/banexg/base"
 	"github.com/banbox/banexg/errs"
 	"github.com/bytedance/sonic"
-	"strconv"
 )
 
 func (e *Binance) FetchOrderBook(symbol string, limit int, params *map[string]interface{}) (*base.OrderBook, *errs.Error) {
@@ -33,71 +32,63 @@ func (e *Binance) FetchOrderBook(symbol string, limit int, params *map[string]in
 		return nil, rsp.Error
 	}
 	if market.Option {
-		return parseOrderBook[OptionOrderBook](market, rsp)
+		return parseOrderBook[OptionOrderBook](market, rsp, e.DecimalMode)
 	} else if market.Linear {
-		return parseOrderBook[LinearOrderBook](market, rsp)
+		return parseOrderBook[LinearOrderBook](market, rsp, e.DecimalMode)
 	} else if market.Inverse {
-		return parseOrderBook[InverseOrderBook](market, rsp)
+		return parseOrderBook[InverseOrderBook](market, rsp, e.DecimalMode)
 	} else {
-		return parseOrderBook[SpotOrderBook](market, rsp)
+		return parseOrderBook[SpotOrderBook](market, rsp, e.DecimalMode)
 	}
 }
 
-func parseOrderBook[T IBnbOrderBook](m *base.Market, rsp *base.HttpRes) (*base.OrderBook, *errs.Error) {
+func parseOrderBook[T IBnbOrderBook](m *base.Market, rsp *base.HttpRes, exact bool) (*base.OrderBook, *errs.Error) {
 	var data = new(T)
 	err := sonic.UnmarshalString(rsp.Content, &data)
 	if err != nil {
 		return nil, errs.New(errs.CodeUnmarshalFail, err)
 	}
-	result := (*data).ToStdOrderBook(m)
+	result := (*data).ToStdOrderBook(m, exact)
 	return result, nil
 }
 
-func (o BaseOrderBook) ToStdOrderBook(market *base.Market) *base.OrderBook {
-	var asks = make([][2]float64, len(o.Asks))
-	var bids = make([][2]float64, len(o.Bids))
-	for i, it := range o.Asks {
-		item := [2]float64{}
-		item[0], _ = strconv.ParseFloat(it[0], 64)
-		item[1], _ = strconv.ParseFloat(it[1], 64)
-		asks[i] = item
-	}
-	for i, it := range o.Bids {
-		item := [2]float64{}
-		item[0], _ = strconv.ParseFloat(it[0], 64)
-		item[1], _ = strconv.ParseFloat(it[1], 64)
-		bids[i] = item
-	}
+func (o BaseOrderBook) ToStdOrderBook(market *base.Market, exact bool) *base.OrderBook {
+	var asks = base.NewOrderBookSide(false, len(o.Asks), nil)
+	var bids = base.NewOrderBookSide(true, len(o.Bids), nil)
+	asks.Exact = exact
+	bids.Exact = exact
+	asks.UpdateStr(o.Asks)
+	bids.UpdateStr(o.Bids)
 	var res = base.OrderBook{
 		Symbol: market.Symbol,
-		Asks:   base.NewOrderBookSide(false, len(asks), asks),
-		Bids:   base.NewOrderBookSide(true, len(bids), bids),
-		Cache:  make([]map[string]string, 0),
+		Asks:   asks,
+		Bids:   bids,
+		Cache:  make([]interface{}, 0),
 	}
 	return &res
 }
 
-func (o OptionOrderBook) ToStdOrderBook(market *base.Market) *base.OrderBook {
-	var res = o.BaseOrderBook.ToStdOrderBook(market)
+func (o OptionOrderBook) ToStdOrderBook(market *base.Market, exact bool) *base.OrderBook {
+	var res = o.BaseOrderBook.ToStdOrderBook(market, exact)
 	res.TimeStamp = o.Time
 	res.Nonce = int64(o.UpdateID)
 	return res
 }
 
-func (o LinearOrderBook) ToStdOrderBook(market *base.Market) *base.OrderBook {
-	var res = o.BaseOrderBook.ToStdOrderBook(market)
+func (o LinearOrderBook) ToStdOrderBook(market *base.Market, exact bool) *base.OrderBook {
+	var res = o.BaseOrderBook.ToStdOrderBook(market, exact)
 	res.TimeStamp = o.Time
 	res.Nonce = int64(o.UpdateID)
 	return res
 }
 
-func (o InverseOrderBook) ToStdOrderBook(market *base.Market) *base.OrderBook {
-	var res = o.LinearOrderBook.ToStdOrderBook(market)
+func (o InverseOrderBook) ToStdOrderBook(market *base.Market, exact bool) *base.OrderBook {
+	var res = o.LinearOrderBook.ToStdOrderBook(market, exact)
 	return res
 }
 
-func (o SpotOrderBook) ToStdOrderBook(market *base.Market) *base.OrderBook {
-	var res = o.BaseOrderBook.ToStdOrderBook(market)
+func (o SpotOrderBook) ToStdOrderBook(market *base.Market, exact bool) *base.OrderBook {
+	var res = o.BaseOrderBook.ToStdOrderBook(market, exact)
 	res.Nonce = int64(o.UpdateID)
 	return res
 }
@@ -4,7 +4,9 @@ import (
 	"context"
 	"github.com/banbox/banexg/base"
 	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
 	"github.com/banbox/banexg/utils"
+	"go.uber.org/zap"
 	"strings"
 )
 
@@ -15,6 +17,64 @@ func isBnbOrderType(market *base.Market, odType string) bool {
 	return false
 }
 
+/*
+getExgOrderType
+根据止损止盈参数，将标准订单类型转为币安的订单类型
+*/
+func getExgOrderType(market *base.Market, odType string, isStopLoss, isTakeProfit bool) string {
+	isMarket := odType == base.OdTypeMarket
+	isLimit := odType == base.OdTypeLimit
+	if isStopLoss {
+		if isMarket {
+			if market.Contract {
+				return "STOP_MARKET"
+			}
+			return "STOP_LOSS"
+		} else if isLimit {
+			if market.Contract {
+				return "STOP"
+			}
+			return "STOP_LOSS_LIMIT"
+		}
+	} else if isTakeProfit {
+		if isMarket {
+			if market.Contract {
+				return "TAKE_PROFIT_MARKET"
+			}
+			return "TAKE_PROFIT"
+		} else if isLimit {
+			if market.Contract {
+				return "TAKE_PROFIT"
+			}
+			return "TAKE_PROFIT_LIMIT"
+		}
+	}
+	return odType
+}
+
+/*
+checkBnbOrderType
+ValidateOrder检查订单类型，参数同CreateOrder
+*/
+func checkBnbOrderType(market *base.Market, odType string, args map[string]interface{}) bool {
+	if market.Option {
+		return odType != base.OdTypeMarket
+	}
+	postOnly := utils.GetMapVal(args, base.ParamPostOnly, false)
+	timeInForce := utils.GetMapVal(args, base.ParamTimeInForce, "")
+	if (postOnly || timeInForce == base.TimeInForcePO) && (market.Spot || market.Type == base.MarketMargin) {
+		odType = base.OdTypeLimitMaker
+	}
+	stopLossPrice := utils.GetMapVal(args, base.ParamStopLossPrice, float64(0))
+	if stopLossPrice == 0 {
+		stopLossPrice = utils.GetMapVal(args, base.ParamTriggerPrice, float64(0))
+	}
+	trailingDelta := utils.GetMapVal(args, base.ParamTrailingDelta, 0)
+	isStopLoss := stopLossPrice != 0 || trailingDelta != 0
+	isTakeProfit := utils.GetMapVal(args, base.ParamTakeProfitPrice, float64(0)) != 0
+	return isBnbOrderType(market, getExgOrderType(market, odType, isStopLoss, isTakeProfit))
+}
+
 /*
 CreateOrder 提交订单到交易所
 
@@ -42,7 +102,23 @@ func (e *Binance) CreateOrder(symbol, odType, side string, amount float64, price
 	if err != nil {
 		return nil, err
 	}
+	if e.ValidateMode != "" {
+		check, err := e.ValidateOrder(symbol, odType, side, amount, price, params)
+		if err != nil {
+			return nil, err
+		}
+		if !check.Valid() {
+			if e.ValidateMode != base.ValidateAdjust || !check.Adjustable() {
+				return nil, check.ToError()
+			}
+			log.Info("adjust order by market rules", zap.String("symbol", symbol), zap.Float64("amount", amount),
+				zap.Float64("newAmount", check.Amount), zap.Float64("price", price), zap.Float64("newPrice", check.Price))
+			amount, price = check.Amount, check.Price
+		}
+	}
 	marginMode := utils.PopMapVal(args, base.ParamMarginMode, "")
+	utils.PopMapVal(args, base.ParamRefPrice, float64(0))
+	utils.PopMapVal(args, base.ParamFetchRefPrice, false)
 	sor := utils.PopMapVal(args, base.ParamSor, false)
 	clientOrderId := utils.PopMapVal(args, base.ParamClientOrderId, "")
 	postOnly := utils.PopMapVal(args, base.ParamPostOnly, false)
@@ -55,8 +131,6 @@ func (e *Binance) CreateOrder(symbol, odType, side string, amount float64, price
 		}
 		postOnly = true
 	}
-	isMarket := odType == base.OdTypeMarket
-	isLimit := odType == base.OdTypeLimit
 	triggerPrice := utils.PopMapVal(args, base.ParamTriggerPrice, float64(0))
 	stopLossPrice := utils.PopMapVal(args, base.ParamStopLossPrice, float64(0))
 	if stopLossPrice == 0 {
@@ -77,34 +151,12 @@ func (e *Binance) CreateOrder(symbol, odType, side string, amount float64, price
 			args["sideEffectType"] = "AUTO_REPAY"
 		}
 	}
-	exgOdType := odType
+	exgOdType := getExgOrderType(market, odType, isStopLoss, isTakeProfit)
 	stopPrice := float64(0)
 	if isStopLoss {
 		stopPrice = stopLossPrice
-		if isMarket {
-			exgOdType = "STOP_LOSS"
-			if market.Contract {
-				exgOdType = "STOP_MARKET"
-			}
-		} else if isLimit {
-			exgOdType = "STOP_LOSS_LIMIT"
-			if market.Contract {
-				exgOdType = "STOP"
-			}
-		}
 	} else if isTakeProfit {
 		stopPrice = takeProfitPrice
-		if isMarket {
-			exgOdType = "TAKE_PROFIT"
-			if market.Contract {
-				exgOdType = "TAKE_PROFIT_MARKET"
-			}
-		} else if isLimit {
-			exgOdType = "TAKE_PROFIT_LIMIT"
-			if market.Contract {
-				exgOdType = "TAKE_PROFIT"
-			}
-		}
 	}
 	if marginMode == base.MarginIsolated {
 		args["isIsolated"] = true
@@ -268,7 +320,7 @@ func (e *Binance) CreateOrder(symbol, odType, side string, amount float64, price
 		}
 	}
 	tryNum := e.GetRetryNum("CreateOrder", 1)
-	rsp := e.RequestApiRetry(context.Background(), method, &args, tryNum)
+	rsp := e.requestRetry(context.Background(), method, &args, tryNum)
 	if rsp.Error != nil {
 		return nil, rsp.Error
 	}
@@ -276,13 +328,13 @@ func (e *Binance) CreateOrder(symbol, odType, side string, amount float64, price
 		return market.Symbol
 	}
 	if method == "fapiPrivatePostOrder" {
-		return parseOrder[*FutureOrder](mapSymbol, rsp)
+		return parseOrder[*FutureOrder](mapSymbol, rsp, e.DecimalMode)
 	} else if method == "dapiPrivatePostOrder" {
-		return parseOrder[*InverseOrder](mapSymbol, rsp)
+		return parseOrder[*InverseOrder](mapSymbol, rsp, e.DecimalMode)
 	} else if method == "eapiPrivatePostOrder" {
-		return parseOrder[*OptionOrder](mapSymbol, rsp)
+		return parseOrder[*OptionOrder](mapSymbol, rsp, e.DecimalMode)
 	} else {
 		// spot margin sor
-		return parseOrder[*SpotOrder](mapSymbol, rsp)
+		return parseOrder[*SpotOrder](mapSymbol, rsp, e.DecimalMode)
 	}
 }
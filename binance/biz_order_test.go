@@ -84,3 +84,53 @@ func TestCalcelOrder(t *testing.T) {
 	resStr, _ := sonic.MarshalString(res)
 	log.Info("cancel order", zap.String("res", resStr))
 }
+
+func TestFetchOrder(t *testing.T) {
+	exg := getBinance(nil)
+	symbol := "ETH/USDT:USDT"
+
+	res, err := exg.FetchOrder(symbol, "8389765637843621129", nil)
+	if err != nil {
+		panic(err)
+	}
+	resStr, _ := sonic.MarshalString(res)
+	log.Info("fetch order", zap.String("res", resStr))
+}
+
+func TestWsApiOrder(t *testing.T) {
+	exg := getBinance(&map[string]interface{}{
+		OptUseWsApi: true,
+	})
+	symbol := "ETH/USDT"
+	od, err := exg.CreateOrder(symbol, base.OdTypeLimit, base.OdSideBuy, 0.01, 1000, nil)
+	if err != nil {
+		panic(err)
+	}
+	resStr, _ := sonic.MarshalString(od)
+	log.Info("create order by ws api", zap.String("res", resStr))
+	od, err = exg.FetchOrder(symbol, od.ID, nil)
+	if err != nil {
+		panic(err)
+	}
+	resStr, _ = sonic.MarshalString(od)
+	log.Info("fetch order by ws api", zap.String("res", resStr))
+	od, err = exg.CancelOrder(od.ID, symbol, nil)
+	if err != nil {
+		panic(err)
+	}
+	resStr, _ = sonic.MarshalString(od)
+	log.Info("cancel order by ws api", zap.String("res", resStr))
+}
+
+func TestFetchMyLiquidations(t *testing.T) {
+	exg := getBinance(nil)
+	args := &map[string]interface{}{
+		"market": base.MarketLinear,
+	}
+	res, err := exg.FetchMyLiquidations("", 0, 50, args)
+	if err != nil {
+		panic(err)
+	}
+	resStr, _ := sonic.MarshalString(res)
+	log.Info("my liquidations", zap.String("res", resStr))
+}
@@ -438,6 +438,86 @@ func TestMarketCopy(t *testing.T) {
 	t.Logf("%v -> %v, addr: %p -> %p", mar.Type, mar2.Type, mar, &mar2)
 }
 
+func TestGetMarketRules(t *testing.T) {
+	text := `{"symbol":"BTCUSDT","status":"TRADING","filters":[
+{"filterType":"PRICE_FILTER","minPrice":"0.01","maxPrice":"1000000.00","tickSize":"0.01"},
+{"filterType":"LOT_SIZE","minQty":"0.00001","maxQty":"9000.00","stepSize":"0.00001"},
+{"filterType":"ICEBERG_PARTS","limit":10},
+{"filterType":"TRAILING_DELTA","minTrailingAboveDelta":10,"maxTrailingAboveDelta":2000,"minTrailingBelowDelta":10,"maxTrailingBelowDelta":2000},
+{"filterType":"PERCENT_PRICE_BY_SIDE","bidMultiplierUp":"5","bidMultiplierDown":"0.2","askMultiplierUp":"5","askMultiplierDown":"0.2","avgPriceMins":5},
+{"filterType":"NOTIONAL","minNotional":"5.00","applyMinToMarket":true,"maxNotional":"9000000.00","applyMaxToMarket":false,"avgPriceMins":5},
+{"filterType":"MAX_NUM_ORDERS","maxNumOrders":200},
+{"filterType":"MAX_NUM_ALGO_ORDERS","maxNumAlgoOrders":5},
+{"filterType":"MAX_NUM_ICEBERG_ORDERS","maxNumIcebergOrders":5}]}`
+	var mar BnbMarket
+	if err := sonic.UnmarshalString(text, &mar); err != nil {
+		t.Fatal(err)
+	}
+	rules := mar.GetMarketRules()
+	if rules.BidMultUp != 5 || rules.AskMultDown != 0.2 || rules.AvgPriceMins != 5 {
+		t.Errorf("bad percent price by side: %+v", rules)
+	}
+	if !rules.MinCostToMarket || rules.MaxCostToMarket || rules.CostAvgMins != 5 {
+		t.Errorf("bad notional rules: %+v", rules)
+	}
+	if rules.MaxNumOrders != 200 || rules.MaxNumAlgoOrders != 5 || rules.MaxNumIcebergOrders != 5 || rules.IcebergParts != 10 {
+		t.Errorf("bad order num rules: %+v", rules)
+	}
+	if rules.MinTrailingAboveDelta != 10 || rules.MaxTrailingBelowDelta != 2000 {
+		t.Errorf("bad trailing delta: %+v", rules)
+	}
+	limits, _, _ := mar.GetMarketLimits()
+	if limits.Cost.Min != 5 || limits.Cost.Max != 9000000 {
+		t.Errorf("bad cost limits: %v", limits.Cost)
+	}
+
+	var rsp BnbMarketRsp
+	data, err := utils.ReadFile("testdata/fapiPublicGetExchangeInfo.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sonic.Unmarshal(data, &rsp); err != nil {
+		t.Fatal(err)
+	}
+	rules = rsp.Symbols[0].GetMarketRules()
+	if rules.PriceMultUp != 1.05 || rules.PriceMultDown != 0.95 || rules.MaxNumOrders != 200 || rules.MaxNumAlgoOrders != 10 {
+		t.Errorf("bad futures rules: %+v", rules)
+	}
+}
+
+func TestDefaultTickPrecision(t *testing.T) {
+	exg, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exg.PrecisionMode != base.PrecModeTickSize {
+		t.Fatalf("default precision mode should be tick size, got %v", exg.PrecisionMode)
+	}
+	text := `{"symbol":"XYZUSDT","status":"TRADING","baseAsset":"XYZ","quoteAsset":"USDT","isSpotTradingAllowed":true,
+"baseAssetPrecision":8,"quotePrecision":8,"filters":[
+{"filterType":"PRICE_FILTER","minPrice":"0.5","maxPrice":"100000","tickSize":"0.5"},
+{"filterType":"LOT_SIZE","minQty":"5","maxQty":"90000","stepSize":"5"}]}`
+	var mar BnbMarket
+	if err := sonic.UnmarshalString(text, &mar); err != nil {
+		t.Fatal(err)
+	}
+	market := exg.mapMarket(&mar)
+	if market.Precision.Price != 0.5 || market.Precision.Amount != 5 {
+		t.Fatalf("bad tick precision: %v", market.Precision.ToString())
+	}
+	price, err := exg.PrecPriceRound(market, 100.7, base.RoundDown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	amount, err := exg.PrecAmountRound(market, 12, base.RoundUp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price != "100.5" || amount != "15" {
+		t.Errorf("bad prec result: %s %s", price, amount)
+	}
+}
+
 func TestSetLeverage(t *testing.T) {
 	exg := getBinance(nil)
 	res, err := exg.SetLeverage(8, "GAS/USDT:USDT", nil)
@@ -530,3 +610,27 @@ func TestFetchAccountPositions(t *testing.T) {
 	text, _ := sonic.MarshalString(posList)
 	fmt.Println(text)
 }
+
+func TestParseBnbOhlcv(t *testing.T) {
+	content := `[[1499040000000,"0.01634790","0.80000000","0.01575800","0.01577100","148976.11427815",1499644799999,"2434.19055334",308,"1756.87402397","28.46694368","0"]]`
+	klines, err := parseBnbOhlcv(&base.HttpRes{Content: content}, 5, 0)
+	if err != nil {
+		panic(err)
+	}
+	k := klines[0]
+	if !k.Closed || k.Volume != 148976.11427815 || k.QuoteVolume != 2434.19055334 || k.TradeCount != 308 ||
+		k.TakerBuyVolume != 1756.87402397 || k.TakerBuyQuoteVolume != 28.46694368 {
+		t.Errorf("parse kline fail: %v", *k)
+	}
+	// 币本位：5和9是张数，7和10是币数
+	content = `[[1591258320000,"9640.7","9642.4","9640.6","9642.0","206",1591258379999,"2.13660389",48,"119","1.23424865"]]`
+	klines, err = parseBnbOhlcv(&base.HttpRes{Content: content}, 7, 10)
+	if err != nil {
+		panic(err)
+	}
+	k = klines[0]
+	if k.Volume != 2.13660389 || k.ContractVolume != 206 || k.QuoteVolume != 2060 || k.TakerBuyVolume != 1.23424865 ||
+		k.TakerBuyQuoteVolume != 1190 {
+		t.Errorf("parse inverse kline fail: %v", *k)
+	}
+}
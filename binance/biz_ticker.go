@@ -208,3 +208,36 @@ func (t *OptionTicker) ToStdTicker(e *Binance, marketType string) *base.Ticker {
 	}
 	return ticker
 }
+
+/*
+makeFetchRefPrice
+ValidateOrder缺少参考价时调用：现货和杠杆使用avgPrice（PERCENT_PRICE的参考价），合约使用最新价
+*/
+func makeFetchRefPrice(e *Binance) func(m *base.Market) (float64, *errs.Error) {
+	return func(m *base.Market) (float64, *errs.Error) {
+		if m.Contract {
+			ticker, err := e.FetchTicker(m.Symbol, nil)
+			if err != nil {
+				return 0, err
+			}
+			return ticker.Last, nil
+		}
+		args := map[string]interface{}{"symbol": m.ID}
+		tryNum := e.GetRetryNum("FetchRefPrice", 1)
+		rsp := e.RequestApiRetry(context.Background(), "publicGetAvgPrice", &args, tryNum)
+		if rsp.Error != nil {
+			return 0, rsp.Error
+		}
+		var data = struct {
+			Price string `json:"price"`
+		}{}
+		if err := sonic.UnmarshalString(rsp.Content, &data); err != nil {
+			return 0, errs.New(errs.CodeUnmarshalFail, err)
+		}
+		price, err := strconv.ParseFloat(data.Price, 64)
+		if err != nil || price <= 0 {
+			return 0, errs.NewMsg(errs.CodeUnmarshalFail, "invalid avgPrice for %s: %s", m.Symbol, data.Price)
+		}
+		return price, nil
+	}
+}
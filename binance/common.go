@@ -3,34 +3,48 @@ package binance
 import (
 	"github.com/banbox/banexg/base"
 	"github.com/banbox/banexg/utils"
+	"math"
 	"sort"
 	"strconv"
 )
 
+/*
+GetPrecision
+返回小数位数形式的精度，PrecModeTickSize时由setPrecision转为最小变动单位
+*/
 func (mar *BnbMarket) GetPrecision() *base.Precision {
 	var pre = base.Precision{}
 	if mar.QuantityPrecision > 0 {
-		pre.Amount = mar.QuantityPrecision
+		pre.Amount = float64(mar.QuantityPrecision)
 	} else if mar.QuantityScale > 0 {
-		pre.Amount = mar.QuantityScale
+		pre.Amount = float64(mar.QuantityScale)
 	}
 	if mar.PricePrecision > 0 {
-		pre.Price = mar.PricePrecision
+		pre.Price = float64(mar.PricePrecision)
 	} else if mar.PriceScale > 0 {
-		pre.Price = mar.PriceScale
+		pre.Price = float64(mar.PriceScale)
 	}
-	pre.Base = mar.BaseAssetPrecision
-	pre.Quote = mar.QuotePrecision
+	pre.Base = float64(mar.BaseAssetPrecision)
+	pre.Quote = float64(mar.QuotePrecision)
 	return &pre
 }
 
-func (mar *BnbMarket) GetMarketLimits() (*base.MarketLimits, int, int) {
-	minQty, _ := strconv.ParseFloat(mar.MinQty, 64)
-	maxQty, _ := strconv.ParseFloat(mar.MaxQty, 64)
+func (mar *BnbMarket) filterMap() map[string]BnbFilter {
 	var filters = make(map[string]BnbFilter)
 	for _, flt := range mar.Filters {
 		filters[utils.GetMapVal(flt, "filterType", "")] = flt
 	}
+	return filters
+}
+
+/*
+GetMarketLimits
+返回限制，以及PRICE_FILTER的tickSize和LOT_SIZE的stepSize原始字符串
+*/
+func (mar *BnbMarket) GetMarketLimits() (*base.MarketLimits, string, string) {
+	minQty, _ := strconv.ParseFloat(mar.MinQty, 64)
+	maxQty, _ := strconv.ParseFloat(mar.MaxQty, 64)
+	var filters = mar.filterMap()
 	var res = base.MarketLimits{
 		Amount: &base.LimitRange{
 			Min: minQty,
@@ -41,7 +55,7 @@ func (mar *BnbMarket) GetMarketLimits() (*base.MarketLimits, int, int) {
 		Cost:     &base.LimitRange{},
 		Market:   &base.LimitRange{},
 	}
-	var pricePrec, amountPrec int
+	var priceTick, amountStep string
 	if flt, ok := filters["PRICE_FILTER"]; ok {
 		// PRICE_FILTER reports zero values for maxPrice
 		// since they updated filter types in November 2018
@@ -49,26 +63,138 @@ func (mar *BnbMarket) GetMarketLimits() (*base.MarketLimits, int, int) {
 		// therefore limits['price']['max'] doesn't have any meaningful value except None
 		res.Price.Min = utils.GetMapFloat(flt, "minPrice")
 		res.Price.Max = utils.GetMapFloat(flt, "maxPrice")
-		precText := utils.GetMapVal(flt, "tickSize", "")
-		pricePrec = utils.PrecisionFromString(precText)
+		priceTick = utils.GetMapVal(flt, "tickSize", "")
 	}
 	if flt, ok := filters["LOT_SIZE"]; ok {
 		res.Amount.Min = utils.GetMapFloat(flt, "minQty")
 		res.Amount.Max = utils.GetMapFloat(flt, "maxQty")
-		amtText := utils.GetMapVal(flt, "stepSize", "")
-		amountPrec = utils.PrecisionFromString(amtText)
+		amountStep = utils.GetMapVal(flt, "stepSize", "")
 	}
 	if flt, ok := filters["MARKET_LOT_SIZE"]; ok {
 		res.Market.Min = utils.GetMapFloat(flt, "minQty")
 		res.Market.Max = utils.GetMapFloat(flt, "maxQty")
 	}
 	if flt, ok := filters["MIN_NOTIONAL"]; ok {
+		// 合约为notional，现货旧版为minNotional
 		res.Cost.Min = utils.GetMapFloat(flt, "notional")
+		if res.Cost.Min == 0 {
+			res.Cost.Min = utils.GetMapFloat(flt, "minNotional")
+		}
 	} else if flt, ok := filters["NOTIONAL"]; ok {
 		res.Cost.Min = utils.GetMapFloat(flt, "minNotional")
 		res.Cost.Max = utils.GetMapFloat(flt, "maxNotional")
 	}
-	return &res, pricePrec, amountPrec
+	return &res, priceTick, amountStep
+}
+
+/*
+setPrecision
+PrecModeTickSize时将小数位数转为最小变动单位，并使用过滤器中的tickSize、stepSize；
+其他模式下使用tickSize、stepSize的小数位数
+*/
+func setPrecision(pre *base.Precision, mode int, priceTick, amountStep string) {
+	if mode == base.PrecModeTickSize {
+		pre.Amount = decimalsToTick(pre.Amount)
+		pre.Price = decimalsToTick(pre.Price)
+		pre.Base = decimalsToTick(pre.Base)
+		pre.Quote = decimalsToTick(pre.Quote)
+		if tick, _ := strconv.ParseFloat(priceTick, 64); tick > 0 {
+			pre.Price = tick
+		}
+		if step, _ := strconv.ParseFloat(amountStep, 64); step > 0 {
+			pre.Amount = step
+		}
+		return
+	}
+	if pricePrec := utils.PrecisionFromString(priceTick); pricePrec > 0 {
+		pre.Price = float64(pricePrec)
+	}
+	if amountPrec := utils.PrecisionFromString(amountStep); amountPrec > 0 {
+		pre.Amount = float64(amountPrec)
+	}
+}
+
+func decimalsToTick(num float64) float64 {
+	if num <= 0 {
+		return 0
+	}
+	return math.Pow10(-int(num))
+}
+
+/*
+GetMarketRules
+解析GetMarketLimits未覆盖的过滤器：PERCENT_PRICE、PERCENT_PRICE_BY_SIDE、MAX_NUM_ORDERS、
+MAX_NUM_ALGO_ORDERS、MAX_NUM_ICEBERG_ORDERS、ICEBERG_PARTS、TRAILING_DELTA，以及名义价值的applyToMarket和avgPriceMins
+*/
+func (mar *BnbMarket) GetMarketRules() *base.MarketRules {
+	var filters = mar.filterMap()
+	var res = base.MarketRules{}
+	getInt := func(flt BnbFilter, key string) int {
+		return int(utils.GetMapFloat(flt, key))
+	}
+	getBool := func(flt BnbFilter, key string) bool {
+		val, _ := flt[key].(bool)
+		return val
+	}
+	if flt, ok := filters["PERCENT_PRICE"]; ok {
+		res.PriceMultUp = utils.GetMapFloat(flt, "multiplierUp")
+		res.PriceMultDown = utils.GetMapFloat(flt, "multiplierDown")
+		res.AvgPriceMins = getInt(flt, "avgPriceMins")
+	}
+	if flt, ok := filters["PERCENT_PRICE_BY_SIDE"]; ok {
+		res.BidMultUp = utils.GetMapFloat(flt, "bidMultiplierUp")
+		res.BidMultDown = utils.GetMapFloat(flt, "bidMultiplierDown")
+		res.AskMultUp = utils.GetMapFloat(flt, "askMultiplierUp")
+		res.AskMultDown = utils.GetMapFloat(flt, "askMultiplierDown")
+		res.AvgPriceMins = getInt(flt, "avgPriceMins")
+	}
+	if flt, ok := filters["MIN_NOTIONAL"]; ok {
+		res.MinCostToMarket = getBool(flt, "applyToMarket")
+		res.CostAvgMins = getInt(flt, "avgPriceMins")
+	} else if flt, ok := filters["NOTIONAL"]; ok {
+		res.MinCostToMarket = getBool(flt, "applyMinToMarket")
+		res.MaxCostToMarket = getBool(flt, "applyMaxToMarket")
+		res.CostAvgMins = getInt(flt, "avgPriceMins")
+	}
+	// 现货用maxNumOrders等，合约用limit
+	if flt, ok := filters["MAX_NUM_ORDERS"]; ok {
+		res.MaxNumOrders = max(getInt(flt, "maxNumOrders"), getInt(flt, "limit"))
+	}
+	if flt, ok := filters["MAX_NUM_ALGO_ORDERS"]; ok {
+		res.MaxNumAlgoOrders = max(getInt(flt, "maxNumAlgoOrders"), getInt(flt, "limit"))
+	}
+	if flt, ok := filters["MAX_NUM_ICEBERG_ORDERS"]; ok {
+		res.MaxNumIcebergOrders = getInt(flt, "maxNumIcebergOrders")
+	}
+	if flt, ok := filters["ICEBERG_PARTS"]; ok {
+		res.IcebergParts = getInt(flt, "limit")
+	}
+	if flt, ok := filters["TRAILING_DELTA"]; ok {
+		res.MinTrailingAboveDelta = getInt(flt, "minTrailingAboveDelta")
+		res.MaxTrailingAboveDelta = getInt(flt, "maxTrailingAboveDelta")
+		res.MinTrailingBelowDelta = getInt(flt, "minTrailingBelowDelta")
+		res.MaxTrailingBelowDelta = getInt(flt, "maxTrailingBelowDelta")
+	}
+	return &res
+}
+
+func (b *BaseLvgBracket) toStdTier(symbol, currency string, floor, cap float64) *base.LeverageTier {
+	return &base.LeverageTier{
+		Tier:            b.Bracket,
+		Symbol:          symbol,
+		Currency:        currency,
+		MinNotional:     floor,
+		MaxNotional:     cap,
+		MaintMarginRate: b.MaintMarginRatio,
+		MaxLeverage:     b.InitialLeverage,
+		MaintAmount:     b.Cum,
+	}
+}
+
+func sortLvgTiers(tiers []*base.LeverageTier) {
+	sort.SliceStable(tiers, func(i, j int) bool {
+		return tiers[i].MinNotional < tiers[j].MinNotional
+	})
 }
 
 func (b *LinearSymbolLvgBrackets) ToStdBracket() [][2]float64 {
@@ -82,6 +208,16 @@ func (b *LinearSymbolLvgBrackets) ToStdBracket() [][2]float64 {
 	})
 	return res
 }
+
+func (b *LinearSymbolLvgBrackets) ToStdTiers(symbol, currency string) []*base.LeverageTier {
+	var res = make([]*base.LeverageTier, 0, len(b.Brackets))
+	for _, item := range b.Brackets {
+		res = append(res, item.toStdTier(symbol, currency, item.NotionalFloor, item.NotionalCap))
+	}
+	sortLvgTiers(res)
+	return res
+}
+
 func (b *LinearSymbolLvgBrackets) GetSymbol() string {
 	return b.Symbol
 }
@@ -97,6 +233,16 @@ func (b *InversePairLvgBrackets) ToStdBracket() [][2]float64 {
 	})
 	return res
 }
+
+func (b *InversePairLvgBrackets) ToStdTiers(symbol, currency string) []*base.LeverageTier {
+	var res = make([]*base.LeverageTier, 0, len(b.Brackets))
+	for _, item := range b.Brackets {
+		res = append(res, item.toStdTier(symbol, currency, item.QtylFloor, item.QtyCap))
+	}
+	sortLvgTiers(res)
+	return res
+}
+
 func (b *InversePairLvgBrackets) GetSymbol() string {
 	return b.Symbol
 }
@@ -27,12 +27,14 @@ const (
 
 const (
 	OptRecvWindow = "RecvWindow"
+	OptUseWsApi   = "UseWsApi"
 )
 
 var (
 	DefCareMarkets = []string{
 		base.MarketSpot, base.MarketLinear, base.MarketInverse,
 	}
+	MaxBookCache = 1000 // 订单簿快照未就绪或重新同步时最多缓存的增量数，超出时丢弃最旧的
 )
 
 const (
@@ -918,8 +918,14 @@ func New(Options map[string]interface{}) (*Binance, *errs.Error) {
 	exg.Sign = makeSign(exg)
 	exg.FetchCurrencies = makeFetchCurr(exg)
 	exg.FetchMarkets = makeFetchMarkets(exg)
+	exg.DecodeMarketInfo = decodeMarketInfo
+	exg.CheckOrderType = checkBnbOrderType
 	exg.OnWsMsg = makeHandleWsMsg(exg)
+	exg.OnWsEvent = makeHandleWsEvent(exg)
+	exg.OnWsClose = makeHandleWsClose(exg)
+	exg.CloseClientChans = exg.closeClientChans
 	exg.GetRetryWait = makeGetRetryWait(exg)
+	exg.FetchRefPrice = makeFetchRefPrice(exg)
 	exg.Authenticate = makeAuthenticate(exg)
 	err := exg.Init()
 	return exg, err
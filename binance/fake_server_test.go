@@ -0,0 +1,683 @@
+package binance
+
+import (
+	"context"
+	"fmt"
+	"github.com/banbox/banexg/base"
+	"github.com/banbox/banexg/binance/fakebnb"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"github.com/bytedance/sonic"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newFakeBinance(t *testing.T, secret string, opts map[string]interface{}) (*Binance, *fakebnb.Server) {
+	log.SetupByArgs(true, "")
+	srv := fakebnb.NewServer("fakeKey", "fakeSecret")
+	for marketType, path := range map[string]string{
+		base.MarketLinear:  "testdata/fapiPublicGetExchangeInfo.json",
+		base.MarketInverse: "testdata/dapiPublicGetExchangeInfo.json",
+	} {
+		data, err := utils.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = srv.SetExchangeInfo(marketType, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	args := map[string]interface{}{
+		base.OptApiKey:     "fakeKey",
+		base.OptApiSecret:  secret,
+		base.OptMarketType: base.MarketLinear,
+	}
+	for k, v := range opts {
+		args[k] = v
+	}
+	exg, err := New(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exg.Hosts.Prod = srv.Hosts()
+	return exg, srv
+}
+
+func TestFakeServer(t *testing.T) {
+	exg, srv := newFakeBinance(t, "fakeSecret", nil)
+	defer srv.Close()
+	symbol, mar := "ETH/USDT:USDT", base.MarketLinear
+	srv.SetBalance(mar, "USDT", 10000)
+	srv.SetBook(mar, "ETHUSDT", [][2]float64{{2000, 5}, {1999, 5}}, [][2]float64{{2001, 1}, {2002, 5}})
+
+	books, err := exg.WatchOrderBooks([]string{symbol}, 100, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readBook := func() base.OrderBook {
+		select {
+		case book := <-books:
+			return book
+		case <-time.After(time.Second * 5):
+			t.Fatal("wait order book timeout")
+		}
+		return base.OrderBook{}
+	}
+	if book := readBook(); !book.Reset || book.Asks.Rows[0][0] != 2001 {
+		t.Fatalf("bad snapshot: %v", book.Asks.Rows)
+	}
+	trades, err := exg.WatchMyTrades(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readTrade := func() base.MyTrade {
+		for {
+			select {
+			case trade := <-trades:
+				if trade.Amount > 0 {
+					return trade
+				}
+			case <-time.After(time.Second * 5):
+				t.Fatal("wait my trade timeout")
+				return base.MyTrade{}
+			}
+		}
+	}
+
+	// 市价单吃掉2001的卖单，订单簿推送增量
+	od, err := exg.CreateOrder(symbol, base.OdTypeMarket, base.OdSideBuy, 1, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if od.Filled != 1 || od.Status != base.OdStatusClosed {
+		t.Errorf("market order not filled: %v %s", od.Filled, od.Status)
+	}
+	if trade := readTrade(); trade.Price != 2001 || trade.Amount != 1 || trade.Symbol != symbol {
+		t.Errorf("bad trade: %v %v %s", trade.Price, trade.Amount, trade.Symbol)
+	}
+	if book := readBook(); book.Asks.Rows[0][0] != 2002 {
+		t.Errorf("depth diff not applied: %v", book.Asks.Rows)
+	}
+
+	// 限价挂单，行情穿越后以挂单价成交
+	od, err = exg.CreateOrder(symbol, base.OdTypeLimit, base.OdSideBuy, 1, 1990, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if od.Status != base.OdStatusOpen {
+		t.Errorf("limit order should be open: %s", od.Status)
+	}
+	srv.UpdateBook(mar, "ETHUSDT", [][2]float64{{2000, 0}, {1999, 0}}, [][2]float64{{1989, 2}})
+	if trade := readTrade(); trade.Price != 1990 || !trade.Maker {
+		t.Errorf("bad maker trade: %v %v", trade.Price, trade.Maker)
+	}
+	if pos := srv.Position(mar, "ETHUSDT"); pos != 2 {
+		t.Errorf("position should be 2, got %v", pos)
+	}
+
+	bal, err := exg.FetchBalance(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset, ok := bal.Assets["USDT"]; !ok || asset.Total != 10000 {
+		t.Errorf("bad balance: %v", bal.Assets)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	if err = exg.Close(ctx); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFakeServerSignature(t *testing.T) {
+	exg, srv := newFakeBinance(t, "wrongSecret", nil)
+	defer srv.Close()
+	_, err := exg.CreateOrder("ETH/USDT:USDT", base.OdTypeMarket, base.OdSideBuy, 1, 0, nil)
+	if err == nil {
+		t.Fatal("order with bad signature should fail")
+	}
+	_, err = exg.FetchBalance(nil)
+	if err == nil {
+		t.Fatal("balance with bad signature should fail")
+	}
+}
+
+func TestMarketCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "markets.json")
+	opts := map[string]interface{}{base.OptMarketCache: path}
+	exg, srv := newFakeBinance(t, "fakeSecret", opts)
+	markets, err := exg.LoadMarkets(false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(markets) == 0 {
+		t.Fatal("no markets loaded")
+	}
+	ageMarketCache(t, path, 2000)
+
+	// 缓存即将过期时后台刷新，下次LoadMarkets时替换
+	exg4, _ := newFakeBinance(t, "fakeSecret", opts)
+	exg4.Hosts.Prod = srv.Hosts()
+	cached, err := exg4.LoadMarkets(false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshed := false
+	for i := 0; i < 50 && !refreshed; i++ {
+		time.Sleep(time.Millisecond * 100)
+		cur, err := exg4.LoadMarkets(false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = exg4.GetMarket("ETH/USDT:USDT"); err != nil {
+			t.Fatal(err)
+		}
+		refreshed = fmt.Sprintf("%p", cur) != fmt.Sprintf("%p", cached)
+	}
+	if !refreshed {
+		t.Error("markets not refreshed in background")
+	}
+	srv.Close()
+
+	// 缓存有效时不请求接口
+	exg2, _ := newFakeBinance(t, "fakeSecret", opts)
+	exg2.Hosts.Prod = srv.Hosts()
+	markets2, err := exg2.LoadMarkets(false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(markets2) != len(markets) {
+		t.Errorf("cached markets num %d != %d", len(markets2), len(markets))
+	}
+	mar, err := exg2.GetMarket("ETH/USDT:USDT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mar.Info.(*BnbMarket); !ok {
+		t.Errorf("cached market info should be *BnbMarket, got %T", mar.Info)
+	}
+
+	// 缓存过期且接口不可用时使用过期缓存
+	ageMarketCache(t, path, 7200)
+	exg3, _ := newFakeBinance(t, "fakeSecret", opts)
+	exg3.Hosts.Prod = srv.Hosts()
+	markets3, err := exg3.LoadMarkets(false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(markets3) != len(markets) {
+		t.Errorf("stale cache markets num %d != %d", len(markets3), len(markets))
+	}
+}
+
+func ageMarketCache(t *testing.T, path string, secs int64) {
+	var cache base.MarketCache
+	if err := utils.ReadJsonFile(path, &cache); err != nil {
+		t.Fatal(err)
+	}
+	cache.Time = time.Now().UnixMilli() - secs*1000
+	if err := utils.WriteJsonFile(path, &cache); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFakeValidateOrder(t *testing.T) {
+	exg, srv := newFakeBinance(t, "fakeSecret", map[string]interface{}{base.OptValidateOrder: base.ValidateCheck})
+	defer srv.Close()
+	symbol, mar := "ETH/USDT:USDT", base.MarketLinear
+	srv.SetBalance(mar, "USDT", 10000)
+	srv.SetBook(mar, "ETHUSDT", [][2]float64{{2000, 5}}, [][2]float64{{2001, 5}})
+
+	// 名义价值低于20，下单前拒绝
+	_, err := exg.CreateOrder(symbol, base.OdTypeLimit, base.OdSideBuy, 0.005, 1990, nil)
+	if err == nil || err.Code != errs.CodeOrderInvalid {
+		t.Fatalf("expect order invalid, got %v", err)
+	}
+	check, err := exg.ValidateOrder(symbol, base.OdTypeLimitMaker, base.OdSideBuy, 1, 1990, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check.Valid() || check.Violations[0].Code != base.ViolOrderType {
+		t.Errorf("LIMIT_MAKER should be unsupported for futures: %v", check.ToError())
+	}
+	args := map[string]interface{}{base.ParamStopLossPrice: 1900.0}
+	check, _ = exg.ValidateOrder(symbol, base.OdTypeMarket, base.OdSideSell, 1, 0, &args)
+	if !check.Valid() {
+		t.Errorf("STOP_MARKET should be valid: %v", check.ToError())
+	}
+	// 未传入refPrice且未开启获取时跳过百分比价格检查，仅提示
+	check, err = exg.ValidateOrder(symbol, base.OdTypeLimit, base.OdSideBuy, 1, 2200, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !check.Valid() || check.Violations[0].Code != base.ViolNoRefPrice {
+		t.Errorf("expect noRefPrice warning, got: %v", check.Violations)
+	}
+	// 开启ParamFetchRefPrice时通过ticker获取参考价
+	args = map[string]interface{}{base.ParamFetchRefPrice: true}
+	check, err = exg.ValidateOrder(symbol, base.OdTypeLimit, base.OdSideBuy, 1, 2200, &args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check.Valid() || check.Violations[0].Code != base.ViolPercentPrice {
+		t.Errorf("expect percentPrice by fetched ref price, got: %v", check.ToError())
+	}
+
+	exg.ValidateMode = base.ValidateAdjust
+	args = map[string]interface{}{base.ParamRefPrice: 2000.0}
+	od, err := exg.CreateOrder(symbol, base.OdTypeLimit, base.OdSideBuy, 0.0051, 1990.005, &args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if od.Amount != 0.011 || od.Price != 1990.01 {
+		t.Errorf("order not adjusted: %v %v", od.Amount, od.Price)
+	}
+}
+
+func TestFakeTickSize(t *testing.T) {
+	exg, srv := newFakeBinance(t, "fakeSecret", map[string]interface{}{base.OptPrecisionMode: base.PrecModeTickSize})
+	defer srv.Close()
+	if _, err := exg.LoadMarkets(false, nil); err != nil {
+		t.Fatal(err)
+	}
+	mar, err := exg.GetMarket("ETH/USDT:USDT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mar.Precision.Price != 0.01 || mar.Precision.Amount != 0.001 {
+		t.Errorf("bad tick precision: %v", mar.Precision.ToString())
+	}
+	mar2, err := exg.GetMarket("BTC/USD:BTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mar2.Precision.Price != 0.1 || mar2.Precision.Amount != 1 {
+		t.Errorf("bad inverse tick precision: %v", mar2.Precision.ToString())
+	}
+	price, _ := exg.PrecPriceRound(mar, 2000.129, base.RoundDown)
+	amount, _ := exg.PrecAmountRound(mar, 0.0011, base.RoundUp)
+	if price != "2000.12" || amount != "0.002" {
+		t.Errorf("bad prec result: %s %s", price, amount)
+	}
+}
+
+func TestFakeDecimalMode(t *testing.T) {
+	exg, srv := newFakeBinance(t, "fakeSecret", map[string]interface{}{base.OptDecimalMode: true})
+	defer srv.Close()
+	symbol, mar := "ETH/USDT:USDT", base.MarketLinear
+	srv.SetBalance(mar, "USDT", 10000.1)
+	srv.SetBook(mar, "ETHUSDT", [][2]float64{{2000.1, 0.3}, {2000, 5}}, [][2]float64{{2001.1, 0.7}})
+
+	book, err := exg.FetchOrderBook(symbol, 100, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(book.Bids.DecRows) != len(book.Bids.Rows) || book.Bids.DecRows[0][0].String() != "2000.1" ||
+		book.Bids.DecRows[0][1].String() != "0.3" {
+		t.Errorf("bad dec bids: %v", book.Bids.DecRows)
+	}
+	book.UpdateSide([][2]string{{"2000.1", "0"}, {"1999.9", "0.1"}}, true)
+	if len(book.Bids.DecRows) != 2 || book.Bids.DecRows[1][0].String() != "1999.9" {
+		t.Errorf("bad dec bids after update: %v", book.Bids.DecRows)
+	}
+
+	od, err := exg.CreateOrder(symbol, base.OdTypeLimit, base.OdSideBuy, 0.1, 1990.3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if od.Dec == nil || od.Dec.Amount.String() != "0.1" || od.Dec.Price.String() != "1990.3" ||
+		od.Dec.Remaining.String() != "0.1" {
+		t.Errorf("bad dec order: %+v", od.Dec)
+	}
+
+	bals, err := exg.FetchBalance(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usdt, ok := bals.Assets["USDT"]
+	if !ok || usdt.Dec == nil || usdt.Dec.Total.String() != "10000.1" {
+		t.Errorf("bad dec balance: %+v", usdt)
+	}
+
+	// 现货balanceUpdate同时更新可用和总额
+	acc, err := exg.GetAccount(exg.DefAccName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc.MarBalances[base.MarketSpot] = &base.Balances{Assets: map[string]*base.Asset{"BTC": {Code: "BTC", Free: 1,
+		Total: 1.5, Dec: &base.AssetDec{Free: base.ParseDec("1"), Used: base.ParseDec("0.5"), Total: base.ParseDec("1.5")}}}}
+	client := &base.WsClient{AccName: exg.DefAccName, MarketType: base.MarketSpot}
+	exg.handleBalance(client, map[string]string{"e": "balanceUpdate", "E": "1573200697110", "a": "BTC", "d": "0.1"})
+	btc := acc.MarBalances[base.MarketSpot].Assets["BTC"]
+	if btc.Dec.Free.String() != "1.1" || btc.Dec.Total.String() != "1.6" || btc.Total != 1.6 {
+		t.Errorf("bad balance after balanceUpdate: %+v %+v", btc, btc.Dec)
+	}
+
+	var optOd = &OptionOrder{}
+	err2 := sonic.UnmarshalString(`{"orderId":4611875134427365377,"symbol":"BTC-200730-9000-C","price":"100",`+
+		`"quantity":"0.3","executedQty":"0.00","fee":"0.0012","side":"BUY","type":"LIMIT","status":"ACCEPTED"}`, optOd)
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	optDec := optOd.ToDecOrder()
+	if optDec.Amount.String() != "0.3" || optDec.FeeCost.String() != "0.0012" {
+		t.Errorf("bad option dec order: %+v", optDec)
+	}
+}
+
+func TestFakeOptionChain(t *testing.T) {
+	exg, srv := newFakeBinance(t, "fakeSecret", map[string]interface{}{
+		base.OptCareMarkets: []string{base.MarketLinear, base.MarketOption},
+	})
+	defer srv.Close()
+	optSymbol := func(strike, side string) string {
+		return `{"symbol":"BTC-240628-` + strike + `-` + side[:1] + `","side":"` + side + `","strikePrice":"` + strike +
+			`","underlying":"BTCUSDT","unit":1,"expiryDate":1719561600000,"quoteAsset":"USDT","priceScale":1,` +
+			`"quantityScale":2,"minQty":"0.01","maxQty":"1000","filters":[]}`
+	}
+	info := `{"timezone":"UTC","optionSymbols":[` + optSymbol("60000", "CALL") + `,` + optSymbol("60000", "PUT") +
+		`,` + optSymbol("65000", "CALL") + `]}`
+	if err := srv.SetExchangeInfo(base.MarketOption, []byte(info)); err != nil {
+		t.Fatal(err)
+	}
+	srv.SetOptionMarks([]byte(`[{"symbol":"BTC-240628-60000-C","markPrice":"1200.5","bidIV":"0.5","askIV":"0.6",` +
+		`"markIV":"0.55","delta":"0.52","theta":"-30.1","gamma":"0.0001","vega":"90.2"}]`))
+
+	chain, err := exg.FetchOptionChain("BTC", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiries := chain.ExpiryList()
+	if len(expiries) != 1 || expiries[0] != 1719561600000 {
+		t.Fatalf("bad expiries: %v", expiries)
+	}
+	strikes := chain.StrikeList(expiries[0])
+	if len(strikes) != 2 || strikes[0].Strike != 60000 || strikes[0].Put == nil || strikes[1].Put != nil {
+		t.Fatalf("bad strikes: %v", strikes)
+	}
+	call := strikes[0].Call
+	if call == nil || call.MarkPrice != 1200.5 || call.MarkIV != 0.55 || call.Delta != 0.52 {
+		t.Fatalf("bad call quote: %+v", call)
+	}
+
+	out, err := exg.WatchOptionChain("BTC", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap := <-out; snap.Get(call.Symbol) == nil {
+		t.Fatal("first output should be the snapshot")
+	}
+	// BTC/USDT的期权链和BTC共用BTC@markPrice流
+	out2, err := exg.WatchOptionChain("BTC/USDT", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-out2
+	waitMark := func(out chan base.OptionChain, price float64) *base.OptionQuote {
+		msg := []map[string]string{{"e": "markPrice", "E": "1719000000000", "s": "BTC-240628-60000-C", "mp": fmt.Sprint(price)}}
+		timeout := time.After(time.Second * 5)
+		for {
+			srv.Push(base.MarketOption, "BTC@markPrice", msg)
+			select {
+			case snap, ok := <-out:
+				if !ok {
+					t.Fatal("option chain closed")
+				}
+				q := snap.Get(call.Symbol)
+				if q.MarkPrice == price {
+					return q
+				}
+			case <-time.After(time.Millisecond * 100):
+			case <-timeout:
+				t.Fatal("wait option chain timeout")
+			}
+		}
+	}
+	if q := waitMark(out, 1250); q.Delta != 0.52 {
+		t.Errorf("bad updated quote: %+v", q)
+	}
+	if err = exg.UnWatchOptionChain("BTC", nil); err != nil {
+		t.Fatal(err)
+	}
+	// 取消BTC后，BTC/USDT的期权链应继续更新
+	waitMark(out2, 1300)
+	if err = exg.UnWatchOptionChain("BTC/USDT", nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFakeLeverageTiers(t *testing.T) {
+	exg, srv := newFakeBinance(t, "fakeSecret", nil)
+	defer srv.Close()
+	symbol, mar := "ETH/USDT:USDT", base.MarketLinear
+	srv.SetLeverageBrackets(mar, []byte(`[{"symbol":"ETHUSDT","brackets":[`+
+		`{"bracket":2,"initialLeverage":50,"notionalCap":250000,"notionalFloor":10000,"maintMarginRatio":0.01,"cum":50},`+
+		`{"bracket":1,"initialLeverage":75,"notionalCap":10000,"notionalFloor":0,"maintMarginRatio":0.005,"cum":0}]}]`))
+
+	tiers, err := exg.FetchLeverageTiers([]string{symbol}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := tiers[symbol]
+	if len(items) != 2 || items[0].Tier != 1 || items[1].MaxLeverage != 50 || items[1].MaxNotional != 250000 ||
+		items[1].MaintAmount != 50 || items[1].Currency != "USDT" {
+		t.Fatalf("bad tiers: %v", items)
+	}
+	if pct := exg.GetMaintMarginPct(symbol, 20000); pct != 0.01 {
+		t.Errorf("bad maint margin pct: %v", pct)
+	}
+
+	// 持仓名义价值20000在第2层，最大杠杆50
+	srv.SetBalance(mar, "USDT", 100000)
+	srv.SetBook(mar, "ETHUSDT", [][2]float64{{1999, 20}}, [][2]float64{{2000, 20}})
+	if _, err = exg.CreateOrder(symbol, base.OdTypeMarket, base.OdSideBuy, 10, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	_, err = exg.SetLeverage(60, symbol, &map[string]interface{}{base.ParamLeverageCheck: base.ValidateCheck})
+	if err == nil || err.Code != errs.CodeParamInvalid {
+		t.Errorf("leverage 60 should be refused: %v", err)
+	}
+	res, err := exg.SetLeverage(60, symbol, &map[string]interface{}{base.ParamLeverageCheck: base.ValidateAdjust})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lvg, _ := res["leverage"].(float64); lvg != 50 {
+		t.Errorf("leverage should be clamped to 50: %v", res)
+	}
+	res, err = exg.SetLeverage(60, symbol, &map[string]interface{}{base.ParamLeverageCheck: base.ValidateCheck,
+		base.ParamNotional: float64(5000)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lvg, _ := res["leverage"].(float64); lvg != 60 {
+		t.Errorf("leverage 60 should be allowed at tier 1: %v", res)
+	}
+	_, err = exg.SetLeverage(60, symbol, &map[string]interface{}{base.ParamLeverageCheck: base.ValidateCheck,
+		base.ParamNotional: 20000})
+	if err == nil || err.Code != errs.CodeParamInvalid {
+		t.Errorf("int notional should be used: %v", err)
+	}
+	// 只有多头持仓，空头一侧在第1层
+	_, err = exg.SetLeverage(60, symbol, &map[string]interface{}{base.ParamLeverageCheck: base.ValidateCheck,
+		base.ParamPositionSide: base.PosSideShort})
+	if err != nil {
+		t.Errorf("leverage 60 should be allowed for short side: %v", err)
+	}
+	_, err = exg.SetLeverage(60, symbol, &map[string]interface{}{base.ParamLeverageCheck: base.ValidateCheck,
+		base.ParamPositionSide: base.PosSideLong})
+	if err == nil || err.Code != errs.CodeParamInvalid {
+		t.Errorf("leverage 60 should be refused for long side: %v", err)
+	}
+}
+
+func TestFakeBookResyncStop(t *testing.T) {
+	exg, srv := newFakeBinance(t, "fakeSecret", nil)
+	defer srv.Close()
+	symbol, mar := "ETH/USDT:USDT", base.MarketLinear
+	srv.SetBook(mar, "ETHUSDT", [][2]float64{{2000, 5}}, [][2]float64{{2001, 5}})
+	srv.SetBook(mar, "BTCUSDT", [][2]float64{{60000, 1}}, [][2]float64{{60001, 1}})
+	// BTC保持订阅，取消ETH后连接仍在，重新同步需按订阅任务停止
+	books, err := exg.WatchOrderBooks([]string{symbol, "BTC/USDT:USDT"}, 100, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nonce int64
+	for i := 0; i < 2; i++ {
+		select {
+		case book := <-books:
+			if book.Symbol == symbol {
+				nonce = book.Nonce
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("wait order book timeout")
+		}
+	}
+	// 推送有断档的增量，快照无法衔接，重新同步持续重试
+	gap := map[string]interface{}{"e": "depthUpdate", "E": 1, "T": 1, "s": "ETHUSDT", "U": nonce + 10,
+		"u": nonce + 11, "pu": nonce + 9, "b": [][2]string{}, "a": [][2]string{}}
+	syncing := func() bool {
+		exg.bookLock.Lock()
+		defer exg.bookLock.Unlock()
+		return exg.bookSyncing[symbol]
+	}
+	hasGap := func() bool {
+		stat := exg.GetOdBookStat(symbol)
+		return stat != nil && stat.Gaps > 0
+	}
+	deadline := time.Now().Add(time.Second * 5)
+	for !hasGap() && time.Now().Before(deadline) {
+		srv.Push(mar, "ethusdt@depth", gap)
+		time.Sleep(time.Millisecond * 50)
+	}
+	if !hasGap() {
+		t.Fatal("gap not detected")
+	}
+	if err = exg.UnWatchOrderBooks([]string{symbol}, nil); err != nil {
+		t.Fatal(err)
+	}
+	// 取消订阅后重新同步应停止
+	deadline = time.Now().Add(time.Second * 5)
+	for syncing() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 50)
+	}
+	if syncing() {
+		t.Error("resync should stop after unwatch")
+	}
+}
+
+func TestFakeBookSnapLevels(t *testing.T) {
+	exg, srv := newFakeBinance(t, "fakeSecret", nil)
+	defer srv.Close()
+	symbols, mar := []string{"ETH/USDT:USDT"}, base.MarketLinear
+	out5, err := exg.WatchOrderBookSnapshots(symbols, 5, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out10, err := exg.WatchOrderBookSnapshots(symbols, 10, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out5 == out10 {
+		t.Fatal("each level should have its own chan")
+	}
+	msg := map[string]interface{}{"e": "depthUpdate", "E": 1571889248277, "s": "ETHUSDT", "u": 2,
+		"b": [][2]string{{"2000", "1"}}, "a": [][2]string{{"2001", "1"}}}
+	depths := map[int]bool{}
+	timeout := time.After(time.Second * 5)
+	for len(depths) < 2 {
+		srv.Push(mar, "ethusdt@depth5", msg)
+		srv.Push(mar, "ethusdt@depth10", msg)
+		select {
+		case book := <-out5:
+			if book.Asks.Depth != 5 {
+				t.Fatalf("depth5 chan got level %d", book.Asks.Depth)
+			}
+			depths[5] = true
+		case book := <-out10:
+			if book.Asks.Depth != 10 {
+				t.Fatalf("depth10 chan got level %d", book.Asks.Depth)
+			}
+			depths[10] = true
+		case <-time.After(time.Millisecond * 100):
+		case <-timeout:
+			t.Fatalf("wait both levels timeout, got: %v", depths)
+		}
+	}
+	if err = exg.UnWatchOrderBookSnapshots(symbols, nil); err != nil {
+		t.Fatal(err)
+	}
+	exg.streamLock.Lock()
+	left := len(exg.streamPools[mar].byStream)
+	exg.streamLock.Unlock()
+	if left != 0 || len(exg.bookSnapStreams) != 0 {
+		t.Errorf("streams should be all unsubscribed, left %v", left)
+	}
+	// 所有档位的输出通道应被关闭
+	for _, out := range []chan base.OrderBook{out5, out10} {
+		closed := false
+		for !closed {
+			select {
+			case _, ok := <-out:
+				closed = !ok
+			case <-time.After(time.Second * 3):
+				t.Fatal("level chan should be closed after unwatch")
+			}
+		}
+	}
+}
+
+func TestFakeUserStreamDrop(t *testing.T) {
+	exg, srv := newFakeBinance(t, "fakeSecret", nil)
+	defer srv.Close()
+	symbol, mar := "ETH/USDT:USDT", base.MarketLinear
+	srv.SetBalance(mar, "USDT", 10000)
+	srv.SetBook(mar, "ETHUSDT", [][2]float64{{2000, 5}}, [][2]float64{{2001, 5}})
+	trades, err := exg.WatchMyTrades(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := srv.ListenKeys()
+	if len(keys) != 1 {
+		t.Fatalf("expect 1 listenKey, got %v", keys)
+	}
+	waitTrade := func() {
+		timeout := time.After(time.Second * 5)
+		clientIds := map[string]bool{}
+		for {
+			clientId := fmt.Sprintf("drop%d", time.Now().UnixNano())
+			clientIds[clientId] = true
+			args := map[string]interface{}{base.ParamClientOrderId: clientId}
+			if _, err := exg.CreateOrder(symbol, base.OdTypeMarket, base.OdSideBuy, 0.01, 0, &args); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case trade, ok := <-trades:
+				if !ok {
+					t.Fatal("my trades chan closed after user stream dropped")
+				}
+				if clientIds[trade.ClientID] {
+					return
+				}
+			case <-time.After(time.Millisecond * 300):
+			case <-timeout:
+				t.Fatal("wait my trade after reconnect timeout")
+			}
+		}
+	}
+	// 网络断开而非listenKey过期，订阅者应在重新打开后继续收到成交
+	srv.DropUserConns(keys[0])
+	waitTrade()
+	// 重新打开的连接再次断开
+	for _, key := range srv.ListenKeys() {
+		srv.DropUserConns(key)
+	}
+	waitTrade()
+	// 关闭交易所后服务器断开不再重新打开
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	if err = exg.Close(ctx); err != nil {
+		t.Error(err)
+	}
+}
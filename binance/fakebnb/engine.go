@@ -0,0 +1,696 @@
+package fakebnb
+
+import (
+	"github.com/banbox/banexg/base"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+book
+模拟的订单簿，只保存市场深度；未成交的挂单不计入深度，行情变动后与挂单撮合
+*/
+type book struct {
+	bids     map[float64]float64 // price: amount
+	asks     map[float64]float64
+	updateId int64
+}
+
+type order struct {
+	ID          int64
+	Symbol      string
+	ClientID    string
+	Side        string // BUY/SELL
+	Type        string // LIMIT/MARKET
+	TimeInForce string
+	PosSide     string
+	ReduceOnly  bool
+	Price       float64
+	Amount      float64
+	Filled      float64
+	Cost        float64
+	Status      string
+	Time        int64
+	UpdateTime  int64
+}
+
+type position struct {
+	Amount     float64 // 正数多头，负数空头
+	EntryPrice float64
+	Leverage   int
+}
+
+type fill struct {
+	price  float64
+	amount float64
+	maker  bool
+}
+
+func nowMS() int64 {
+	return time.Now().UnixMilli()
+}
+
+func fmtNum(val float64) string {
+	return strconv.FormatFloat(val, 'f', -1, 64)
+}
+
+func isContract(marketType string) bool {
+	return marketType == base.MarketLinear || marketType == base.MarketInverse
+}
+
+func (s *Server) getBook(marketType, symbol string) *book {
+	key := marketType + ":" + symbol
+	b, ok := s.books[key]
+	if !ok {
+		b = &book{bids: map[float64]float64{}, asks: map[float64]float64{}, updateId: 1}
+		s.books[key] = b
+	}
+	return b
+}
+
+func sortedLevels(side map[float64]float64, desc bool) [][2]float64 {
+	res := make([][2]float64, 0, len(side))
+	for p, a := range side {
+		res = append(res, [2]float64{p, a})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if desc {
+			return res[i][0] > res[j][0]
+		}
+		return res[i][0] < res[j][0]
+	})
+	return res
+}
+
+func levelsText(levels [][2]float64) [][2]string {
+	res := make([][2]string, len(levels))
+	for i, l := range levels {
+		res[i] = [2]string{fmtNum(l[0]), fmtNum(l[1])}
+	}
+	return res
+}
+
+/*
+SetBalance
+设置某个市场的资产余额，现货为可用数量，合约为钱包余额
+*/
+func (s *Server) SetBalance(marketType, asset string, amount float64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	bals, ok := s.balances[marketType]
+	if !ok {
+		bals = map[string]float64{}
+		s.balances[marketType] = bals
+	}
+	bals[asset] = amount
+}
+
+/*
+Balance
+返回某个市场的资产余额
+*/
+func (s *Server) Balance(marketType, asset string) float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.balances[marketType][asset]
+}
+
+/*
+Position
+返回合约品种的持仓数量，正数多头，负数空头
+*/
+func (s *Server) Position(marketType, symbol string) float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if pos, ok := s.positions[marketType][symbol]; ok {
+		return pos.Amount
+	}
+	return 0
+}
+
+/*
+SetBook
+设置订单簿快照，不推送增量
+*/
+func (s *Server) SetBook(marketType, symbol string, bids, asks [][2]float64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b := s.getBook(marketType, symbol)
+	b.bids = map[float64]float64{}
+	b.asks = map[float64]float64{}
+	applyLevels(b.bids, bids)
+	applyLevels(b.asks, asks)
+	b.updateId += 1
+}
+
+func applyLevels(side map[float64]float64, levels [][2]float64) {
+	for _, l := range levels {
+		if l[1] <= 0 {
+			delete(side, l[0])
+		} else {
+			side[l[0]] = l[1]
+		}
+	}
+}
+
+/*
+UpdateBook
+更新订单簿，数量为0表示删除此价格。推送depthUpdate增量给订阅者，并撮合价格穿越的挂单
+*/
+func (s *Server) UpdateBook(marketType, symbol string, bids, asks [][2]float64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b := s.getBook(marketType, symbol)
+	applyLevels(b.bids, bids)
+	applyLevels(b.asks, asks)
+	s.pushDepth(marketType, symbol, b, bids, asks)
+	s.matchOpenOrders(marketType, symbol, b)
+}
+
+func (s *Server) pushDepth(marketType, symbol string, b *book, bids, asks [][2]float64) {
+	prevId := b.updateId
+	b.updateId += 1
+	stamp := nowMS()
+	msg := map[string]interface{}{
+		"e": "depthUpdate",
+		"E": stamp,
+		"s": symbol,
+		"U": prevId + 1,
+		"u": b.updateId,
+		"b": levelsText(bids),
+		"a": levelsText(asks),
+	}
+	if isContract(marketType) {
+		msg["T"] = stamp
+		msg["pu"] = prevId
+	}
+	s.pushStream(marketType, strings.ToLower(symbol)+"@depth", msg)
+}
+
+func (s *Server) getDepth(marketType string, args url.Values) (interface{}, *apiError) {
+	symbol := args.Get("symbol")
+	if symbol == "" {
+		return nil, errNoSymbol
+	}
+	limit, _ := strconv.Atoi(args.Get("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b := s.getBook(marketType, symbol)
+	bids, asks := sortedLevels(b.bids, true), sortedLevels(b.asks, false)
+	if len(bids) > limit {
+		bids = bids[:limit]
+	}
+	if len(asks) > limit {
+		asks = asks[:limit]
+	}
+	res := map[string]interface{}{
+		"lastUpdateId": b.updateId,
+		"bids":         levelsText(bids),
+		"asks":         levelsText(asks),
+	}
+	if isContract(marketType) {
+		stamp := nowMS()
+		res["E"] = stamp
+		res["T"] = stamp
+		res["symbol"] = symbol
+	}
+	return res, nil
+}
+
+/*
+getPrice
+以订单簿买一卖一的中间价作为ticker/24hr的最新价和avgPrice的均价
+*/
+func (s *Server) getPrice(marketType, path string, args url.Values) (interface{}, *apiError) {
+	symbol := args.Get("symbol")
+	if symbol == "" {
+		return nil, errNoSymbol
+	}
+	s.lock.Lock()
+	b := s.getBook(marketType, symbol)
+	bids, asks := sortedLevels(b.bids, true), sortedLevels(b.asks, false)
+	s.lock.Unlock()
+	var price float64
+	if len(bids) > 0 && len(asks) > 0 {
+		price = (bids[0][0] + asks[0][0]) / 2
+	} else if len(bids) > 0 {
+		price = bids[0][0]
+	} else if len(asks) > 0 {
+		price = asks[0][0]
+	}
+	if path == "avgPrice" {
+		return map[string]interface{}{"mins": 5, "price": fmtNum(price)}, nil
+	}
+	res := map[string]interface{}{"symbol": symbol, "lastPrice": fmtNum(price), "closeTime": nowMS()}
+	if marketType == base.MarketInverse {
+		return []interface{}{res}, nil
+	}
+	return res, nil
+}
+
+/*
+takeLiquidity
+用订单簿对手盘撮合订单，limitPrice<=0表示市价。会扣减深度并推送增量
+*/
+func (s *Server) takeLiquidity(marketType string, od *order, b *book, limitPrice float64, maker bool) []*fill {
+	var side map[float64]float64
+	var levels [][2]float64
+	isBuy := od.Side == "BUY"
+	if isBuy {
+		side, levels = b.asks, sortedLevels(b.asks, false)
+	} else {
+		side, levels = b.bids, sortedLevels(b.bids, true)
+	}
+	fills := make([]*fill, 0)
+	changed := make([][2]float64, 0)
+	for _, l := range levels {
+		rest := od.Amount - od.Filled
+		if rest <= 0 {
+			break
+		}
+		if limitPrice > 0 && (isBuy && l[0] > limitPrice || !isBuy && l[0] < limitPrice) {
+			break
+		}
+		amount := min(rest, l[1])
+		price := l[0]
+		if maker {
+			price = limitPrice
+		}
+		side[l[0]] = l[1] - amount
+		if side[l[0]] <= 0 {
+			delete(side, l[0])
+		}
+		changed = append(changed, [2]float64{l[0], side[l[0]]})
+		od.Filled += amount
+		od.Cost += amount * price
+		fills = append(fills, &fill{price: price, amount: amount, maker: maker})
+	}
+	if len(changed) > 0 {
+		if isBuy {
+			s.pushDepth(marketType, od.Symbol, b, nil, changed)
+		} else {
+			s.pushDepth(marketType, od.Symbol, b, changed, nil)
+		}
+	}
+	return fills
+}
+
+func (s *Server) createOrder(marketType string, args url.Values) (interface{}, *apiError) {
+	symbol := args.Get("symbol")
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.infos[marketType]) > 0 {
+		if _, ok := s.symbols[marketType+":"+symbol]; !ok {
+			return nil, errNoSymbol
+		}
+	} else if symbol == "" {
+		return nil, errNoSymbol
+	}
+	amount, _ := strconv.ParseFloat(args.Get("quantity"), 64)
+	price, _ := strconv.ParseFloat(args.Get("price"), 64)
+	if amount <= 0 {
+		return nil, &apiError{status: 400, Code: -1102, Msg: "Mandatory parameter 'quantity' was not sent, was empty/null, or malformed."}
+	}
+	s.nextId += 1
+	stamp := nowMS()
+	od := &order{
+		ID:          s.nextId,
+		Symbol:      symbol,
+		ClientID:    args.Get("newClientOrderId"),
+		Side:        strings.ToUpper(args.Get("side")),
+		Type:        strings.ToUpper(args.Get("type")),
+		TimeInForce: args.Get("timeInForce"),
+		PosSide:     args.Get("positionSide"),
+		ReduceOnly:  args.Get("reduceOnly") == "true",
+		Price:       price,
+		Amount:      amount,
+		Status:      "NEW",
+		Time:        stamp,
+		UpdateTime:  stamp,
+	}
+	if od.ClientID == "" {
+		od.ClientID = "fake" + strconv.FormatInt(od.ID, 10)
+	}
+	if od.Type == "LIMIT" && od.TimeInForce == "" {
+		od.TimeInForce = "GTC"
+	}
+	if isContract(marketType) && od.PosSide == "" {
+		od.PosSide = "BOTH"
+	}
+	s.orders[marketType] = append(s.orders[marketType], od)
+	s.pushOrder(marketType, od, "NEW", nil)
+	limitPrice := od.Price
+	if od.Type == "MARKET" {
+		limitPrice = 0
+	}
+	fills := s.takeLiquidity(marketType, od, s.getBook(marketType, symbol), limitPrice, false)
+	s.applyFills(marketType, od, fills)
+	if od.Filled < od.Amount && (od.Type == "MARKET" || od.TimeInForce == "IOC" || od.TimeInForce == "FOK") {
+		od.Status = "EXPIRED"
+		s.pushOrder(marketType, od, "EXPIRED", nil)
+	}
+	return s.orderRsp(marketType, od, fills), nil
+}
+
+/*
+matchOpenOrders
+深度变化后，撮合价格已穿越的挂单，按挂单价格以maker成交
+*/
+func (s *Server) matchOpenOrders(marketType, symbol string, b *book) {
+	for _, od := range s.orders[marketType] {
+		if od.Symbol != symbol || od.Status != "NEW" && od.Status != "PARTIALLY_FILLED" {
+			continue
+		}
+		fills := s.takeLiquidity(marketType, od, b, od.Price, true)
+		s.applyFills(marketType, od, fills)
+	}
+}
+
+/*
+applyFills
+更新订单状态、余额和持仓，并推送用户数据流
+*/
+func (s *Server) applyFills(marketType string, od *order, fills []*fill) {
+	if len(fills) == 0 {
+		return
+	}
+	sym := s.symbols[marketType+":"+od.Symbol]
+	for _, f := range fills {
+		od.UpdateTime = nowMS()
+		if od.Filled >= od.Amount {
+			od.Status = "FILLED"
+		} else {
+			od.Status = "PARTIALLY_FILLED"
+		}
+		s.nextId += 1
+		s.pushOrder(marketType, od, "TRADE", &tradeInfo{fill: f, id: s.nextId})
+		if sym == nil {
+			continue
+		}
+		if isContract(marketType) {
+			s.updatePosition(marketType, od, f, sym)
+		} else {
+			s.updateSpotBalance(marketType, od, f, sym)
+		}
+	}
+}
+
+func (s *Server) updateSpotBalance(marketType string, od *order, f *fill, sym *symbolInfo) {
+	bals, ok := s.balances[marketType]
+	if !ok {
+		bals = map[string]float64{}
+		s.balances[marketType] = bals
+	}
+	cost := f.price * f.amount
+	if od.Side == "BUY" {
+		bals[sym.Base] += f.amount
+		bals[sym.Quote] -= cost
+	} else {
+		bals[sym.Base] -= f.amount
+		bals[sym.Quote] += cost
+	}
+	s.pushAccount(marketType, map[string]interface{}{
+		"e": "outboundAccountPosition",
+		"E": nowMS(),
+		"u": nowMS(),
+		"B": []map[string]string{
+			{"a": sym.Base, "f": fmtNum(bals[sym.Base]), "l": "0"},
+			{"a": sym.Quote, "f": fmtNum(bals[sym.Quote]), "l": "0"},
+		},
+	})
+}
+
+func (s *Server) updatePosition(marketType string, od *order, f *fill, sym *symbolInfo) {
+	poses, ok := s.positions[marketType]
+	if !ok {
+		poses = map[string]*position{}
+		s.positions[marketType] = poses
+	}
+	pos, ok := poses[od.Symbol]
+	if !ok {
+		pos = &position{Leverage: 20}
+		poses[od.Symbol] = pos
+	}
+	delta := f.amount
+	if od.Side == "SELL" {
+		delta = -delta
+	}
+	newAmt := pos.Amount + delta
+	if pos.Amount == 0 || pos.Amount*delta > 0 {
+		// 开仓或加仓，更新均价
+		pos.EntryPrice = (pos.EntryPrice*abs(pos.Amount) + f.price*f.amount) / abs(newAmt)
+	} else if newAmt*pos.Amount < 0 {
+		// 反向开仓
+		pos.EntryPrice = f.price
+	} else if newAmt == 0 {
+		pos.EntryPrice = 0
+	}
+	pos.Amount = newAmt
+	asset := sym.Margin
+	if asset == "" {
+		asset = sym.Quote
+	}
+	wallet := fmtNum(s.balances[marketType][asset])
+	s.pushAccount(marketType, map[string]interface{}{
+		"e": "ACCOUNT_UPDATE",
+		"E": nowMS(),
+		"T": nowMS(),
+		"a": map[string]interface{}{
+			"m": "ORDER",
+			"B": []map[string]string{{"a": asset, "wb": wallet, "cw": wallet, "bc": "0"}},
+			"P": []map[string]string{{
+				"s":  od.Symbol,
+				"pa": fmtNum(pos.Amount),
+				"ep": fmtNum(pos.EntryPrice),
+				"cr": "0",
+				"up": "0",
+				"mt": "cross",
+				"iw": "0",
+				"ps": od.PosSide,
+			}},
+		},
+	})
+}
+
+func abs(val float64) float64 {
+	if val < 0 {
+		return -val
+	}
+	return val
+}
+
+func (s *Server) findOrder(marketType string, args url.Values) *order {
+	orderId, _ := strconv.ParseInt(args.Get("orderId"), 10, 64)
+	clientId := args.Get("origClientOrderId")
+	symbol := args.Get("symbol")
+	for _, od := range s.orders[marketType] {
+		if od.Symbol != symbol {
+			continue
+		}
+		if orderId > 0 && od.ID == orderId || clientId != "" && od.ClientID == clientId {
+			return od
+		}
+	}
+	return nil
+}
+
+func (s *Server) getOrder(marketType string, args url.Values) (interface{}, *apiError) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	od := s.findOrder(marketType, args)
+	if od == nil {
+		return nil, errNoOrder
+	}
+	return s.orderRsp(marketType, od, nil), nil
+}
+
+func (s *Server) cancelOrder(marketType string, args url.Values) (interface{}, *apiError) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	od := s.findOrder(marketType, args)
+	if od == nil || od.Status != "NEW" && od.Status != "PARTIALLY_FILLED" {
+		return nil, errCancel
+	}
+	od.Status = "CANCELED"
+	od.UpdateTime = nowMS()
+	s.pushOrder(marketType, od, "CANCELED", nil)
+	return s.orderRsp(marketType, od, nil), nil
+}
+
+func (s *Server) getOpenOrders(marketType string, args url.Values) interface{} {
+	symbol := args.Get("symbol")
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	res := make([]interface{}, 0)
+	for _, od := range s.orders[marketType] {
+		if symbol != "" && od.Symbol != symbol || od.Status != "NEW" && od.Status != "PARTIALLY_FILLED" {
+			continue
+		}
+		res = append(res, s.orderRsp(marketType, od, nil))
+	}
+	return res
+}
+
+func (s *Server) orderRsp(marketType string, od *order, fills []*fill) map[string]interface{} {
+	avgPrice := float64(0)
+	if od.Filled > 0 {
+		avgPrice = od.Cost / od.Filled
+	}
+	res := map[string]interface{}{
+		"symbol":        od.Symbol,
+		"orderId":       od.ID,
+		"clientOrderId": od.ClientID,
+		"price":         fmtNum(od.Price),
+		"origQty":       fmtNum(od.Amount),
+		"executedQty":   fmtNum(od.Filled),
+		"status":        od.Status,
+		"timeInForce":   od.TimeInForce,
+		"type":          od.Type,
+		"side":          od.Side,
+		"time":          od.Time,
+		"updateTime":    od.UpdateTime,
+	}
+	if isContract(marketType) {
+		res["avgPrice"] = fmtNum(avgPrice)
+		res["cumQty"] = fmtNum(od.Filled)
+		res["cumQuote"] = fmtNum(od.Cost)
+		res["positionSide"] = od.PosSide
+		res["reduceOnly"] = od.ReduceOnly
+		res["origType"] = od.Type
+		return res
+	}
+	res["transactTime"] = od.UpdateTime
+	res["cummulativeQuoteQty"] = fmtNum(od.Cost)
+	res["orderListId"] = -1
+	resFills := make([]map[string]interface{}, 0, len(fills))
+	for _, f := range fills {
+		resFills = append(resFills, map[string]interface{}{
+			"price":           fmtNum(f.price),
+			"qty":             fmtNum(f.amount),
+			"commission":      "0",
+			"commissionAsset": s.quoteAsset(marketType, od.Symbol),
+		})
+	}
+	res["fills"] = resFills
+	return res
+}
+
+func (s *Server) quoteAsset(marketType, symbol string) string {
+	if sym, ok := s.symbols[marketType+":"+symbol]; ok {
+		return sym.Quote
+	}
+	return ""
+}
+
+func (s *Server) getAccount(marketType, path string) interface{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stamp := nowMS()
+	bals := s.balances[marketType]
+	if !isContract(marketType) {
+		items := make([]map[string]string, 0, len(bals))
+		for asset, free := range bals {
+			items = append(items, map[string]string{"asset": asset, "free": fmtNum(free), "locked": "0"})
+		}
+		return map[string]interface{}{
+			"canTrade":    true,
+			"canDeposit":  true,
+			"canWithdraw": true,
+			"accountType": "SPOT",
+			"updateTime":  stamp,
+			"balances":    items,
+			"permissions": []string{"SPOT"},
+		}
+	}
+	assets := make([]map[string]interface{}, 0, len(bals))
+	for asset, amt := range bals {
+		text := fmtNum(amt)
+		assets = append(assets, map[string]interface{}{
+			"asset":              asset,
+			"walletBalance":      text,
+			"marginBalance":      text,
+			"crossWalletBalance": text,
+			"availableBalance":   text,
+			"maxWithdrawAmount":  text,
+			"unrealizedProfit":   "0",
+			"crossUnPnl":         "0",
+			"updateTime":         stamp,
+		})
+	}
+	if path == "balance" {
+		for _, item := range assets {
+			item["balance"] = item["walletBalance"]
+		}
+		return assets
+	}
+	positions := make([]map[string]interface{}, 0)
+	for symbol, pos := range s.positions[marketType] {
+		positions = append(positions, map[string]interface{}{
+			"symbol":           symbol,
+			"positionAmt":      fmtNum(pos.Amount),
+			"entryPrice":       fmtNum(pos.EntryPrice),
+			"leverage":         strconv.Itoa(pos.Leverage),
+			"positionSide":     "BOTH",
+			"unrealizedProfit": "0",
+			"isolated":         false,
+			"updateTime":       stamp,
+		})
+	}
+	return map[string]interface{}{
+		"canTrade":    true,
+		"canDeposit":  true,
+		"canWithdraw": true,
+		"updateTime":  stamp,
+		"assets":      assets,
+		"positions":   positions,
+	}
+}
+
+func (s *Server) getPositionRisk(marketType string, args url.Values) interface{} {
+	symbol := args.Get("symbol")
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	res := make([]map[string]interface{}, 0)
+	for sym, pos := range s.positions[marketType] {
+		if symbol != "" && sym != symbol {
+			continue
+		}
+		res = append(res, map[string]interface{}{
+			"symbol":           sym,
+			"positionAmt":      fmtNum(pos.Amount),
+			"entryPrice":       fmtNum(pos.EntryPrice),
+			"markPrice":        fmtNum(pos.EntryPrice),
+			"leverage":         strconv.Itoa(pos.Leverage),
+			"notional":         fmtNum(pos.Amount * pos.EntryPrice),
+			"marginType":       "cross",
+			"positionSide":     "BOTH",
+			"unRealizedProfit": "0",
+			"liquidationPrice": "0",
+			"updateTime":       nowMS(),
+		})
+	}
+	return res
+}
+
+func (s *Server) setLeverage(marketType string, args url.Values) (interface{}, *apiError) {
+	symbol := args.Get("symbol")
+	leverage, err := strconv.Atoi(args.Get("leverage"))
+	if err != nil || leverage < 1 {
+		return nil, &apiError{status: 400, Code: -4028, Msg: "Leverage is not valid"}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.symbols[marketType+":"+symbol]; !ok {
+		return nil, errNoSymbol
+	}
+	if pos, ok := s.positions[marketType][symbol]; ok {
+		pos.Leverage = leverage
+	}
+	return map[string]interface{}{"symbol": symbol, "leverage": leverage, "maxNotionalValue": "INF"}, nil
+}
@@ -0,0 +1,421 @@
+/*
+Package fakebnb
+进程内的币安模拟服务器，用httptest提供REST和websocket接口，可在无网络时运行端到端测试。
+
+支持现货/U本位/币本位合约的主要接口：exchangeInfo、depth、下单撤单查单、账户余额持仓、杠杆分层和调整杠杆、期权标记价格、
+listenKey和用户数据流、组合流订阅和深度增量推送。私有接口会校验ApiKey和HMAC签名。
+订单与当前深度撮合，成交后推送executionReport/ORDER_TRADE_UPDATE和余额持仓变动。
+
+此包不依赖binance包，binance的测试中可直接引用，避免循环导入。
+*/
+package fakebnb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/banbox/banexg/base"
+	"github.com/bytedance/sonic"
+	"github.com/gorilla/websocket"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+/*
+Server
+模拟的币安服务器。通过Hosts()返回的地址替换交易所的ExgHosts即可使用：
+
+	srv := fakebnb.NewServer("key", "secret")
+	defer srv.Close()
+	exg.Hosts.Prod = srv.Hosts()
+*/
+type Server struct {
+	ApiKey string
+	Secret string
+
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+	lock     sync.Mutex
+
+	infos       map[string][]byte               // marketType: exchangeInfo
+	currencies  []byte                          // sapi capital/config/getall
+	optMarks    []byte                          // eapi mark
+	lvgBrackets map[string][]byte               // marketType: leverageBracket
+	symbols     map[string]*symbolInfo          // marketType:symbol
+	books       map[string]*book                // marketType:symbol
+	orders      map[string][]*order             // marketType: orders
+	balances    map[string]map[string]float64   // marketType: asset: free
+	positions   map[string]map[string]*position // marketType: symbol: position
+	listenKeys  map[string]string               // listenKey: marketType
+	conns       map[*wsConn]struct{}
+	nextId      int64
+}
+
+type symbolInfo struct {
+	Symbol string `json:"symbol"`
+	Base   string `json:"baseAsset"`
+	Quote  string `json:"quoteAsset"`
+	Margin string `json:"marginAsset"`
+}
+
+type apiError struct {
+	status int
+	Code   int    `json:"code"`
+	Msg    string `json:"msg"`
+}
+
+var (
+	errApiKey     = &apiError{status: 401, Code: -2015, Msg: "Invalid API-key, IP, or permissions for action."}
+	errSignature  = &apiError{status: 400, Code: -1022, Msg: "Signature for this request is not valid."}
+	errNoSymbol   = &apiError{status: 400, Code: -1121, Msg: "Invalid symbol."}
+	errNoOrder    = &apiError{status: 400, Code: -2013, Msg: "Order does not exist."}
+	errCancel     = &apiError{status: 400, Code: -2011, Msg: "Unknown order sent."}
+	errListenKey  = &apiError{status: 400, Code: -1125, Msg: "This listenKey does not exist."}
+	errNotSupport = &apiError{status: 404, Code: -1000, Msg: "endpoint not supported by fake server"}
+)
+
+/*
+NewServer
+创建并启动模拟服务器，私有接口需使用apiKey和secret签名
+*/
+func NewServer(apiKey, secret string) *Server {
+	s := &Server{
+		ApiKey:      apiKey,
+		Secret:      secret,
+		infos:       map[string][]byte{},
+		currencies:  []byte("[]"),
+		optMarks:    []byte("[]"),
+		lvgBrackets: map[string][]byte{},
+		symbols:     map[string]*symbolInfo{},
+		books:       map[string]*book{},
+		orders:      map[string][]*order{},
+		balances:    map[string]map[string]float64{},
+		positions:   map[string]map[string]*position{},
+		listenKeys:  map[string]string{},
+		conns:       map[*wsConn]struct{}{},
+	}
+	s.srv = httptest.NewServer(s)
+	return s
+}
+
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+/*
+Hosts
+返回所有接口指向此服务器的地址，key与binance.HostPublic等常量相同，可直接赋值给ExgHosts.Prod或Test
+*/
+func (s *Server) Hosts() map[string]string {
+	h := s.srv.URL
+	w := "ws" + strings.TrimPrefix(h, "http")
+	return map[string]string{
+		"public":           h + "/api/v3",
+		"private":          h + "/api/v3",
+		"v1":               h + "/api/v1",
+		"sapi":             h + "/sapi/v1",
+		"sapiV2":           h + "/sapi/v2",
+		"sapiV3":           h + "/sapi/v3",
+		"sapiV4":           h + "/sapi/v4",
+		"fapiPublic":       h + "/fapi/v1",
+		"fapiPublicV2":     h + "/fapi/v2",
+		"fapiPrivate":      h + "/fapi/v1",
+		"fapiPrivateV2":    h + "/fapi/v2",
+		"fapiData":         h + "/futures/data",
+		"dapiPublic":       h + "/dapi/v1",
+		"dapiPrivate":      h + "/dapi/v1",
+		"dapiPrivateV2":    h + "/dapi/v2",
+		"dapiData":         h + "/futures/data",
+		"eapiPublic":       h + "/eapi/v1",
+		"eapiPrivate":      h + "/eapi/v1",
+		"papi":             h + "/papi/v1",
+		base.MarketSpot:    w + "/spot/ws",
+		base.MarketMargin:  w + "/spot/ws",
+		base.MarketLinear:  w + "/fstream/ws",
+		base.MarketInverse: w + "/dstream/ws",
+		base.MarketOption:  w + "/eoptions/ws",
+		"ws":               w + "/ws-api/v3",
+	}
+}
+
+/*
+Close
+断开所有websocket连接并停止服务器
+*/
+func (s *Server) Close() {
+	s.lock.Lock()
+	for c := range s.conns {
+		c.close()
+	}
+	s.lock.Unlock()
+	s.srv.CloseClientConnections()
+	s.srv.Close()
+}
+
+/*
+SetExchangeInfo
+设置某个市场exchangeInfo接口的返回内容，其中的symbols用于校验下单品种和计算余额变动
+*/
+func (s *Server) SetExchangeInfo(marketType string, data []byte) error {
+	var info struct {
+		Symbols       []*symbolInfo `json:"symbols"`
+		OptionSymbols []*symbolInfo `json:"optionSymbols"`
+	}
+	if err := sonic.Unmarshal(data, &info); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.infos[marketType] = data
+	for _, item := range append(info.Symbols, info.OptionSymbols...) {
+		s.symbols[marketType+":"+item.Symbol] = item
+	}
+	return nil
+}
+
+/*
+SetOptionMarks
+设置eapi/v1/mark的返回内容，默认为空列表
+*/
+func (s *Server) SetOptionMarks(data []byte) {
+	s.lock.Lock()
+	s.optMarks = data
+	s.lock.Unlock()
+}
+
+/*
+SetLeverageBrackets
+设置合约leverageBracket的返回内容，默认为空列表
+*/
+func (s *Server) SetLeverageBrackets(marketType string, data []byte) {
+	s.lock.Lock()
+	s.lvgBrackets[marketType] = data
+	s.lock.Unlock()
+}
+
+/*
+SetCurrencies
+设置sapi/v1/capital/config/getall的返回内容，默认为空列表
+*/
+func (s *Server) SetCurrencies(data []byte) {
+	s.lock.Lock()
+	s.currencies = data
+	s.lock.Unlock()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.SplitN(path, "/", 3)
+	if len(parts) >= 2 && websocket.IsWebSocketUpgrade(r) {
+		s.serveWs(w, r, parts)
+		return
+	}
+	if len(parts) < 3 {
+		writeError(w, errNotSupport)
+		return
+	}
+	var marketType string
+	switch parts[0] {
+	case "api":
+		marketType = base.MarketSpot
+	case "fapi":
+		marketType = base.MarketLinear
+	case "dapi":
+		marketType = base.MarketInverse
+	case "sapi":
+		marketType = base.MarketMargin
+	case "eapi":
+		marketType = base.MarketOption
+	default:
+		writeError(w, errNotSupport)
+		return
+	}
+	raw := r.URL.RawQuery
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		body, _ := io.ReadAll(r.Body)
+		if len(body) > 0 {
+			raw = string(body)
+		}
+	}
+	args, _ := url.ParseQuery(raw)
+	res, err := s.handleApi(r, marketType, parts[2], raw, args)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	data, _ := sonic.Marshal(res)
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, err *apiError) {
+	data, _ := sonic.Marshal(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.status)
+	_, _ = w.Write(data)
+}
+
+/*
+checkSign
+校验ApiKey和HMAC-SHA256签名，签名内容为signature参数之前的查询字符串或请求体
+*/
+func (s *Server) checkSign(r *http.Request, raw string) *apiError {
+	if r.Header.Get("X-MBX-APIKEY") != s.ApiKey {
+		return errApiKey
+	}
+	idx := strings.LastIndex(raw, "&signature=")
+	if idx < 0 {
+		return errSignature
+	}
+	mac := hmac.New(sha256.New, []byte(s.Secret))
+	mac.Write([]byte(raw[:idx]))
+	if raw[idx+len("&signature="):] != hex.EncodeToString(mac.Sum(nil)) {
+		return errSignature
+	}
+	return nil
+}
+
+func (s *Server) handleApi(r *http.Request, marketType, path, raw string, args url.Values) (interface{}, *apiError) {
+	method := r.Method
+	switch path {
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "time":
+		return map[string]int64{"serverTime": nowMS()}, nil
+	case "exchangeInfo":
+		s.lock.Lock()
+		data, ok := s.infos[marketType]
+		s.lock.Unlock()
+		if !ok {
+			data = []byte(`{"timezone":"UTC","symbols":[]}`)
+		}
+		return json.RawMessage(data), nil
+	case "depth":
+		return s.getDepth(marketType, args)
+	case "ticker/24hr", "avgPrice":
+		return s.getPrice(marketType, path, args)
+	case "mark":
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return json.RawMessage(s.optMarks), nil
+	case "userDataStream", "listenKey":
+		if r.Header.Get("X-MBX-APIKEY") != s.ApiKey {
+			return nil, errApiKey
+		}
+		return s.handleListenKey(marketType, method, args)
+	}
+	if err := s.checkSign(r, raw); err != nil {
+		return nil, err
+	}
+	switch path {
+	case "capital/config/getall":
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return json.RawMessage(s.currencies), nil
+	case "account", "balance":
+		return s.getAccount(marketType, path), nil
+	case "positionRisk":
+		return s.getPositionRisk(marketType, args), nil
+	case "leverageBracket":
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		data, ok := s.lvgBrackets[marketType]
+		if !ok {
+			data = []byte("[]")
+		}
+		return json.RawMessage(data), nil
+	case "leverage":
+		if method == http.MethodPost {
+			return s.setLeverage(marketType, args)
+		}
+	case "openOrders":
+		return s.getOpenOrders(marketType, args), nil
+	case "order":
+		switch method {
+		case http.MethodPost:
+			return s.createOrder(marketType, args)
+		case http.MethodGet:
+			return s.getOrder(marketType, args)
+		case http.MethodDelete:
+			return s.cancelOrder(marketType, args)
+		}
+	}
+	return nil, errNotSupport
+}
+
+func (s *Server) handleListenKey(marketType, method string, args url.Values) (interface{}, *apiError) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch method {
+	case http.MethodPost:
+		s.nextId += 1
+		key := fmt.Sprintf("fakeListenKey%d", s.nextId)
+		s.listenKeys[key] = marketType
+		return map[string]string{"listenKey": key}, nil
+	case http.MethodPut:
+		key := args.Get("listenKey")
+		if key == "" {
+			// 合约的listenKey续期不传参数
+			return map[string]interface{}{}, nil
+		}
+		if _, ok := s.listenKeys[key]; !ok {
+			return nil, errListenKey
+		}
+		return map[string]interface{}{}, nil
+	case http.MethodDelete:
+		key := args.Get("listenKey")
+		for k, mar := range s.listenKeys {
+			if k == key || key == "" && mar == marketType {
+				delete(s.listenKeys, k)
+				s.closeUserConns(k)
+			}
+		}
+		return map[string]interface{}{}, nil
+	}
+	return nil, errNotSupport
+}
+
+/*
+ExpireListenKey
+使listenKey失效，推送listenKeyExpired事件并断开对应的用户数据流
+*/
+func (s *Server) ExpireListenKey(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.listenKeys, key)
+	s.pushUser(key, map[string]interface{}{
+		"e": "listenKeyExpired",
+		"E": nowMS(),
+	})
+	s.closeUserConns(key)
+}
+
+/*
+DropUserConns
+断开listenKey对应的用户数据流连接，不推送事件，listenKey仍有效，用于模拟网络断开
+*/
+func (s *Server) DropUserConns(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closeUserConns(key)
+}
+
+/*
+ListenKeys
+返回当前有效的listenKey
+*/
+func (s *Server) ListenKeys() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	res := make([]string, 0, len(s.listenKeys))
+	for k := range s.listenKeys {
+		res = append(res, k)
+	}
+	return res
+}
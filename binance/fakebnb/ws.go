@@ -0,0 +1,306 @@
+package fakebnb
+
+import (
+	"github.com/banbox/banexg/base"
+	"github.com/bytedance/sonic"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+/*
+wsConn
+模拟服务器上的一个websocket连接，公共行情连接保存订阅的stream，用户数据流连接保存listenKey
+*/
+type wsConn struct {
+	conn       *websocket.Conn
+	marketType string
+	listenKey  string
+	combined   bool            // 组合流，消息包装为{"stream":..,"data":..}
+	streams    map[string]bool // 已订阅的stream
+	send       chan []byte
+	closing    chan struct{} // 关闭后发送完已有消息再断开
+	once       sync.Once
+}
+
+func (c *wsConn) close() {
+	c.once.Do(func() {
+		close(c.closing)
+	})
+}
+
+func (c *wsConn) writeLoop() {
+	defer c.conn.Close()
+	for {
+		select {
+		case data := <-c.send:
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-c.closing:
+			for len(c.send) > 0 {
+				_ = c.conn.WriteMessage(websocket.TextMessage, <-c.send)
+			}
+			exitData := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+			_ = c.conn.WriteMessage(websocket.CloseMessage, exitData)
+			return
+		}
+	}
+}
+
+var wsMarkets = map[string]string{
+	"spot":     base.MarketSpot,
+	"fstream":  base.MarketLinear,
+	"dstream":  base.MarketInverse,
+	"eoptions": base.MarketOption,
+}
+
+/*
+serveWs
+路径格式：/fstream/ws、/fstream/stream、/fstream/ws/<listenKey>
+*/
+func (s *Server) serveWs(w http.ResponseWriter, r *http.Request, parts []string) {
+	marketType, ok := wsMarkets[parts[0]]
+	if !ok {
+		writeError(w, errNotSupport)
+		return
+	}
+	c := &wsConn{
+		marketType: marketType,
+		combined:   parts[1] == "stream",
+		streams:    map[string]bool{},
+		send:       make(chan []byte, 1024),
+		closing:    make(chan struct{}),
+	}
+	if len(parts) == 3 && parts[2] != "" {
+		s.lock.Lock()
+		_, ok = s.listenKeys[parts[2]]
+		s.lock.Unlock()
+		if !ok {
+			writeError(w, errListenKey)
+			return
+		}
+		c.listenKey = parts[2]
+	}
+	for _, stream := range strings.Split(r.URL.Query().Get("streams"), "/") {
+		if stream != "" {
+			c.streams[stream] = true
+		}
+	}
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c.conn = conn
+	s.lock.Lock()
+	s.conns[c] = struct{}{}
+	s.lock.Unlock()
+	go c.writeLoop()
+	defer func() {
+		s.lock.Lock()
+		delete(s.conns, c)
+		s.lock.Unlock()
+		c.close()
+	}()
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.handleWsReq(c, data)
+	}
+}
+
+type wsRequest struct {
+	ID     interface{} `json:"id"`
+	Method string      `json:"method"`
+	Params []string    `json:"params"`
+}
+
+func (s *Server) handleWsReq(c *wsConn, data []byte) {
+	var req wsRequest
+	if err := sonic.Unmarshal(data, &req); err != nil {
+		s.sendTo(c, "", map[string]interface{}{
+			"error": map[string]interface{}{"code": 3, "msg": "Invalid JSON"},
+		})
+		return
+	}
+	var result interface{}
+	s.lock.Lock()
+	switch req.Method {
+	case "SUBSCRIBE":
+		for _, stream := range req.Params {
+			c.streams[stream] = true
+		}
+	case "UNSUBSCRIBE":
+		for _, stream := range req.Params {
+			delete(c.streams, stream)
+		}
+	case "LIST_SUBSCRIPTIONS":
+		list := make([]string, 0, len(c.streams))
+		for stream := range c.streams {
+			list = append(list, stream)
+		}
+		result = list
+	default:
+		s.lock.Unlock()
+		s.sendTo(c, "", map[string]interface{}{
+			"id":    req.ID,
+			"error": map[string]interface{}{"code": 2, "msg": "Invalid request: unknown method"},
+		})
+		return
+	}
+	s.lock.Unlock()
+	s.sendTo(c, "", map[string]interface{}{"result": result, "id": req.ID})
+}
+
+type combinedMsg struct {
+	Stream string      `json:"stream"`
+	Data   interface{} `json:"data"`
+}
+
+func (s *Server) sendTo(c *wsConn, stream string, msg interface{}) {
+	if stream != "" && c.combined {
+		msg = &combinedMsg{Stream: stream, Data: msg}
+	}
+	data, err := sonic.Marshal(msg)
+	if err != nil {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+		// 客户端消费过慢，与币安一样断开连接
+		c.close()
+	}
+}
+
+/*
+subscribed
+stream是否被订阅；订阅xxx@depth@100ms等带速度后缀的也能收到xxx@depth的推送
+*/
+func (c *wsConn) subscribed(stream string) string {
+	if c.streams[stream] {
+		return stream
+	}
+	for sub := range c.streams {
+		if strings.HasPrefix(sub, stream+"@") {
+			return sub
+		}
+	}
+	return ""
+}
+
+/*
+Push
+推送行情消息给订阅了stream的公共连接，可用于模拟K线、成交等任意行情，需已持有锁时用pushStream
+*/
+func (s *Server) Push(marketType, stream string, msg interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.pushStream(marketType, stream, msg)
+}
+
+func (s *Server) pushStream(marketType, stream string, msg interface{}) {
+	for c := range s.conns {
+		if c.marketType != marketType || c.listenKey != "" {
+			continue
+		}
+		if name := c.subscribed(stream); name != "" {
+			s.sendTo(c, name, msg)
+		}
+	}
+}
+
+func (s *Server) pushUser(listenKey string, msg interface{}) {
+	for c := range s.conns {
+		if c.listenKey == listenKey {
+			s.sendTo(c, "", msg)
+		}
+	}
+}
+
+/*
+pushAccount
+推送用户数据流消息给某个市场的所有listenKey连接
+*/
+func (s *Server) pushAccount(marketType string, msg interface{}) {
+	for c := range s.conns {
+		if c.listenKey != "" && c.marketType == marketType {
+			s.sendTo(c, "", msg)
+		}
+	}
+}
+
+func (s *Server) closeUserConns(listenKey string) {
+	for c := range s.conns {
+		if c.listenKey == listenKey {
+			c.close()
+		}
+	}
+}
+
+type tradeInfo struct {
+	fill *fill
+	id   int64
+}
+
+/*
+pushOrder
+推送订单更新，现货为executionReport，合约为ORDER_TRADE_UPDATE
+*/
+func (s *Server) pushOrder(marketType string, od *order, execType string, trade *tradeInfo) {
+	stamp := nowMS()
+	avgPrice := float64(0)
+	if od.Filled > 0 {
+		avgPrice = od.Cost / od.Filled
+	}
+	o := map[string]interface{}{
+		"s":  od.Symbol,
+		"c":  od.ClientID,
+		"S":  od.Side,
+		"o":  od.Type,
+		"f":  od.TimeInForce,
+		"q":  fmtNum(od.Amount),
+		"p":  fmtNum(od.Price),
+		"x":  execType,
+		"X":  od.Status,
+		"i":  od.ID,
+		"l":  "0",
+		"z":  fmtNum(od.Filled),
+		"L":  "0",
+		"n":  "0",
+		"N":  s.quoteAsset(marketType, od.Symbol),
+		"T":  stamp,
+		"t":  -1,
+		"m":  false,
+		"ap": fmtNum(avgPrice),
+	}
+	if trade != nil {
+		o["l"] = fmtNum(trade.fill.amount)
+		o["L"] = fmtNum(trade.fill.price)
+		o["t"] = trade.id
+		o["m"] = trade.fill.maker
+	}
+	if isContract(marketType) {
+		o["ps"] = od.PosSide
+		o["R"] = od.ReduceOnly
+		o["ot"] = od.Type
+		s.pushAccount(marketType, map[string]interface{}{
+			"e": "ORDER_TRADE_UPDATE",
+			"E": stamp,
+			"T": stamp,
+			"o": o,
+		})
+		return
+	}
+	o["e"] = "executionReport"
+	o["E"] = stamp
+	o["O"] = od.Time
+	o["Z"] = fmtNum(od.Cost)
+	if trade != nil {
+		o["Y"] = fmtNum(trade.fill.amount * trade.fill.price)
+	}
+	s.pushAccount(marketType, o)
+}
@@ -3,16 +3,31 @@ package binance
 import (
 	"github.com/banbox/banexg/base"
 	"github.com/banbox/banexg/errs"
+	"sync"
+	"time"
 )
 
 type Binance struct {
 	*base.Exchange
 	RecvWindow       int
 	newOrderRespType map[string]string
-	streamBySubHash  map[string]string // subHash: stream
-	streamIndex      int
-	streamLimits     map[string]int // marketType: limit
-	wsRequestId      map[string]int // url: count
+	streamPools      map[string]*wsStreamPool           // marketType: combined stream connections
+	streamLimits     map[string]int                     // marketType: max streams per connection
+	subMsgLimits     map[string]int                     // marketType: max messages per second per connection
+	streamLock       sync.Mutex                         // lock for streamPools
+	wsRequestId      map[string]int                     // url: count
+	bookSnapStreams  map[string]map[string]bool         // symbol: partial depth streams of all levels and speeds
+	bookJobs         map[string]*base.WsJobInfo         // symbol: depth sub job, for resync
+	bookSyncing      map[string]bool                    // symbol: whether resync is running
+	bookLock         sync.Mutex                         // lock for OrderBooks, bookJobs, bookSyncing, bookSnapStreams
+	UseWsApi         bool                               // 下单撤单查询订单时优先使用websocket api
+	wsApiLogons      map[string]bool                    // accName@url: whether session.logon is done
+	wsReqLock        sync.Mutex                         // lock for wsRequestId, wsApiLogons
+	userStreams      map[string]*map[string]interface{} // accName@url: params for user data stream auth
+	authTimers       map[string]*time.Timer             // accName@marketType: listenKey renewal timer
+	userLock         sync.Mutex                         // lock for userStreams, authTimers
+	optionChains     map[string]*base.OptionChain       // underlying: option chain for WatchOptionChain
+	optionLock       sync.Mutex                         // lock for optionChains
 }
 
 /*
@@ -77,6 +92,7 @@ type BnbMarketRsp struct {
 	RateLimits      []*RateLimit `json:"rateLimits"`
 	ExchangeFilters []BnbFilter  `json:"exchangeFilters"`
 	Symbols         []*BnbMarket `json:"symbols"`
+	OptionSymbols   []*BnbMarket `json:"optionSymbols"` // 期权市场的exchangeInfo
 }
 type RateLimit struct {
 	RateLimitType string `json:"rateLimitType"`
@@ -514,16 +530,16 @@ OptionOrder 期权订单
 */
 type OptionOrder struct {
 	FutBase
-	PostOnly      bool    `json:"postOnly"`      // 仅做maker
-	PriceScale    int     `json:"priceScale"`    // 价格精度
-	OptionSide    string  `json:"optionSide"`    // 期权类型
-	QuoteAsset    string  `json:"quoteAsset"`    // 报价资产
-	Quantity      float64 `json:"quantity"`      // 订单数量
-	QuantityScale int     `json:"quantityScale"` // 数量精度
-	Fee           float64 `json:"fee"`           // 手续费
-	CreateTime    int64   `json:"createTime"`    // 订单创建时间
-	Source        string  `json:"source"`        // 订单来源
-	Mmp           bool    `json:"mmp"`           // 是否为MMP订单
+	PostOnly      bool   `json:"postOnly"`      // 仅做maker
+	PriceScale    int    `json:"priceScale"`    // 价格精度
+	OptionSide    string `json:"optionSide"`    // 期权类型
+	QuoteAsset    string `json:"quoteAsset"`    // 报价资产
+	Quantity      string `json:"quantity"`      // 订单数量
+	QuantityScale int    `json:"quantityScale"` // 数量精度
+	Fee           string `json:"fee"`           // 手续费
+	CreateTime    int64  `json:"createTime"`    // 订单创建时间
+	Source        string `json:"source"`        // 订单来源
+	Mmp           bool   `json:"mmp"`           // 是否为MMP订单
 }
 
 type SpotFill struct {
@@ -538,6 +554,45 @@ type SpotFill struct {
 
 type IBnbOrder interface {
 	ToStdOrder(func(string) string) *base.Order
+	ToDecOrder() *base.OrderDec
+}
+
+/*
+MarginForceLiquidation 杠杆账户强平记录
+*/
+type MarginForceLiquidation struct {
+	AvgPrice    string `json:"avgPrice"`
+	ExecutedQty string `json:"executedQty"`
+	OrderId     int64  `json:"orderId"`
+	Price       string `json:"price"`
+	Qty         string `json:"qty"`
+	Side        string `json:"side"`
+	Symbol      string `json:"symbol"`
+	TimeInForce string `json:"timeInForce"`
+	IsIsolated  bool   `json:"isIsolated"`
+	UpdatedTime int64  `json:"updatedTime"`
+}
+
+type MarginForceLiquidationRsp struct {
+	Rows  []*MarginForceLiquidation `json:"rows"`
+	Total int                       `json:"total"`
+}
+
+/*
+WsForceOrder 强平订单推送，forceOrder事件的o字段
+*/
+type WsForceOrder struct {
+	Symbol      string `json:"s"`  // 交易对
+	Side        string `json:"S"`  // 订单方向
+	Type        string `json:"o"`  // 订单类型
+	TimeInForce string `json:"f"`  // 有效方式
+	Quantity    string `json:"q"`  // 订单数量
+	Price       string `json:"p"`  // 订单价格
+	AvgPrice    string `json:"ap"` // 平均价格
+	Status      string `json:"X"`  // 订单状态
+	LastFilled  string `json:"l"`  // 订单最近成交量
+	Filled      string `json:"z"`  // 订单累计成交量
+	TradeTime   int64  `json:"T"`  // 交易时间
 }
 
 /*
@@ -639,6 +694,24 @@ type OptionTicker struct {
 	ExercisePrice      float64 `json:"exercisePrice,string"`      // 行权前半小时返回预估结算价，其他时刻返回指数价格
 }
 
+/*
+OptionMark 期权标记价格和希腊值: /eapi/v1/mark
+*/
+type OptionMark struct {
+	Symbol           string `json:"symbol"`
+	MarkPrice        string `json:"markPrice"`        // 标记价格
+	BidIV            string `json:"bidIV"`            // 买价隐含波动率
+	AskIV            string `json:"askIV"`            // 卖价隐含波动率
+	MarkIV           string `json:"markIV"`           // 标记价格隐含波动率
+	Delta            string `json:"delta"`            // delta值
+	Theta            string `json:"theta"`            // theta值
+	Gamma            string `json:"gamma"`            // gamma值
+	Vega             string `json:"vega"`             // vega值
+	HighPriceLimit   string `json:"highPriceLimit"`   // 当前最高买价
+	LowPriceLimit    string `json:"lowPriceLimit"`    // 当前最低卖价
+	RiskFreeInterest string `json:"riskFreeInterest"` // 无风险利率
+}
+
 type IBnbTicker interface {
 	ToStdTicker(e *Binance, marketType string) *base.Ticker
 }
@@ -648,8 +721,8 @@ type IBnbTicker interface {
  */
 
 type BaseOrderBook struct {
-	Bids [][]string `json:"bids"`
-	Asks [][]string `json:"asks"`
+	Bids [][2]string `json:"bids"`
+	Asks [][2]string `json:"asks"`
 }
 
 type OptionOrderBook struct {
@@ -677,7 +750,7 @@ type SpotOrderBook struct {
 }
 
 type IBnbOrderBook interface {
-	ToStdOrderBook(m *base.Market) *base.OrderBook
+	ToStdOrderBook(m *base.Market, exact bool) *base.OrderBook
 }
 
 /*
@@ -720,5 +793,6 @@ type InversePairLvgBrackets struct {
 
 type ISymbolLvgBracket interface {
 	ToStdBracket() [][2]float64
+	ToStdTiers(symbol, currency string) []*base.LeverageTier
 	GetSymbol() string
 }
@@ -0,0 +1,239 @@
+package binance
+
+import (
+	"context"
+	"github.com/banbox/banexg/base"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"go.uber.org/zap"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+wsApiMethods
+可通过websocket api发送的rest接口，key为rest接口名，value为ws api的method
+https://binance-docs.github.io/apidocs/websocket_api/en/#trading-requests
+*/
+var wsApiMethods = map[string]string{
+	"privatePostOrder":     "order.place",
+	"privatePostOrderTest": "order.test",
+	"privateDeleteOrder":   "order.cancel",
+	"privateGetOrder":      "order.status",
+	"privateGetOpenOrders": "openOrders.status",
+}
+
+/*
+requestRetry
+UseWsApi开启且接口支持时，优先通过websocket api发送请求；连接不可用、请求未发出，
+或超时时连接已断开的，回退到rest接口。请求已发出且连接正常但超时未返回的，不会回退，避免重复下单
+*/
+func (e *Binance) requestRetry(ctx context.Context, method string, params *map[string]interface{}, tryNum int) *base.HttpRes {
+	if e.UseWsApi {
+		if wsMethod, ok := wsApiMethods[method]; ok {
+			args := utils.SafeParams(params)
+			rsp := e.requestWsApi(ctx, wsMethod, args)
+			if rsp.Error == nil || rsp.Error.Code != errs.CodeConnectFail {
+				return rsp
+			}
+			log.Warn("ws api unavailable, fallback to rest", zap.String("method", method),
+				zap.String("err", rsp.Error.Msg))
+		}
+	}
+	return e.RequestApiRetry(ctx, method, params, tryNum)
+}
+
+/*
+requestWsApi
+通过websocket api发送请求并等待结果。返回HttpRes，以便和rest接口复用解析逻辑
+*/
+func (e *Binance) requestWsApi(ctx context.Context, method string, params map[string]interface{}) *base.HttpRes {
+	args := make(map[string]interface{})
+	for k, v := range params {
+		if num, ok := v.(float64); ok {
+			// 发送和签名使用相同的文本，避免json编码为科学计数法导致签名不一致
+			v = strconv.FormatFloat(num, 'f', -1, 64)
+		}
+		args[k] = v
+	}
+	accName := e.GetAccName(&args)
+	creds, err := e.GetAccountCreds(accName)
+	if err != nil {
+		return &base.HttpRes{AccName: accName, Error: err}
+	}
+	wsUrl := e.Hosts.GetHost(WssApi)
+	if wsUrl == "" {
+		return &base.HttpRes{AccName: accName, Error: errs.NewMsg(errs.CodeConnectFail, "ws api host empty")}
+	}
+	client, err := e.GetClient(wsUrl, base.MarketSpot, accName)
+	if err != nil {
+		return &base.HttpRes{AccName: accName, Error: err}
+	}
+	args["timestamp"] = e.Nonce()
+	if e.RecvWindow > 0 {
+		args["recvWindow"] = e.RecvWindow
+	}
+	signMethod, hash := getSignMethod(creds.Secret)
+	if signMethod == "eddsa" {
+		// Ed25519密钥可登录会话，之后的请求无需再签名
+		err = e.wsApiLogon(ctx, client, creds)
+		if err != nil {
+			return &base.HttpRes{AccName: accName, Error: err}
+		}
+	} else {
+		args["apiKey"] = creds.ApiKey
+		sign, err := signWsApiParams(args, creds.Secret, signMethod, hash)
+		if err != nil {
+			return &base.HttpRes{AccName: accName, Error: err}
+		}
+		args["signature"] = sign
+	}
+	rsp := e.writeWsApi(ctx, client, method, args)
+	rsp.AccName = accName
+	return rsp
+}
+
+/*
+wsApiLogon
+使用Ed25519密钥登录ws api会话，每个连接只需登录一次，连接关闭后需重新登录
+*/
+func (e *Binance) wsApiLogon(ctx context.Context, client *base.WsClient, creds *base.Credential) *errs.Error {
+	clientKey := client.AccName + "@" + client.URL
+	e.wsReqLock.Lock()
+	done := e.wsApiLogons[clientKey]
+	e.wsReqLock.Unlock()
+	if done {
+		return nil
+	}
+	args := map[string]interface{}{
+		"apiKey":    creds.ApiKey,
+		"timestamp": e.Nonce(),
+	}
+	sign, err := signWsApiParams(args, creds.Secret, "eddsa", "ed25519")
+	if err != nil {
+		return err
+	}
+	args["signature"] = sign
+	rsp := e.writeWsApi(ctx, client, "session.logon", args)
+	if rsp.Error != nil {
+		return rsp.Error
+	}
+	e.wsReqLock.Lock()
+	e.wsApiLogons[clientKey] = true
+	e.wsReqLock.Unlock()
+	return nil
+}
+
+/*
+writeWsApi
+发送ws api请求，通过请求ID匹配返回结果，超过RecvWindow未返回则视为超时。
+请求未发出或超时时连接已断开，返回CodeConnectFail
+*/
+func (e *Binance) writeWsApi(ctx context.Context, client *base.WsClient, method string, args map[string]interface{}) *base.HttpRes {
+	requestId := e.nextWsRequestId(client.URL)
+	id := strconv.Itoa(requestId)
+	out := make(chan map[string]string, 1)
+	jobInfo := &base.WsJobInfo{
+		ID:   id,
+		Name: method,
+		Method: func(client *base.WsClient, msg map[string]string, info *base.WsJobInfo) {
+			out <- msg
+		},
+	}
+	request := map[string]interface{}{
+		"id":     requestId,
+		"method": method,
+		"params": args,
+	}
+	if client.IsClosed() {
+		return &base.HttpRes{Error: errs.NewMsg(errs.CodeConnectFail, "ws api conn closed: %s", client.URL)}
+	}
+	err := client.WriteWait(ctx, request, jobInfo)
+	if err != nil {
+		return &base.HttpRes{Error: err}
+	}
+	timeout := time.Duration(e.RecvWindow) * time.Millisecond
+	if timeout <= 0 {
+		timeout = time.Second * 10
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case msg := <-out:
+		return parseWsApiRes(msg)
+	case <-timer.C:
+		client.DelJobInfo(id)
+		if client.IsClosed() {
+			// 连接已断开，请求大概率未被处理，允许回退到rest
+			return &base.HttpRes{Error: errs.NewMsg(errs.CodeConnectFail, "ws api %s timeout, conn closed: %s", method, id)}
+		}
+		return &base.HttpRes{Error: errs.NewMsg(errs.CodeNetFail, "ws api %s timeout: %s", method, id)}
+	case <-ctx.Done():
+		client.DelJobInfo(id)
+		return &base.HttpRes{Error: errs.New(errs.CodeNetFail, ctx.Err())}
+	}
+}
+
+/*
+parseWsApiRes
+将ws api返回结果转为HttpRes，result作为Content，error和rest接口保持一致
+*/
+func parseWsApiRes(msg map[string]string) *base.HttpRes {
+	status, _ := utils.SafeMapVal(msg, "status", 0)
+	var res = &base.HttpRes{Status: status, Content: msg["result"]}
+	if errText, ok := msg["error"]; ok && errText != "" {
+		if res.Status < 400 {
+			res.Status = 400
+		}
+		res.Content = errText
+		res.Error = errs.NewMsg(res.Status, errText)
+	} else if res.Status >= 400 {
+		res.Error = errs.NewMsg(res.Status, res.Content)
+	}
+	return res
+}
+
+/*
+signWsApiParams
+ws api的签名：参数按key排序后用&拼接，值不做url编码
+*/
+func signWsApiParams(args map[string]interface{}, secret, method, hash string) (string, *errs.Error) {
+	// 和rest接口一样转为字符串，浮点数不使用科学计数法
+	vals := utils.MapValStr(args)
+	keys := make([]string, 0, len(vals))
+	for k := range vals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + vals[k]
+	}
+	sign, err := utils.Signature(strings.Join(parts, "&"), secret, method, hash, "hex")
+	if err != nil {
+		return "", err
+	}
+	if method != "hmac" {
+		// Signature对rsa/eddsa的结果做了url编码，ws api需要原始base64
+		text, err_ := url.QueryUnescape(sign)
+		if err_ != nil {
+			return "", errs.New(errs.CodeSignFail, err_)
+		}
+		sign = text
+	}
+	return sign, nil
+}
+
+func makeHandleWsClose(e *Binance) base.FuncOnWsClose {
+	return func(client *base.WsClient, err *errs.Error) {
+		clientKey := client.AccName + "@" + client.URL
+		e.wsReqLock.Lock()
+		delete(e.wsApiLogons, clientKey)
+		e.wsReqLock.Unlock()
+		// 用户数据流意外断开（如超过24小时）时，由closeClientChans重新打开，订阅者不受影响
+	}
+}
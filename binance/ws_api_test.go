@@ -0,0 +1,57 @@
+package binance
+
+import (
+	"testing"
+)
+
+func TestParseWsApiRes(t *testing.T) {
+	rsp := parseWsApiRes(map[string]string{
+		"id":     "3",
+		"status": "200",
+		"result": `{"symbol":"BTCUSDT","orderId":12569099453}`,
+	})
+	if rsp.Error != nil || rsp.Content != `{"symbol":"BTCUSDT","orderId":12569099453}` {
+		t.Errorf("parse ok result fail: %v", rsp)
+	}
+	rsp = parseWsApiRes(map[string]string{
+		"id":     "4",
+		"status": "400",
+		"error":  `{"code":-2010,"msg":"Account has insufficient balance for requested action."}`,
+	})
+	if rsp.Error == nil || rsp.Error.Code != 400 {
+		t.Errorf("parse error result fail: %v", rsp)
+	}
+}
+
+func TestSignWsApiParams(t *testing.T) {
+	// https://binance-docs.github.io/apidocs/websocket_api/en/#signed-request-example-hmac
+	args := map[string]interface{}{
+		"symbol":           "BTCUSDT",
+		"side":             "SELL",
+		"type":             "LIMIT",
+		"timeInForce":      "GTC",
+		"quantity":         "0.01000000",
+		"price":            "52000.00",
+		"newOrderRespType": "ACK",
+		"recvWindow":       100,
+		"timestamp":        1645423376532,
+		"apiKey":           "vmPUZE6mv9SD5VNHk4HlWFsOr6aKE2zvsw0MuIgwCIPy6utIco14y7Ju91duEh8A",
+	}
+	secret := "NhqPtmdSJYdKjVHjA7PZj4Mge3R5YNiP1e3UZjInClVN65XAbvqqM6A7H5fATj0j"
+	sign, err := signWsApiParams(args, secret, "hmac", "sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "cc15477742bd704c29492d96c7ead9414dfd8e0ec4a00f947bb5bb454ddbd08a"
+	if sign != expect {
+		t.Errorf("sign fail, expect %s, got %s", expect, sign)
+	}
+	// 浮点数不应被格式化为科学计数法
+	args["quantity"] = "0.00001"
+	strSign, _ := signWsApiParams(args, secret, "hmac", "sha256")
+	args["quantity"] = 0.00001
+	numSign, _ := signWsApiParams(args, secret, "hmac", "sha256")
+	if strSign != numSign {
+		t.Errorf("float param sign mismatch: %s %s", strSign, numSign)
+	}
+}
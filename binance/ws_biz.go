@@ -17,6 +17,11 @@ import (
 
 func makeHandleWsMsg(e *Binance) base.FuncOnWsMsg {
 	return func(client *base.WsClient, item *base.WsMsg) {
+		if item.Stream != "" && isPartialDepth(item.Stream) {
+			// 有限档深度，现货消息无事件类型，合约事件类型和增量深度相同，需根据stream区分
+			e.handleOrderBookSnapshot(client, item.Stream, item.Object)
+			return
+		}
 		if item.Event == "" {
 			if item.ID != "" {
 				// 任务结果返回
@@ -37,18 +42,10 @@ func makeHandleWsMsg(e *Binance) base.FuncOnWsMsg {
 		}
 		var msg = item.Object
 		switch item.Event {
-		case "depthUpdate":
-			e.handleOrderBook(client, msg)
 		case "trade":
 			e.handleTrade(client, msg)
 		case "aggTrade":
 			e.handleTrade(client, msg)
-		case "kline":
-			e.handleOhlcv(client, msg)
-		case "markPrice_kline":
-			e.handleOhlcv(client, msg)
-		case "indexPrice_kline":
-			e.handleOhlcv(client, msg)
 		case "markPriceUpdate":
 			// linear/inverse
 			e.handleMarkPrices(client, msgList)
@@ -76,12 +73,57 @@ func makeHandleWsMsg(e *Binance) base.FuncOnWsMsg {
 			e.handleOrderUpdate(client, msg)
 		case "ORDER_TRADE_UPDATE":
 			e.handleOrderUpdate(client, msg)
+		case "forceOrder":
+			e.handleLiquidation(client, msg)
+		case "listenKeyExpired":
+			e.handleListenKeyExpired(client)
+		case "ACCOUNT_CONFIG_UPDATE":
+			e.handleAccountConfig(client, msg)
+		case "MARGIN_CALL":
+			e.handleMarginCall(client, msg)
+		case "STRATEGY_UPDATE":
+			e.handleStrategyUpdate(client, msg)
+		case "GRID_UPDATE":
+			e.handleStrategyUpdate(client, msg)
 		default:
 			log.Warn("unhandle ws msg", zap.String("msg", item.Text))
 		}
 	}
 }
 
+/*
+makeHandleWsEvent
+高频的增量深度和K线消息直接解析为结构体，避免先解析为map再逐字段转换
+*/
+func makeHandleWsEvent(e *Binance) base.FuncOnWsEvent {
+	return func(client *base.WsClient, event, stream, payload string) bool {
+		if stream != "" && isPartialDepth(stream) {
+			return false
+		}
+		switch event {
+		case "depthUpdate":
+			var msg = WsDepthUpdate{}
+			err := sonic.UnmarshalString(payload, &msg)
+			if err != nil {
+				log.Error("unmarshal ws depth fail", zap.String("msg", payload), zap.Error(err))
+				return true
+			}
+			e.handleOrderBook(client, &msg)
+		case "kline", "markPrice_kline", "indexPrice_kline":
+			var msg = WsKlineEvent{}
+			err := sonic.UnmarshalString(payload, &msg)
+			if err != nil {
+				log.Error("unmarshal ws kline fail", zap.String("msg", payload), zap.Error(err))
+				return true
+			}
+			e.handleOhlcv(client, &msg)
+		default:
+			return false
+		}
+		return true
+	}
+}
+
 type AuthRes struct {
 	ListenKey string `json:"listenKey"`
 }
@@ -132,13 +174,37 @@ func makeAuthenticate(e *Binance) base.FuncAuth {
 		acc.Data[lastTimeKey] = curTime
 		acc.Data[authField] = res.ListenKey
 		refreshAfter := time.Duration(authRefreshSecs) * time.Second
-		time.AfterFunc(refreshAfter, func() {
+		e.setAuthTimer(acc.Name, marketType, refreshAfter, func() {
 			e.keepAliveListenKey(acc, params)
 		})
 		return acc, nil
 	}
 }
 
+/*
+setAuthTimer
+设置listenKey续期定时器，每个账户每个市场只保留一个，旧的会被停止
+*/
+func (e *Binance) setAuthTimer(accName, marketType string, after time.Duration, fn func()) {
+	key := accName + "@" + marketType
+	e.userLock.Lock()
+	defer e.userLock.Unlock()
+	if old, ok := e.authTimers[key]; ok {
+		old.Stop()
+	}
+	e.authTimers[key] = time.AfterFunc(after, fn)
+}
+
+func (e *Binance) stopAuthTimer(accName, marketType string) {
+	key := accName + "@" + marketType
+	e.userLock.Lock()
+	defer e.userLock.Unlock()
+	if old, ok := e.authTimers[key]; ok {
+		old.Stop()
+		delete(e.authTimers, key)
+	}
+}
+
 func (e *Binance) keepAliveListenKey(acc *base.Account, params *map[string]interface{}) {
 	args := utils.SafeParams(params)
 	marketType, _ := e.GetArgsMarketType(args, "")
@@ -153,12 +219,17 @@ func (e *Binance) keepAliveListenKey(acc *base.Account, params *map[string]inter
 		if success {
 			return
 		}
-		delete(acc.Data, authField)
-		delete(acc.Data, lastTimeKey)
 		clientKey := acc.Name + "@" + e.Hosts.GetHost(marketType) + "/" + listenKey
-		if client, ok := e.WSClients[clientKey]; ok {
-			_ = client.Conn.WriteClose()
-			log.Warn("renew listenKey fail, close ws client", zap.String("key", clientKey))
+		if client, ok := e.GetWsClient(clientKey); ok {
+			log.Warn("renew listenKey fail, reopen user data stream", zap.String("key", clientKey))
+			userArgs := e.detachUserStream(client)
+			if client.Conn != nil {
+				client.Close()
+			}
+			e.reopenUserStream(client, userArgs)
+		} else {
+			delete(acc.Data, authField)
+			delete(acc.Data, lastTimeKey)
 		}
 	}()
 	method := "publicPutUserDataStream"
@@ -187,7 +258,7 @@ func (e *Binance) keepAliveListenKey(acc *base.Account, params *map[string]inter
 	acc.Data[lastTimeKey] = e.MilliSeconds()
 	authRefreshSecs := utils.GetMapVal(acc.Data, base.OptAuthRefreshSecs, 1200)
 	refreshDuration := time.Duration(authRefreshSecs) * time.Second
-	time.AfterFunc(refreshDuration, func() {
+	e.setAuthTimer(acc.Name, marketType, refreshDuration, func() {
 		e.keepAliveListenKey(acc, params)
 	})
 }
@@ -206,7 +277,217 @@ func (e *Binance) getAuthClient(params *map[string]interface{}) (string, *base.W
 	listenKey := utils.GetMapVal(acc.Data, marketType+base.MidListenKey, "")
 	wsUrl := e.Hosts.GetHost(marketType) + "/" + listenKey
 	client, err := e.GetClient(wsUrl, marketType, acc.Name)
-	return listenKey, client, err
+	if err != nil {
+		return listenKey, nil, err
+	}
+	e.userLock.Lock()
+	e.userStreams[acc.Name+"@"+wsUrl] = &args
+	e.userLock.Unlock()
+	return listenKey, client, nil
+}
+
+/*
+userChanKey
+用户数据流的输出通道key，不包含listenKey，更换listenKey重连后订阅者不受影响
+*/
+func (e *Binance) userChanKey(accName, marketType, key string) string {
+	return base.WsPrefix(accName, e.Hosts.GetHost(marketType)+"/"+base.MidListenKey, key)
+}
+
+/*
+detachUserStream
+将用户数据流连接从WSClients中移除，关闭时不再关闭输出通道。返回认证参数，不是当前的用户数据流时返回nil
+*/
+func (e *Binance) detachUserStream(client *base.WsClient) *map[string]interface{} {
+	clientKey := client.AccName + "@" + client.URL
+	e.WsLock.Lock()
+	defer e.WsLock.Unlock()
+	if cur, ok := e.WSClients[clientKey]; !ok || cur != client {
+		// 已被移除或替换
+		return nil
+	}
+	e.userLock.Lock()
+	params, ok := e.userStreams[clientKey]
+	delete(e.userStreams, clientKey)
+	e.userLock.Unlock()
+	if !ok {
+		return nil
+	}
+	delete(e.WSClients, clientKey)
+	return params
+}
+
+/*
+closeUserChans
+非组合流的连接关闭时调用。用户数据流的输出通道key不含listenKey，不能按client.Prefix关闭：
+仍有认证参数时重新打开，订阅者不受影响；否则停止续期定时器并关闭此账户此市场的用户数据输出通道
+*/
+func (e *Binance) closeUserChans(client *base.WsClient) int {
+	clientKey := client.AccName + "@" + client.URL
+	e.userLock.Lock()
+	params, ok := e.userStreams[clientKey]
+	delete(e.userStreams, clientKey)
+	e.userLock.Unlock()
+	if ok {
+		e.WsLock.Lock()
+		if cur, ok := e.WSClients[clientKey]; ok && cur == client {
+			delete(e.WSClients, clientKey)
+		}
+		e.WsLock.Unlock()
+		log.Warn("user data stream closed, reopen", zap.String("url", client.URL))
+		go e.reopenUserStream(client, params)
+		return 0
+	}
+	num := e.CloseWsChans(client.Prefix(""))
+	if e.isUserStreamUrl(client) {
+		e.stopAuthTimer(client.AccName, client.MarketType)
+		num += e.CloseWsChans(e.userChanKey(client.AccName, client.MarketType, ""))
+	}
+	return num
+}
+
+/*
+isUserStreamUrl
+连接地址是否为用户数据流：市场的ws地址后直接跟listenKey
+*/
+func (e *Binance) isUserStreamUrl(client *base.WsClient) bool {
+	host := e.Hosts.GetHost(client.MarketType)
+	if host == "" || !strings.HasPrefix(client.URL, host+"/") {
+		return false
+	}
+	listenKey := strings.TrimPrefix(client.URL, host+"/")
+	return listenKey != "" && !strings.ContainsAny(listenKey, "/#?") && listenKey != "stream"
+}
+
+/*
+reopenUserStream
+重新获取listenKey并打开用户数据流，输出通道保持不变；失败时关闭此账户此市场的所有用户数据输出通道
+*/
+func (e *Binance) reopenUserStream(client *base.WsClient, params *map[string]interface{}) {
+	if params == nil {
+		return
+	}
+	var newClient *base.WsClient
+	acc, err := e.GetAccount(client.AccName)
+	if err == nil {
+		delete(acc.Data, client.MarketType+"lastAuthTime")
+		delete(acc.Data, client.MarketType+base.MidListenKey)
+		_, newClient, err = e.getAuthClient(params)
+	}
+	if err != nil {
+		num := e.CloseWsChans(e.userChanKey(client.AccName, client.MarketType, ""))
+		log.Error("reopen user data stream fail, close out chans", zap.String("acc", client.AccName),
+			zap.String("market", client.MarketType), zap.Int("num", num), zap.Error(err))
+		return
+	}
+	log.Info("user data stream reopened", zap.String("acc", client.AccName), zap.String("url", newClient.URL))
+	// 重连期间可能丢失更新，重新获取余额和持仓
+	if _, ok := e.WsOutChans[e.userChanKey(newClient.AccName, newClient.MarketType, "balance")]; ok {
+		balances, err := e.FetchBalance(params)
+		if err != nil {
+			log.Error("refresh balance fail", zap.Error(err))
+		} else {
+			acc.MarBalances[newClient.MarketType] = balances
+			chanKey := e.userChanKey(newClient.AccName, newClient.MarketType, "balance")
+			base.WriteOutChan(e.Exchange, chanKey, *balances, true)
+		}
+	}
+	if _, ok := e.WsOutChans[e.userChanKey(newClient.AccName, newClient.MarketType, "positions")]; ok {
+		positions, err := e.FetchPositions(nil, params)
+		if err != nil {
+			log.Error("refresh positions fail", zap.Error(err))
+		} else {
+			acc.MarPositions[newClient.MarketType] = positions
+			chanKey := e.userChanKey(newClient.AccName, newClient.MarketType, "positions")
+			base.WriteOutChan(e.Exchange, chanKey, positions, true)
+		}
+	}
+}
+
+func (e *Binance) WatchAccountEvents(params *map[string]interface{}) (chan base.AccountEvent, *errs.Error) {
+	_, client, err := e.getAuthClient(params)
+	if err != nil {
+		return nil, err
+	}
+	args := utils.SafeParams(params)
+	chanKey := e.userChanKey(client.AccName, client.MarketType, "accEvents")
+	create := func(cap int) chan base.AccountEvent { return make(chan base.AccountEvent, cap) }
+	out := base.GetWsOutChan(e.Exchange, chanKey, create, args)
+	e.AddWsChanRefs(chanKey, "account")
+	return out, nil
+}
+
+func (e *Binance) UnWatchAccountEvents(params *map[string]interface{}) *errs.Error {
+	return e.unWatchUserStream("accEvents", params)
+}
+
+/*
+unWatchUserStream
+取消订阅用户数据流的某个输出通道。当此账户此市场没有任何订阅时，关闭连接，删除listenKey并停止续期
+*/
+func (e *Binance) unWatchUserStream(key string, params *map[string]interface{}) *errs.Error {
+	args := utils.SafeParams(params)
+	acc, err := e.GetAccount(e.GetAccName(&args))
+	if err != nil {
+		return err
+	}
+	marketType, _ := e.GetArgsMarketType(args, "")
+	e.DelWsChanRefs(e.userChanKey(acc.Name, marketType, key), "account")
+	prefix := e.userChanKey(acc.Name, marketType, "")
+	for chanKey := range e.WsOutChans {
+		if strings.HasPrefix(chanKey, prefix) {
+			return nil
+		}
+	}
+	args[base.ParamAccount] = acc.Name
+	return e.closeUserStream(acc, marketType, args)
+}
+
+/*
+closeUserStream
+关闭用户数据流连接，停止续期定时器，并在交易所删除listenKey
+*/
+func (e *Binance) closeUserStream(acc *base.Account, marketType string, args map[string]interface{}) *errs.Error {
+	e.stopAuthTimer(acc.Name, marketType)
+	authField := marketType + base.MidListenKey
+	listenKey := utils.GetMapVal(acc.Data, authField, "")
+	delete(acc.Data, authField)
+	delete(acc.Data, marketType+"lastAuthTime")
+	if listenKey == "" {
+		return nil
+	}
+	clientKey := acc.Name + "@" + e.Hosts.GetHost(marketType) + "/" + listenKey
+	if client, ok := e.GetWsClient(clientKey); ok {
+		e.detachUserStream(client)
+		if client.Conn != nil {
+			client.Close()
+		}
+	}
+	marginMode := utils.PopMapVal(args, base.ParamMarginMode, "")
+	method := "publicDeleteUserDataStream"
+	if marketType == base.MarketLinear {
+		method = "fapiPrivateDeleteListenKey"
+	} else if marketType == base.MarketInverse {
+		method = "dapiPrivateDeleteListenKey"
+	} else {
+		args[base.MidListenKey] = listenKey
+		if marginMode == base.MarginIsolated {
+			method = "sapiDeleteUserDataStreamIsolated"
+			marketId, err := e.GetMarketIDByArgs(args, true)
+			if err != nil {
+				return err
+			}
+			args["symbol"] = marketId
+		} else if marketType == base.MarketMargin {
+			method = "sapiDeleteUserDataStream"
+		}
+	}
+	rsp := e.RequestApiRetry(context.Background(), method, &args, 1)
+	if rsp.Error != nil {
+		return rsp.Error
+	}
+	log.Info("user data stream closed", zap.String("acc", acc.Name), zap.String("market", marketType))
+	return nil
 }
 
 func (e *Binance) WatchBalance(params *map[string]interface{}) (chan base.Balances, *errs.Error) {
@@ -224,7 +505,7 @@ func (e *Binance) WatchBalance(params *map[string]interface{}) (chan base.Balanc
 	}
 	acc.MarBalances[client.MarketType] = balances
 	args := utils.SafeParams(params)
-	chanKey := client.Prefix("balance")
+	chanKey := e.userChanKey(client.AccName, client.MarketType, "balance")
 	create := func(cap int) chan base.Balances { return make(chan base.Balances, cap) }
 	out := base.GetWsOutChan(e.Exchange, chanKey, create, args)
 	e.AddWsChanRefs(chanKey, "account")
@@ -232,6 +513,10 @@ func (e *Binance) WatchBalance(params *map[string]interface{}) (chan base.Balanc
 	return out, nil
 }
 
+func (e *Binance) UnWatchBalance(params *map[string]interface{}) *errs.Error {
+	return e.unWatchUserStream("balance", params)
+}
+
 func (e *Binance) WatchPositions(params *map[string]interface{}) (chan []*base.Position, *errs.Error) {
 	_, client, err := e.getAuthClient(params)
 	if err != nil {
@@ -247,7 +532,7 @@ func (e *Binance) WatchPositions(params *map[string]interface{}) (chan []*base.P
 	}
 	acc.MarPositions[client.MarketType] = positions
 	args := utils.SafeParams(params)
-	chanKey := client.Prefix("positions")
+	chanKey := e.userChanKey(client.AccName, client.MarketType, "positions")
 	create := func(cap int) chan []*base.Position { return make(chan []*base.Position, cap) }
 	out := base.GetWsOutChan(e.Exchange, chanKey, create, args)
 	e.AddWsChanRefs(chanKey, "account")
@@ -255,6 +540,10 @@ func (e *Binance) WatchPositions(params *map[string]interface{}) (chan []*base.P
 	return out, nil
 }
 
+func (e *Binance) UnWatchPositions(params *map[string]interface{}) *errs.Error {
+	return e.unWatchUserStream("positions", params)
+}
+
 /*
 WatchOhlcvs
 watches historical candlestick data containing the open, high, low, and close price, and the volume of a market
@@ -313,10 +602,6 @@ func (e *Binance) prepareMarkPrices(method string, symbols []string, params *map
 		return "", nil, errs.NewMsg(errs.CodeUnsupportMarket, "WatchMarkPrices support linear/inverse/option, current: %s", marketType)
 	}
 	msgHash := marketType + "@markPrice"
-	client, requestId, err := e.GetWsClient(marketType, msgHash)
-	if err != nil {
-		return "", nil, err
-	}
 	intv := utils.PopMapVal(args, base.ParamInterval, "")
 	if intv != "" {
 		if intv != "1s" {
@@ -336,16 +621,11 @@ func (e *Binance) prepareMarkPrices(method string, symbols []string, params *map
 			subParams = append(subParams, market.LowercaseID+"@markPrice"+intv)
 		}
 	}
-	var request = map[string]interface{}{
-		"method": method,
-		"params": subParams,
-		"id":     requestId,
-	}
-	err = client.Write(request, nil)
+	chanKey := e.wsChanKey(marketType, msgHash)
+	err = e.writeWsStreams(marketType, method, chanKey, subParams, nil)
 	if err != nil {
 		return "", nil, err
 	}
-	chanKey := client.Prefix(msgHash)
 	return chanKey, args, nil
 }
 
@@ -361,12 +641,203 @@ func (e *Binance) handleMarkPrices(client *base.WsClient, msgList []map[string]s
 	for _, msg := range msgList {
 		symbol, _ := utils.SafeMapVal(msg, "s", "")
 		markPrice, _ := utils.SafeMapVal(msg, "p", float64(0))
+		if markPrice == 0 {
+			// 期权的标记价格字段为mp
+			markPrice, _ = utils.SafeMapVal(msg, "mp", float64(0))
+		}
 		symbol = e.SafeSymbol(symbol, "", client.MarketType)
 		res[symbol] = markPrice
 	}
 	chanKey := client.Prefix(client.MarketType + "@markPrice")
 	maps.Copy(data, res)
 	base.WriteOutChan(e.Exchange, chanKey, res, true)
+	if client.MarketType == base.MarketOption {
+		e.updateOptionChains(res, evtTime)
+	}
+}
+
+/*
+WatchOptionChain
+监听标的资产的期权链，先通过FetchOptionChain获取完整快照，之后使用期权markPrice流更新标记价格，
+每次更新输出完整的期权链。隐含波动率和希腊值为快照中的值
+
+	:see: https://binance-docs.github.io/apidocs/voptions/en/#mark-price
+	:param string underlying: 标的资产，如BTC，或BTC/USDT
+	:param dict [params]: extra parameters specific to the exchange API endpoint
+*/
+func (e *Binance) WatchOptionChain(underlying string, params *map[string]interface{}) (chan base.OptionChain, *errs.Error) {
+	args := utils.SafeParams(params)
+	chain, err := e.FetchOptionChain(underlying, &args)
+	if err != nil {
+		return nil, err
+	}
+	stream := optionChainStream(chain)
+	chanKey := e.wsChanKey(base.MarketOption, underlying+"@optionChain")
+	err = e.writeWsStreams(base.MarketOption, "SUBSCRIBE", chanKey, []string{stream}, nil)
+	if err != nil {
+		return nil, err
+	}
+	e.optionLock.Lock()
+	e.optionChains[underlying] = chain
+	e.optionLock.Unlock()
+	create := func(cap int) chan base.OptionChain { return make(chan base.OptionChain, cap) }
+	out := base.GetWsOutChan(e.Exchange, chanKey, create, args)
+	e.AddWsChanRefs(chanKey, stream)
+	e.AddWsChanRefs(e.wsChanKey(base.MarketOption, stream), underlying)
+	base.WriteOutChan(e.Exchange, chanKey, *chain.Clone(), true)
+	return out, nil
+}
+
+func (e *Binance) UnWatchOptionChain(underlying string, params *map[string]interface{}) *errs.Error {
+	e.optionLock.Lock()
+	chain, ok := e.optionChains[underlying]
+	delete(e.optionChains, underlying)
+	e.optionLock.Unlock()
+	if !ok {
+		return nil
+	}
+	stream := optionChainStream(chain)
+	chanKey := e.wsChanKey(base.MarketOption, underlying+"@optionChain")
+	// 同一标的的多个期权链（如BTC和BTC/USDT）共用stream，没有引用时才取消订阅
+	if e.DelWsChanRefs(e.wsChanKey(base.MarketOption, stream), underlying) <= 0 {
+		err := e.writeWsStreams(base.MarketOption, "UNSUBSCRIBE", chanKey, []string{stream}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	e.DelWsChanRefs(chanKey, stream)
+	return nil
+}
+
+/*
+optionChainStream
+期权标记价格按标的资产订阅，如BTC@markPrice
+*/
+func optionChainStream(chain *base.OptionChain) string {
+	baseCode, _, _ := strings.Cut(chain.Underlying, "/")
+	return strings.ToUpper(baseCode) + "@markPrice"
+}
+
+/*
+updateOptionChains
+使用期权标记价格更新WatchOptionChain的期权链，有变化时输出
+*/
+func (e *Binance) updateOptionChains(prices map[string]float64, stamp int64) {
+	e.optionLock.Lock()
+	defer e.optionLock.Unlock()
+	for underlying, chain := range e.optionChains {
+		updated := false
+		for symbol, price := range prices {
+			if q := chain.Get(symbol); q != nil {
+				q.MarkPrice = price
+				q.Timestamp = stamp
+				updated = true
+			}
+		}
+		if updated {
+			chain.Timestamp = stamp
+			chanKey := e.wsChanKey(base.MarketOption, underlying+"@optionChain")
+			base.WriteOutChan(e.Exchange, chanKey, *chain.Clone(), true)
+		}
+	}
+}
+
+/*
+WatchLiquidations
+watches the public liquidation orders of linear/inverse markets
+
+	:see: https://binance-docs.github.io/apidocs/futures/en/#liquidation-order-streams
+	:see: https://binance-docs.github.io/apidocs/futures/en/#all-market-liquidation-order-streams
+	:param []string symbols: unified symbols, empty for all markets
+	:param dict [params]: extra parameters specific to the exchange API endpoint
+*/
+func (e *Binance) WatchLiquidations(symbols []string, params *map[string]interface{}) (chan base.Liquidation, *errs.Error) {
+	chanKey, args, err := e.prepareLiquidations("SUBSCRIBE", symbols, params)
+	if err != nil {
+		return nil, err
+	}
+	create := func(cap int) chan base.Liquidation { return make(chan base.Liquidation, cap) }
+	out := base.GetWsOutChan(e.Exchange, chanKey, create, args)
+	e.AddWsChanRefs(chanKey, liquidationRefs(symbols)...)
+	return out, nil
+}
+
+func (e *Binance) UnWatchLiquidations(symbols []string, params *map[string]interface{}) *errs.Error {
+	chanKey, _, err := e.prepareLiquidations("UNSUBSCRIBE", symbols, params)
+	if err != nil {
+		return err
+	}
+	e.DelWsChanRefs(chanKey, liquidationRefs(symbols)...)
+	return nil
+}
+
+func liquidationRefs(symbols []string) []string {
+	if len(symbols) == 0 {
+		return []string{"!forceOrder"}
+	}
+	return symbols
+}
+
+func (e *Binance) prepareLiquidations(method string, symbols []string, params *map[string]interface{}) (string, map[string]interface{}, *errs.Error) {
+	args := utils.SafeParams(params)
+	marketType, _, err := e.LoadArgsMarketType(args, symbols...)
+	if err != nil {
+		return "", nil, err
+	}
+	if marketType != base.MarketLinear && marketType != base.MarketInverse {
+		return "", nil, errs.NewMsg(errs.CodeUnsupportMarket, "WatchLiquidations support linear/inverse, current: %s", marketType)
+	}
+	msgHash := marketType + "@forceOrder"
+	var subParams = make([]string, 0)
+	if len(symbols) == 0 {
+		subParams = append(subParams, "!forceOrder@arr")
+	} else {
+		for _, sym := range symbols {
+			market, err := e.GetMarket(sym)
+			if err != nil {
+				return "", nil, err
+			}
+			subParams = append(subParams, market.LowercaseID+"@forceOrder")
+		}
+	}
+	chanKey := e.wsChanKey(marketType, msgHash)
+	err = e.writeWsStreams(marketType, method, chanKey, subParams, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return chanKey, args, nil
+}
+
+func (e *Binance) handleLiquidation(client *base.WsClient, msg map[string]string) {
+	objText, _ := utils.SafeMapVal(msg, "o", "")
+	var od = WsForceOrder{}
+	err := sonic.UnmarshalString(objText, &od)
+	if err != nil {
+		log.Error("unmarshal forceOrder fail", zap.String("o", objText), zap.Error(err))
+		return
+	}
+	market := e.GetMarketById(od.Symbol, client.MarketType)
+	if market == nil {
+		log.Error("no market found for liquidation", zap.String("symbol", od.Symbol))
+		return
+	}
+	price, _ := strconv.ParseFloat(od.AvgPrice, 64)
+	if price == 0 {
+		price, _ = strconv.ParseFloat(od.Price, 64)
+	}
+	filled, _ := strconv.ParseFloat(od.Filled, 64)
+	res := base.Liquidation{
+		Symbol:    market.Symbol,
+		Side:      strings.ToLower(od.Side),
+		Price:     price,
+		Contracts: filled,
+		Status:    mapOrderStatus(od.Status),
+		Timestamp: od.TradeTime,
+		Datetime:  utils.ISO8601(od.TradeTime),
+		Info:      &od,
+	}
+	setLiquidationValue(&res, market)
+	base.WriteOutChan(e.Exchange, client.Prefix(client.MarketType+"@forceOrder"), res, false)
 }
 
 func (e *Binance) handleTrade(client *base.WsClient, msg map[string]string) {
@@ -374,45 +845,51 @@ func (e *Binance) handleTrade(client *base.WsClient, msg map[string]string) {
 }
 
 type WsKline struct {
-	OpenTime   int64  `json:"t"`
-	CloseTime  int64  `json:"T"`
-	Symbol     string `json:"s"`
-	PairSymbol string `json:"ps"`
-	TimeFrame  string `json:"i"`
-	Open       string `json:"o"`
-	Close      string `json:"c"`
-	High       string `json:"h"`
-	Low        string `json:"l"`
-	Volume     string `json:"v"`
-	LastId     int64  `json:"L"`
-}
-
-func (e *Binance) handleOhlcv(client *base.WsClient, msg map[string]string) {
+	OpenTime       int64  `json:"t"`
+	CloseTime      int64  `json:"T"`
+	Symbol         string `json:"s"`
+	PairSymbol     string `json:"ps"`
+	TimeFrame      string `json:"i"`
+	Open           string `json:"o"`
+	Close          string `json:"c"`
+	High           string `json:"h"`
+	Low            string `json:"l"`
+	Volume         string `json:"v"`
+	LastId         int64  `json:"L"`
+	TradeNum       int64  `json:"n"`
+	Closed         bool   `json:"x"`
+	QuoteVolume    string `json:"q"`
+	TakerBuyVolume string `json:"V"`
+	TakerBuyQuote  string `json:"Q"`
+}
+
+type WsKlineEvent struct {
+	Event      string  `json:"e"`
+	Time       int64   `json:"E"`
+	Symbol     string  `json:"s"`
+	PairSymbol string  `json:"ps"`
+	Kline      WsKline `json:"k"`
+}
+
+func (e *Binance) handleOhlcv(client *base.WsClient, msg *WsKlineEvent) {
 	/*
 		https://binance-docs.github.io/apidocs/futures/cn/#k-7
 	*/
-	event, _ := utils.SafeMapVal(msg, "e", "")
+	event := msg.Event
 	switch event {
 	case "indexPrice_kline":
 		event = "indexPriceKline"
 	case "markPrice_kline":
 		event = "markPriceKline"
 	}
-	kText, err := utils.SafeMapVal(msg, "k", "")
-	if err != nil {
-		log.Error("invalid kline ws", zap.Error(err))
-		return
-	}
-	var k = WsKline{}
-	err = sonic.UnmarshalString(kText, &k)
-	if err != nil {
-		log.Error("unmarshal ws kline fail", zap.String("k", kText), zap.Error(err))
+	k := &msg.Kline
+	if e.KlineClosedOnly && !k.Closed {
 		return
 	}
 	var chanKey = client.Prefix(client.MarketType + "@" + event)
 	var marketId string
 	if event == "indexPriceKline" {
-		marketId, _ = utils.SafeMapVal(msg, "ps", "")
+		marketId = msg.PairSymbol
 	} else if k.Symbol != "" {
 		marketId = k.Symbol
 	} else if k.PairSymbol != "" {
@@ -423,6 +900,20 @@ func (e *Binance) handleOhlcv(client *base.WsClient, msg map[string]string) {
 	h, _ := strconv.ParseFloat(k.High, 64)
 	l, _ := strconv.ParseFloat(k.Low, 64)
 	v, _ := strconv.ParseFloat(k.Volume, 64)
+	q, _ := strconv.ParseFloat(k.QuoteVolume, 64)
+	tv, _ := strconv.ParseFloat(k.TakerBuyVolume, 64)
+	tq, _ := strconv.ParseFloat(k.TakerBuyQuote, 64)
+	var contVol float64
+	if client.MarketType == base.MarketInverse {
+		// 币本位合约v和V是张数，q和Q是币数，和FetchOhlcv保持一致：Volume使用币数，成交额为张数*合约面值
+		contVol = v
+		var contSize float64
+		if market := e.GetMarketById(marketId, client.MarketType); market != nil {
+			contSize = market.ContractSize
+		}
+		v, q = q, v*contSize
+		tv, tq = tq, tv*contSize
+	}
 	var kline = &base.SymbolKline{
 		Symbol: e.SafeSymbol(marketId, "", client.MarketType),
 		Kline: base.Kline{
@@ -432,6 +923,13 @@ func (e *Binance) handleOhlcv(client *base.WsClient, msg map[string]string) {
 			High:   h,
 			Low:    l,
 			Volume: v,
+
+			Closed:              k.Closed,
+			QuoteVolume:         q,
+			TradeCount:          k.TradeNum,
+			TakerBuyVolume:      tv,
+			TakerBuyQuoteVolume: tq,
+			ContractVolume:      contVol,
 		},
 	}
 	base.WriteOutChan(e.Exchange, chanKey, *kline, true)
@@ -447,10 +945,6 @@ func (e *Binance) prepareOhlcvSub(method string, jobs [][2]string, params *map[s
 	}
 	name := utils.PopMapVal(args, base.ParamName, "kline")
 	msgHash := market.Type + "@" + name
-	client, requestId, err := e.GetWsClient(market.Type, msgHash)
-	if err != nil {
-		return "", nil, nil, err
-	}
 
 	subParams := make([]string, 0, len(jobs))
 	symbols := make([]string, 0, len(jobs))
@@ -466,13 +960,11 @@ func (e *Binance) prepareOhlcvSub(method string, jobs [][2]string, params *map[s
 		subParams = append(subParams, fmt.Sprintf("%s@%s_%s", marketId, name, row[1]))
 		symbols = append(symbols, row[0])
 	}
-	chanKey := client.Prefix(msgHash)
-	var request = map[string]interface{}{
-		"method": method,
-		"params": subParams,
-		"id":     requestId,
+	chanKey := e.wsChanKey(market.Type, msgHash)
+	err = e.writeWsStreams(market.Type, method, chanKey, subParams, nil)
+	if err != nil {
+		return "", nil, nil, err
 	}
-	err = client.Write(request, nil)
 	return chanKey, symbols, args, nil
 }
 
@@ -507,6 +999,12 @@ func (e *Binance) handleBalance(client *base.WsClient, msg map[string]string) {
 		delta, _ := utils.SafeMapVal(msg, "d", float64(0))
 		if asset, ok := balances.Assets[code]; ok {
 			asset.Free += delta
+			asset.Total += delta
+			if asset.Dec != nil {
+				deltaDec := base.ParseDec(msg["d"])
+				asset.Dec.Free = asset.Dec.Free.Add(deltaDec)
+				asset.Dec.Total = asset.Dec.Total.Add(deltaDec)
+			}
 		}
 	} else if event == "outboundAccountPosition" {
 		// 现货：余额变动
@@ -535,11 +1033,19 @@ func (e *Binance) handleBalance(client *base.WsClient, msg map[string]string) {
 				asset = &base.Asset{Code: code, Free: free, Used: lock, Total: total}
 				balances.Assets[code] = asset
 			}
+			if e.DecimalMode {
+				freeDec, lockDec := base.ParseDec(item.Free), base.ParseDec(item.Lock)
+				dec := &base.AssetDec{Free: freeDec, Used: lockDec, Total: freeDec.Add(lockDec)}
+				if asset.Dec != nil {
+					dec.Debt = asset.Dec.Debt
+				}
+				asset.Dec = dec
+			}
 		}
 	} else {
 		log.Error("invalid balance update", zap.String("event", event))
 	}
-	chanKey := client.Prefix("balance")
+	chanKey := e.userChanKey(client.AccName, client.MarketType, "balance")
 	base.WriteOutChan(e.Exchange, chanKey, *balances, true)
 }
 
@@ -614,9 +1120,18 @@ func (e *Binance) handleAccountUpdate(client *base.WsClient, msg map[string]stri
 				asset.Free += change
 				asset.Total = total
 				asset.Used = total - asset.Free
+				if asset.Dec != nil {
+					asset.Dec.Free = asset.Dec.Free.Add(base.ParseDec(item.BalanceChange))
+					asset.Dec.Total = base.ParseDec(item.WalletBalance)
+					asset.Dec.Used = asset.Dec.Total.Sub(asset.Dec.Free)
+				}
 			} else {
 				asset = &base.Asset{Code: code, Free: total, Used: 0, Total: total}
 				balances.Assets[code] = asset
+				if e.DecimalMode {
+					totalDec := base.ParseDec(item.WalletBalance)
+					asset.Dec = &base.AssetDec{Free: totalDec, Total: totalDec}
+				}
 			}
 		}
 		for _, pos := range Data.Positions {
@@ -638,6 +1153,14 @@ func (e *Binance) handleAccountUpdate(client *base.WsClient, msg map[string]stri
 			p.EntryPrice, _ = strconv.ParseFloat(pos.EntryPrice, 64)
 			p.UnrealizedPnl, _ = strconv.ParseFloat(pos.UnrealizedPnl, 64)
 			p.Contracts, _ = strconv.ParseFloat(pos.PosAmount, 64)
+			if e.DecimalMode {
+				if p.Dec == nil {
+					p.Dec = &base.PosDec{}
+				}
+				p.Dec.EntryPrice = base.ParseDec(pos.EntryPrice)
+				p.Dec.UnrealizedPnl = base.ParseDec(pos.UnrealizedPnl)
+				p.Dec.Contracts = base.ParseDec(pos.PosAmount)
+			}
 		}
 		positions = make([]*base.Position, 0, len(posMap))
 		for _, p := range posMap {
@@ -654,13 +1177,180 @@ func (e *Binance) handleAccountUpdate(client *base.WsClient, msg map[string]stri
 		return
 	}
 	if updBalance {
-		base.WriteOutChan(e.Exchange, client.Prefix("balance"), *balances, true)
+		base.WriteOutChan(e.Exchange, e.userChanKey(client.AccName, client.MarketType, "balance"), *balances, true)
 	}
 	if updPosition {
 		positions = acc.MarPositions[client.MarketType]
-		base.WriteOutChan(e.Exchange, client.Prefix("positions"), positions, true)
+		base.WriteOutChan(e.Exchange, e.userChanKey(client.AccName, client.MarketType, "positions"), positions, true)
+	}
+}
+
+/*
+handleListenKeyExpired
+listenKey过期后服务器会关闭连接，先移除旧连接避免关闭输出通道，再异步重新认证打开
+*/
+func (e *Binance) handleListenKeyExpired(client *base.WsClient) {
+	params := e.detachUserStream(client)
+	if params == nil {
+		return
+	}
+	log.Warn("listenKey expired, reopen user data stream", zap.String("acc", client.AccName),
+		zap.String("market", client.MarketType))
+	go e.reopenUserStream(client, params)
+}
+
+type WsAccountConfig struct {
+	Symbol   string `json:"s"`
+	Leverage int    `json:"l"`
+}
+
+type WsMultiAssets struct {
+	Enable bool `json:"j"`
+}
+
+/*
+handleAccountConfig
+处理合约账户配置更新：交易对杠杆倍数变化，或联合保证金模式变化
+*/
+func (e *Binance) handleAccountConfig(client *base.WsClient, msg map[string]string) {
+	evtTime, _ := utils.SafeMapVal(msg, "E", int64(0))
+	var res = base.AccountEvent{
+		Event:     base.AccEvtConfig,
+		Timestamp: evtTime,
+		Info:      msg,
+	}
+	if text, ok := msg["ac"]; ok {
+		var cfg = WsAccountConfig{}
+		err := sonic.UnmarshalString(text, &cfg)
+		if err != nil {
+			log.Error("unmarshal account config fail", zap.String("ac", text), zap.Error(err))
+			return
+		}
+		res.Symbol = e.SafeSymbol(cfg.Symbol, "", client.MarketType)
+		res.Leverage = cfg.Leverage
+		acc, err2 := e.GetAccount(client.AccName)
+		if err2 == nil {
+			for _, p := range acc.MarPositions[client.MarketType] {
+				if p.Symbol == res.Symbol {
+					p.Leverage = cfg.Leverage
+				}
+			}
+		}
+	} else if text, ok = msg["ai"]; ok {
+		var cfg = WsMultiAssets{}
+		err := sonic.UnmarshalString(text, &cfg)
+		if err != nil {
+			log.Error("unmarshal multi assets config fail", zap.String("ai", text), zap.Error(err))
+			return
+		}
+		res.MultiAssets = cfg.Enable
 	}
+	base.WriteOutChan(e.Exchange, e.userChanKey(client.AccName, client.MarketType, "accEvents"), res, false)
 }
+
+type WsMarginCallPos struct {
+	Symbol         string `json:"s"`
+	PositionSide   string `json:"ps"`
+	PosAmount      string `json:"pa"`
+	MarginType     string `json:"mt"`
+	IsolatedWallet string `json:"iw"`
+	MarkPrice      string `json:"mp"`
+	UnrealizedPnl  string `json:"up"`
+	MaintMargin    string `json:"mm"`
+}
+
+/*
+handleMarginCall
+处理追加保证金通知
+*/
+func (e *Binance) handleMarginCall(client *base.WsClient, msg map[string]string) {
+	evtTime, _ := utils.SafeMapVal(msg, "E", int64(0))
+	crossText, _ := utils.SafeMapVal(msg, "cw", "")
+	posText, _ := utils.SafeMapVal(msg, "p", "")
+	var items = make([]*WsMarginCallPos, 0)
+	err := sonic.UnmarshalString(posText, &items)
+	if err != nil {
+		log.Error("unmarshal margin call fail", zap.String("p", posText), zap.Error(err))
+		return
+	}
+	var res = base.AccountEvent{
+		Event:     base.AccEvtMarginCall,
+		Positions: make([]*base.Position, 0, len(items)),
+		Timestamp: evtTime,
+		Info:      msg,
+	}
+	res.CrossWallet, _ = strconv.ParseFloat(crossText, 64)
+	for _, item := range items {
+		side := strings.ToLower(item.PositionSide)
+		pos := &base.Position{
+			Symbol:     e.SafeSymbol(item.Symbol, "", client.MarketType),
+			TimeStamp:  evtTime,
+			Side:       side,
+			Hedged:     side != base.PosSideBoth,
+			MarginMode: item.MarginType,
+			Isolated:   item.MarginType == "ISOLATED",
+			Info:       item,
+		}
+		pos.Contracts, _ = strconv.ParseFloat(item.PosAmount, 64)
+		pos.MarkPrice, _ = strconv.ParseFloat(item.MarkPrice, 64)
+		pos.UnrealizedPnl, _ = strconv.ParseFloat(item.UnrealizedPnl, 64)
+		pos.MaintMargin, _ = strconv.ParseFloat(item.MaintMargin, 64)
+		if pos.Isolated {
+			pos.Collateral, _ = strconv.ParseFloat(item.IsolatedWallet, 64)
+		}
+		if e.DecimalMode {
+			pos.Dec = &base.PosDec{
+				Contracts:     base.ParseDec(item.PosAmount),
+				MarkPrice:     base.ParseDec(item.MarkPrice),
+				UnrealizedPnl: base.ParseDec(item.UnrealizedPnl),
+			}
+			if pos.Isolated {
+				pos.Dec.Collateral = base.ParseDec(item.IsolatedWallet)
+			}
+		}
+		res.Positions = append(res.Positions, pos)
+	}
+	base.WriteOutChan(e.Exchange, e.userChanKey(client.AccName, client.MarketType, "accEvents"), res, false)
+}
+
+type WsStrategyUpdate struct {
+	StrategyID   int64  `json:"si"`
+	StrategyType string `json:"st"`
+	Status       string `json:"ss"`
+	Symbol       string `json:"s"`
+	UpdateTime   int64  `json:"ut"`
+}
+
+/*
+handleStrategyUpdate
+处理策略交易和网格交易的状态更新
+*/
+func (e *Binance) handleStrategyUpdate(client *base.WsClient, msg map[string]string) {
+	evtTime, _ := utils.SafeMapVal(msg, "E", int64(0))
+	event, _ := utils.SafeMapVal(msg, "e", "")
+	var res = base.AccountEvent{
+		Event:     base.AccEvtStrategy,
+		Timestamp: evtTime,
+		Info:      msg,
+	}
+	field := "su"
+	if event == "GRID_UPDATE" {
+		res.Event = base.AccEvtGrid
+		field = "gu"
+	}
+	text, _ := utils.SafeMapVal(msg, field, "")
+	var upd = WsStrategyUpdate{}
+	err := sonic.UnmarshalString(text, &upd)
+	if err != nil {
+		log.Error("unmarshal strategy update fail", zap.String(field, text), zap.Error(err))
+		return
+	}
+	res.Symbol = e.SafeSymbol(upd.Symbol, "", client.MarketType)
+	res.StrategyID = upd.StrategyID
+	res.Status = upd.Status
+	base.WriteOutChan(e.Exchange, e.userChanKey(client.AccName, client.MarketType, "accEvents"), res, false)
+}
+
 func (e *Binance) handleOrderUpdate(client *base.WsClient, msg map[string]string) {
 	event, _ := utils.SafeMapVal(msg, "e", "")
 	if event == "ORDER_TRADE_UPDATE" {
@@ -673,7 +1363,7 @@ func (e *Binance) handleOrderUpdate(client *base.WsClient, msg map[string]string
 		}
 		msg = utils.MapValStr(obj)
 	}
-	trade := parseMyTrade(msg)
+	trade := parseMyTrade(msg, e.DecimalMode)
 	market := e.GetMarketById(trade.Symbol, client.MarketType)
 	if market == nil {
 		log.Error("no market found for my trade", zap.String("symbol", trade.Symbol))
@@ -684,5 +1374,5 @@ func (e *Binance) handleOrderUpdate(client *base.WsClient, msg map[string]string
 		trade.Fee.Currency = e.SafeCurrencyCode(trade.Fee.Currency)
 	}
 
-	base.WriteOutChan(e.Exchange, client.Prefix("mytrades"), trade, false)
+	base.WriteOutChan(e.Exchange, e.userChanKey(client.AccName, client.MarketType, "mytrades"), trade, false)
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/banbox/banexg/base"
 	"github.com/banbox/banexg/log"
+	"github.com/bytedance/sonic"
 	"github.com/h2non/gock"
 	"go.uber.org/zap"
 	"strconv"
@@ -83,6 +84,26 @@ mainFor:
 	}
 }
 
+func TestUnWatchBalance(t *testing.T) {
+	exg := getBinance(nil)
+	exg.MarketType = base.MarketLinear
+	out, err := exg.WatchBalance(nil)
+	if err != nil {
+		panic(err)
+	}
+	<-out
+	err = exg.UnWatchBalance(nil)
+	if err != nil {
+		panic(err)
+	}
+	if _, ok := <-out; ok {
+		t.Error("balance chan should be closed after unwatch")
+	}
+	if len(exg.authTimers) > 0 || len(exg.userStreams) > 0 {
+		t.Errorf("user stream not released, timers: %d, streams: %d", len(exg.authTimers), len(exg.userStreams))
+	}
+}
+
 func TestWatchPositions(t *testing.T) {
 	exg := getBinance(nil)
 	exg.MarketType = base.MarketLinear
@@ -112,6 +133,27 @@ mainFor:
 	}
 }
 
+func TestWatchAccountEvents(t *testing.T) {
+	exg := getBinance(nil)
+	exg.MarketType = base.MarketLinear
+	out, err := exg.WatchAccountEvents(nil)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("start watching account events")
+mainFor:
+	for {
+		select {
+		case evt, ok := <-out:
+			if !ok {
+				log.Info("read out chan fail, break")
+				break mainFor
+			}
+			fmt.Printf("%s %s leverage: %v, positions: %v\n", evt.Event, evt.Symbol, evt.Leverage, len(evt.Positions))
+		}
+	}
+}
+
 func TestWatchMarkPrices(t *testing.T) {
 	exg := getBinance(nil)
 	exg.MarketType = base.MarketLinear
@@ -143,3 +185,57 @@ mainFor:
 		}
 	}
 }
+
+func TestWatchLiquidations(t *testing.T) {
+	exg := getBinance(nil)
+	exg.MarketType = base.MarketLinear
+	// 监听所有币种的强平订单
+	out, err := exg.WatchLiquidations(nil, nil)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("start watching liquidations")
+mainFor:
+	for {
+		select {
+		case liq, ok := <-out:
+			if !ok {
+				log.Info("read out chan fail, break")
+				break mainFor
+			}
+			fmt.Printf("%s %s %v @ %v, value: %v\n", liq.Symbol, liq.Side, liq.Contracts, liq.Price, liq.QuoteValue)
+		}
+	}
+}
+
+const benchKlineMsg = `{"stream":"ethusdt@kline_1m","data":{"e":"kline","E":1703936451333,"s":"ETHUSDT","k":{"t":1703936400000,"T":1703936459999,"s":"ETHUSDT","i":"1m","f":3296520870,"L":3296521500,"o":"2285.04","c":"2285.75","h":"2286.20","l":"2284.81","v":"1523.447","n":631,"x":false,"q":"3481422.50816","V":"811.202","Q":"1853814.31032","B":"0"}}}`
+
+// BenchmarkKlineMapDecode 旧的解析方式：先解析为map[string]string，再二次解析k字段
+func BenchmarkKlineMapDecode(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msg, err := base.NewWsMsg(benchKlineMsg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var k = WsKline{}
+		if err := sonic.UnmarshalString(msg.Object["k"], &k); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkKlineTypedDecode 读取事件类型后直接解析为WsKlineEvent
+func BenchmarkKlineTypedDecode(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		event, _, payload := base.PeekWsEvent(benchKlineMsg)
+		if event != "kline" {
+			b.Fatal("bad event: " + event)
+		}
+		var msg = WsKlineEvent{}
+		if err := sonic.UnmarshalString(payload, &msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,548 @@
+package binance
+
+import (
+	"context"
+	"github.com/banbox/banexg/base"
+	"github.com/banbox/banexg/errs"
+	"github.com/banbox/banexg/log"
+	"github.com/banbox/banexg/utils"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+wsShard
+一个组合流连接，URL为：<host>/stream#<序号>，#之后仅用于区分连接，不会发送到服务器
+*/
+type wsShard struct {
+	url      string
+	streams  map[string]struct{}
+	sendMS   []int64 // 最近1s内发送订阅消息的时间戳
+	sendLock sync.Mutex
+}
+
+/*
+wsStreamPool
+某个市场的所有组合流连接，新的stream优先放入序号小且未满的连接
+*/
+type wsStreamPool struct {
+	host        string
+	shards      []*wsShard
+	byStream    map[string]*wsShard
+	streamChans map[string]map[string]struct{} // stream: 输出通道keys，同一stream可被多个通道使用
+	chanStreams map[string]map[string]struct{} // 输出通道key: streams
+	nextIdx     int
+}
+
+type wsShardStreams struct {
+	shard   *wsShard
+	streams []string
+}
+
+/*
+streamHost
+返回组合流的地址：/ws结尾的替换为/stream，否则追加/stream
+*/
+func (e *Binance) streamHost(marType string) (string, *errs.Error) {
+	host := e.Hosts.GetHost(marType)
+	if host == "" {
+		return "", errs.NewMsg(errs.CodeParamInvalid, "unsupport wss host for %s: %s", e.Name, marType)
+	}
+	if strings.HasSuffix(host, "/ws") {
+		return strings.TrimSuffix(host, "/ws") + "/stream", nil
+	}
+	return host + "/stream", nil
+}
+
+/*
+wsChanKey
+返回公共行情流的输出通道key，同一市场所有组合流连接共享
+*/
+func (e *Binance) wsChanKey(marType, msgHash string) string {
+	host, _ := e.streamHost(marType)
+	return base.WsPrefix("", host, msgHash)
+}
+
+func (e *Binance) nextWsRequestId(wsUrl string) int {
+	e.wsReqLock.Lock()
+	requestId := e.wsRequestId[wsUrl] + 1
+	e.wsRequestId[wsUrl] = requestId
+	e.wsReqLock.Unlock()
+	return requestId
+}
+
+/*
+writeWsStreams
+订阅或取消订阅公共行情流。stream被分配到组合流连接中，每个连接最多streamLimits个stream；
+每个连接每秒发送的消息数不超过subMsgLimits。取消订阅后会合并稀疏的连接。
+chanKey为这些stream的输出通道，连接断开时只关闭所有stream都在此连接上的通道。
+getJob可为nil，否则对每个连接的请求调用一次，用于处理订阅结果
+*/
+func (e *Binance) writeWsStreams(marType, method, chanKey string, streams []string,
+	getJob func(streams []string) (*base.WsJobInfo, *errs.Error)) *errs.Error {
+	host, err := e.streamHost(marType)
+	if err != nil {
+		return err
+	}
+	groups := e.assignStreams(marType, host, method, chanKey, streams)
+	for _, g := range groups {
+		var jobInfo *base.WsJobInfo
+		if getJob != nil {
+			jobInfo, err = getJob(g.streams)
+			if err != nil {
+				return err
+			}
+		}
+		err = e.writeShard(marType, g.shard, method, g.streams, jobInfo)
+		if err != nil {
+			if method == "SUBSCRIBE" {
+				e.dropShardStreams(marType, g.shard, g.streams)
+			}
+			return err
+		}
+	}
+	if method == "UNSUBSCRIBE" {
+		e.rebalanceStreams(marType)
+	}
+	return nil
+}
+
+func (e *Binance) writeShard(marType string, shard *wsShard, method string, streams []string, jobInfo *base.WsJobInfo) *errs.Error {
+	client, err := e.GetClient(shard.url, marType, "")
+	if err != nil {
+		return err
+	}
+	requestId := e.nextWsRequestId(shard.url)
+	if jobInfo != nil {
+		jobInfo.ID = strconv.Itoa(requestId)
+	}
+	var request = map[string]interface{}{
+		"method": method,
+		"params": streams,
+		"id":     requestId,
+	}
+	e.paceShard(marType, shard)
+	return client.Write(request, jobInfo)
+}
+
+/*
+paceShard
+限制每个连接每秒发送的消息数，超出时等待
+*/
+func (e *Binance) paceShard(marType string, shard *wsShard) {
+	limit, ok := e.subMsgLimits[marType]
+	if !ok {
+		limit = 5
+	}
+	shard.sendLock.Lock()
+	defer shard.sendLock.Unlock()
+	now := e.MilliSeconds()
+	cut := 0
+	for cut < len(shard.sendMS) && now-shard.sendMS[cut] >= 1000 {
+		cut += 1
+	}
+	shard.sendMS = shard.sendMS[cut:]
+	if len(shard.sendMS) >= limit {
+		waitMS := shard.sendMS[0] + 1000 - now
+		log.Debug("pace ws subscribe", zap.String("url", shard.url), zap.Int64("wait", waitMS))
+		time.Sleep(time.Duration(waitMS) * time.Millisecond)
+		shard.sendMS = shard.sendMS[1:]
+		now = e.MilliSeconds()
+	}
+	shard.sendMS = append(shard.sendMS, now)
+}
+
+func (e *Binance) getStreamPool(marType, host string) *wsStreamPool {
+	pool, ok := e.streamPools[marType]
+	if !ok {
+		pool = &wsStreamPool{
+			host:        host,
+			byStream:    map[string]*wsShard{},
+			streamChans: map[string]map[string]struct{}{},
+			chanStreams: map[string]map[string]struct{}{},
+		}
+		e.streamPools[marType] = pool
+	}
+	return pool
+}
+
+func (e *Binance) getStreamLimit(marType string) int {
+	limit, ok := e.streamLimits[marType]
+	if !ok {
+		limit = 1024
+		log.Warn("ws streamLimits not config, use default", zap.String("name", e.Name), zap.String("type", marType))
+	}
+	return limit
+}
+
+/*
+assignStreams
+为stream分配连接并按连接分组。已订阅的stream仍发送到原连接（用于获取订阅结果）
+*/
+func (e *Binance) assignStreams(marType, host, method, chanKey string, streams []string) []*wsShardStreams {
+	e.streamLock.Lock()
+	defer e.streamLock.Unlock()
+	pool := e.getStreamPool(marType, host)
+	limit := e.getStreamLimit(marType)
+	var groups []*wsShardStreams
+	var groupMap = map[*wsShard]*wsShardStreams{}
+	addTo := func(shard *wsShard, stream string) {
+		g, ok := groupMap[shard]
+		if !ok {
+			g = &wsShardStreams{shard: shard}
+			groupMap[shard] = g
+			groups = append(groups, g)
+		}
+		g.streams = append(g.streams, stream)
+	}
+	for _, stream := range streams {
+		shard, ok := pool.byStream[stream]
+		if method == "UNSUBSCRIBE" {
+			if ok {
+				pool.unbindChan(stream, chanKey)
+				if len(pool.streamChans[stream]) > 0 {
+					// 其他输出通道仍在使用此stream，不取消订阅
+					continue
+				}
+				delete(shard.streams, stream)
+				delete(pool.byStream, stream)
+				addTo(shard, stream)
+			}
+			continue
+		}
+		pool.bindChan(stream, chanKey)
+		if !ok {
+			for _, sh := range pool.shards {
+				if len(sh.streams) < limit {
+					shard = sh
+					break
+				}
+			}
+			if shard == nil {
+				shard = &wsShard{
+					url:     pool.host + "#" + strconv.Itoa(pool.nextIdx),
+					streams: map[string]struct{}{},
+				}
+				pool.nextIdx += 1
+				pool.shards = append(pool.shards, shard)
+			}
+			shard.streams[stream] = struct{}{}
+			pool.byStream[stream] = shard
+		}
+		addTo(shard, stream)
+	}
+	return groups
+}
+
+/*
+dropShardStreams
+订阅失败时，从连接中移除stream
+*/
+func (e *Binance) dropShardStreams(marType string, shard *wsShard, streams []string) {
+	e.streamLock.Lock()
+	defer e.streamLock.Unlock()
+	pool, ok := e.streamPools[marType]
+	if !ok {
+		return
+	}
+	for _, stream := range streams {
+		if pool.byStream[stream] == shard {
+			delete(pool.byStream, stream)
+			pool.unbindChan(stream, "")
+		}
+		delete(shard.streams, stream)
+	}
+}
+
+/*
+bindChan
+关联stream与输出通道，已关联的其他通道保持不变
+*/
+func (p *wsStreamPool) bindChan(stream, chanKey string) {
+	if chanKey == "" {
+		return
+	}
+	chanKeys, ok := p.streamChans[stream]
+	if !ok {
+		chanKeys = map[string]struct{}{}
+		p.streamChans[stream] = chanKeys
+	}
+	chanKeys[chanKey] = struct{}{}
+	streams, ok := p.chanStreams[chanKey]
+	if !ok {
+		streams = map[string]struct{}{}
+		p.chanStreams[chanKey] = streams
+	}
+	streams[stream] = struct{}{}
+}
+
+/*
+unbindChan
+解除stream与输出通道chanKey的关联，chanKey为空时解除所有通道。
+返回已没有任何stream的通道keys，以及是否有通道仍有其他stream
+*/
+func (p *wsStreamPool) unbindChan(stream, chanKey string) ([]string, bool) {
+	chanKeys, ok := p.streamChans[stream]
+	if !ok {
+		return nil, false
+	}
+	var unbinds []string
+	if chanKey == "" {
+		for key := range chanKeys {
+			unbinds = append(unbinds, key)
+		}
+	} else if _, ok = chanKeys[chanKey]; ok {
+		unbinds = append(unbinds, chanKey)
+	}
+	var empties []string
+	shared := false
+	for _, key := range unbinds {
+		delete(chanKeys, key)
+		streams := p.chanStreams[key]
+		delete(streams, stream)
+		if len(streams) > 0 {
+			shared = true
+		} else {
+			delete(p.chanStreams, key)
+			empties = append(empties, key)
+		}
+	}
+	if len(chanKeys) == 0 {
+		delete(p.streamChans, stream)
+	}
+	return empties, shared
+}
+
+/*
+closeClientChans
+连接断开且不再重连时调用。组合流分片连接移除其所有stream，只关闭所有stream都在此连接上的输出通道，
+其他分片上仍有stream的通道保持打开；其他连接关闭client.Prefix("")开头的所有通道
+*/
+func (e *Binance) closeClientChans(client *base.WsClient) int {
+	e.streamLock.Lock()
+	var shard *wsShard
+	pool, ok := e.streamPools[client.MarketType]
+	if ok {
+		for i, sh := range pool.shards {
+			if sh.url == client.URL {
+				shard = sh
+				pool.shards = append(pool.shards[:i], pool.shards[i+1:]...)
+				break
+			}
+		}
+	}
+	if shard == nil {
+		e.streamLock.Unlock()
+		return e.closeUserChans(client)
+	}
+	var closeKeys []string
+	var lost []string
+	for stream := range shard.streams {
+		delete(pool.byStream, stream)
+		empties, shared := pool.unbindChan(stream, "")
+		closeKeys = append(closeKeys, empties...)
+		if shared {
+			lost = append(lost, stream)
+		}
+	}
+	shard.streams = map[string]struct{}{}
+	e.streamLock.Unlock()
+	if len(lost) > 0 {
+		log.Warn("ws shard closed, streams lost on shared chans", zap.String("url", client.URL),
+			zap.Strings("streams", lost))
+	}
+	num := 0
+	for _, chanKey := range closeKeys {
+		if e.CloseWsChan(chanKey) {
+			num += 1
+		}
+	}
+	return num
+}
+
+/*
+rebalanceStreams
+连接数多于所需时，将stream最少的连接中的stream迁移到其他连接，然后关闭此连接。
+先在目标连接订阅，再在原连接取消订阅，避免丢失消息
+*/
+func (e *Binance) rebalanceStreams(marType string) {
+	for {
+		src, moves := e.planRebalance(marType)
+		if src == nil {
+			return
+		}
+		var moved []string
+		var failed []*wsShardStreams
+		for _, g := range moves {
+			err := e.writeShard(marType, g.shard, "SUBSCRIBE", g.streams, nil)
+			if err != nil {
+				log.Error("rebalance ws streams fail", zap.String("url", g.shard.url), zap.Error(err))
+				failed = append(failed, g)
+				continue
+			}
+			moved = append(moved, g.streams...)
+		}
+		clientKey := "@" + src.url
+		e.WsLock.Lock()
+		client, ok := e.WSClients[clientKey]
+		if ok && len(failed) == 0 {
+			delete(e.WSClients, clientKey)
+		}
+		e.WsLock.Unlock()
+		if ok && len(moved) > 0 && client.Conn != nil {
+			err := e.writeShard(marType, src, "UNSUBSCRIBE", moved, nil)
+			if err != nil {
+				log.Warn("unsubscribe moved streams fail", zap.String("url", src.url), zap.Error(err))
+			}
+		}
+		if len(failed) > 0 {
+			// 迁移失败的stream保留在原连接，不关闭原连接，下次取消订阅时再尝试合并
+			e.restoreShard(marType, src, moved, failed)
+			log.Warn("keep ws shard for failed streams", zap.String("url", src.url), zap.Int("moved", len(moved)))
+			return
+		}
+		if ok && client.Conn != nil {
+			client.Close()
+		}
+		log.Info("merged ws shard", zap.String("url", src.url), zap.Int("moved", len(moved)))
+	}
+}
+
+/*
+restoreShard
+迁移部分失败时，将src放回连接池，迁移失败的stream从目标连接移回src
+*/
+func (e *Binance) restoreShard(marType string, src *wsShard, moved []string, failed []*wsShardStreams) {
+	e.streamLock.Lock()
+	defer e.streamLock.Unlock()
+	pool, ok := e.streamPools[marType]
+	if !ok {
+		return
+	}
+	pool.shards = append(pool.shards, src)
+	for _, stream := range moved {
+		delete(src.streams, stream)
+	}
+	for _, g := range failed {
+		for _, stream := range g.streams {
+			delete(g.shard.streams, stream)
+			if _, ok := pool.byStream[stream]; ok {
+				pool.byStream[stream] = src
+			}
+		}
+	}
+}
+
+/*
+planRebalance
+返回需要关闭的连接，以及其stream迁移到的目标连接。无需合并时返回nil
+*/
+func (e *Binance) planRebalance(marType string) (*wsShard, []*wsShardStreams) {
+	e.streamLock.Lock()
+	defer e.streamLock.Unlock()
+	pool, ok := e.streamPools[marType]
+	if !ok || len(pool.shards) == 0 {
+		return nil, nil
+	}
+	limit := e.getStreamLimit(marType)
+	needNum := (len(pool.byStream) + limit - 1) / limit
+	if len(pool.shards) <= needNum {
+		return nil, nil
+	}
+	srcIdx := 0
+	for i, sh := range pool.shards {
+		if len(sh.streams) <= len(pool.shards[srcIdx].streams) {
+			srcIdx = i
+		}
+	}
+	src := pool.shards[srcIdx]
+	pool.shards = append(pool.shards[:srcIdx], pool.shards[srcIdx+1:]...)
+	var moves []*wsShardStreams
+	var moveMap = map[*wsShard]*wsShardStreams{}
+	for stream := range src.streams {
+		for _, sh := range pool.shards {
+			if len(sh.streams) >= limit {
+				continue
+			}
+			sh.streams[stream] = struct{}{}
+			pool.byStream[stream] = sh
+			g, ok := moveMap[sh]
+			if !ok {
+				g = &wsShardStreams{shard: sh}
+				moveMap[sh] = g
+				moves = append(moves, g)
+			}
+			g.streams = append(g.streams, stream)
+			break
+		}
+	}
+	return src, moves
+}
+
+/*
+Close
+取消订阅所有公共行情流（等待写入连接后再关闭），关闭用户数据流并删除listenKey，
+停止续期定时器和订单簿重新同步，最后关闭所有websocket连接和输出通道
+*/
+func (e *Binance) Close(ctx context.Context) *errs.Error {
+	e.streamLock.Lock()
+	pools := e.streamPools
+	e.streamPools = map[string]*wsStreamPool{}
+	e.streamLock.Unlock()
+	for _, pool := range pools {
+		for _, shard := range pool.shards {
+			client, ok := e.GetWsClient("@" + shard.url)
+			if !ok || client.IsClosed() || len(shard.streams) == 0 {
+				continue
+			}
+			streams := make([]string, 0, len(shard.streams))
+			for stream := range shard.streams {
+				streams = append(streams, stream)
+			}
+			var request = map[string]interface{}{
+				"method": "UNSUBSCRIBE",
+				"params": streams,
+				"id":     e.nextWsRequestId(shard.url),
+			}
+			if err := client.WriteWait(ctx, request, nil); err != nil {
+				log.Warn("unsubscribe streams fail", zap.String("url", shard.url), zap.Error(err))
+			}
+		}
+	}
+	e.userLock.Lock()
+	userStreams := e.userStreams
+	e.userStreams = map[string]*map[string]interface{}{}
+	e.userLock.Unlock()
+	for clientKey, params := range userStreams {
+		client, ok := e.GetWsClient(clientKey)
+		if !ok {
+			continue
+		}
+		acc, err := e.GetAccount(client.AccName)
+		if err != nil {
+			continue
+		}
+		args := utils.SafeParams(params)
+		args[base.ParamAccount] = acc.Name
+		if err = e.closeUserStream(acc, client.MarketType, args); err != nil {
+			log.Warn("close user data stream fail", zap.String("acc", acc.Name), zap.Error(err))
+		}
+	}
+	e.userLock.Lock()
+	for key, timer := range e.authTimers {
+		timer.Stop()
+		delete(e.authTimers, key)
+	}
+	e.userLock.Unlock()
+	e.bookLock.Lock()
+	e.bookJobs = map[string]*base.WsJobInfo{}
+	e.OrderBooks = map[string]*base.OrderBook{}
+	e.bookLock.Unlock()
+	e.optionLock.Lock()
+	e.optionChains = map[string]*base.OptionChain{}
+	e.optionLock.Unlock()
+	return e.Exchange.Close(ctx)
+}
@@ -0,0 +1,180 @@
+package binance
+
+import (
+	"context"
+	"github.com/banbox/banexg/base"
+	"github.com/h2non/gock"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAssignStreams(t *testing.T) {
+	exg := &Binance{
+		Exchange:     &base.Exchange{Name: "binance"},
+		streamPools:  map[string]*wsStreamPool{},
+		streamLimits: map[string]int{base.MarketLinear: 2},
+	}
+	host := "wss://fstream.binance.com/stream"
+	groups := exg.assignStreams(base.MarketLinear, host, "SUBSCRIBE", "kline", []string{"a@kline_1m", "b@kline_1m", "c@kline_1m"})
+	if len(groups) != 2 || len(groups[0].streams) != 2 || len(groups[1].streams) != 1 {
+		t.Fatalf("assign fail, groups: %d", len(groups))
+	}
+	if groups[0].shard.url != host+"#0" || groups[1].shard.url != host+"#1" {
+		t.Errorf("bad shard url: %s %s", groups[0].shard.url, groups[1].shard.url)
+	}
+	exg.assignStreams(base.MarketLinear, host, "UNSUBSCRIBE", "kline", []string{"a@kline_1m"})
+	src, moves := exg.planRebalance(base.MarketLinear)
+	if src == nil || src.url != host+"#1" || len(moves) != 1 || moves[0].streams[0] != "c@kline_1m" {
+		t.Fatalf("rebalance plan fail")
+	}
+	pool := exg.streamPools[base.MarketLinear]
+	if len(pool.shards) != 1 || len(pool.shards[0].streams) != 2 {
+		t.Errorf("pool not merged, shards: %d", len(pool.shards))
+	}
+	src, _ = exg.planRebalance(base.MarketLinear)
+	if src != nil {
+		t.Errorf("should not merge again")
+	}
+}
+
+func TestCloseShardChans(t *testing.T) {
+	exg := &Binance{
+		Exchange: &base.Exchange{Name: "binance", WsOutChans: map[string]interface{}{},
+			WsChanRefs: map[string]map[string]struct{}{}},
+		streamPools:  map[string]*wsStreamPool{},
+		streamLimits: map[string]int{base.MarketLinear: 2},
+	}
+	host := "wss://fstream.binance.com/stream"
+	exg.assignStreams(base.MarketLinear, host, "SUBSCRIBE", "kline", []string{"a@kline_1m", "b@kline_1m", "c@kline_1m"})
+	exg.assignStreams(base.MarketLinear, host, "SUBSCRIBE", "depth", []string{"a@depth"})
+	kline, depth := make(chan int), make(chan int)
+	exg.WsOutChans["kline"] = kline
+	exg.WsOutChans["depth"] = depth
+	// 第二个分片只有kline的c和depth的a，断开后只关闭depth
+	client := &base.WsClient{URL: host + "#1", MarketType: base.MarketLinear}
+	if num := exg.closeClientChans(client); num != 1 {
+		t.Errorf("should close 1 chan, got %d", num)
+	}
+	if _, ok := <-depth; ok {
+		t.Error("depth chan should be closed")
+	}
+	if _, ok := exg.WsOutChans["kline"]; !ok {
+		t.Error("kline chan should keep open")
+	}
+	pool := exg.streamPools[base.MarketLinear]
+	if len(pool.shards) != 1 || len(pool.byStream) != 2 || len(pool.chanStreams["kline"]) != 2 {
+		t.Errorf("bad pool after shard closed: %d %d", len(pool.shards), len(pool.byStream))
+	}
+}
+
+func TestSharedStreamChans(t *testing.T) {
+	exg := &Binance{
+		Exchange: &base.Exchange{Name: "binance", WsOutChans: map[string]interface{}{},
+			WsChanRefs: map[string]map[string]struct{}{}},
+		streamPools:  map[string]*wsStreamPool{},
+		streamLimits: map[string]int{base.MarketOption: 10},
+	}
+	host := "wss://nbstream.binance.com/eoptions/stream"
+	exg.assignStreams(base.MarketOption, host, "SUBSCRIBE", "mark", []string{"BTC@markPrice"})
+	exg.assignStreams(base.MarketOption, host, "SUBSCRIBE", "chain", []string{"BTC@markPrice"})
+	pool := exg.streamPools[base.MarketOption]
+	if len(pool.streamChans["BTC@markPrice"]) != 2 {
+		t.Fatalf("stream should bind 2 chans, got %v", pool.streamChans)
+	}
+	// 另一个通道仍在使用，不应取消订阅
+	groups := exg.assignStreams(base.MarketOption, host, "UNSUBSCRIBE", "chain", []string{"BTC@markPrice"})
+	if len(groups) != 0 || pool.byStream["BTC@markPrice"] == nil {
+		t.Fatalf("shared stream should keep subscribed, groups: %d", len(groups))
+	}
+	exg.assignStreams(base.MarketOption, host, "SUBSCRIBE", "chain", []string{"BTC@markPrice"})
+	mark, chain := make(chan int), make(chan int)
+	exg.WsOutChans["mark"] = mark
+	exg.WsOutChans["chain"] = chain
+	client := &base.WsClient{URL: host + "#0", MarketType: base.MarketOption}
+	if num := exg.closeClientChans(client); num != 2 {
+		t.Errorf("should close 2 chans, got %d", num)
+	}
+}
+
+type closeWsConn struct {
+	closed chan struct{}
+	once   sync.Once
+	lock   sync.Mutex
+	sent   []string
+}
+
+func (c *closeWsConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *closeWsConn) WriteClose() error {
+	return c.Close()
+}
+
+func (c *closeWsConn) NextWriter() (io.WriteCloser, error) {
+	return &sentWriter{conn: c}, nil
+}
+
+func (c *closeWsConn) ReadMsg() ([]byte, error) {
+	<-c.closed
+	return nil, io.EOF
+}
+
+type sentWriter struct {
+	conn *closeWsConn
+	buf  []byte
+}
+
+func (w *sentWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+func (w *sentWriter) Close() error {
+	w.conn.lock.Lock()
+	w.conn.sent = append(w.conn.sent, string(w.buf))
+	w.conn.lock.Unlock()
+	return nil
+}
+
+func TestClose(t *testing.T) {
+	gock.DisableNetworking()
+	err := LoadGockItems("testdata/gock.json")
+	if err != nil {
+		panic(err)
+	}
+	conn := &closeWsConn{closed: make(chan struct{})}
+	exg := getBinance(&map[string]interface{}{
+		base.OptWsConn:    conn,
+		base.OptApiKey:    "fake",
+		base.OptApiSecret: "fake",
+	})
+	gock.InterceptClient(exg.HttpClient)
+	out, err_ := exg.WatchOhlcvs([][2]string{{"ETH/USDT:USDT", "1m"}}, nil)
+	if err_ != nil {
+		panic(err_)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	err_ = exg.Close(ctx)
+	if err_ != nil {
+		t.Fatalf("close fail: %v", err_)
+	}
+	if _, ok := <-out; ok {
+		t.Error("out chan should be closed")
+	}
+	// 取消订阅应在关闭连接前写入
+	conn.lock.Lock()
+	sent := strings.Join(conn.sent, "\n")
+	conn.lock.Unlock()
+	if !strings.Contains(sent, "UNSUBSCRIBE") {
+		t.Errorf("unsubscribe not sent before close: %s", sent)
+	}
+	if len(exg.WSClients) > 0 || len(exg.WsOutChans) > 0 {
+		t.Errorf("clients or chans left: %d %d", len(exg.WSClients), len(exg.WsOutChans))
+	}
+}
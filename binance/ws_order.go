@@ -7,46 +7,19 @@ import (
 	"github.com/banbox/banexg/errs"
 	"github.com/banbox/banexg/log"
 	"github.com/banbox/banexg/utils"
-	"github.com/bytedance/sonic"
 	"go.uber.org/zap"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
 	contOdBookLimits = []int{5, 10, 20, 50, 100, 500, 1000}
+	bookSnapLevels   = []int{5, 10, 20}
+	spotSnapSpeeds   = []int{100, 1000}
+	contSnapSpeeds   = []int{100, 250, 500}
 )
 
-func (e *Binance) Stream(marType, subHash string) string {
-	if stream, ok := e.streamBySubHash[subHash]; ok {
-		return stream
-	}
-	limit, ok := e.streamLimits[marType]
-	if !ok {
-		limit = 50
-		log.Warn("ws streamLimits not config, use default", zap.String("name", e.Name), zap.String("type", marType))
-	}
-	e.streamIndex += 1
-	stream := strconv.Itoa(e.streamIndex % limit)
-	e.streamBySubHash[subHash] = stream
-	return stream
-}
-
-func (e *Binance) GetWsClient(marType, msgHash string) (*base.WsClient, int, *errs.Error) {
-	host := e.Hosts.GetHost(marType)
-	if host == "" {
-		return nil, 0, errs.NewMsg(errs.CodeParamInvalid, "unsupport wss host for %s: %s", e.Name, marType)
-	}
-	wsUrl := host + "/" + e.Stream(marType, msgHash)
-	requestId := e.wsRequestId[wsUrl] + 1
-	e.wsRequestId[wsUrl] = requestId
-	client, err := e.GetClient(wsUrl, marType, "")
-	if err != nil {
-		return nil, 0, err
-	}
-	return client, requestId, nil
-}
-
 /*
 WatchOrderBooks
 watches information on open orders with bid(buy) and ask(sell) prices, volumes and other data
@@ -64,9 +37,9 @@ func (e *Binance) WatchOrderBooks(symbols []string, limit int, params *map[strin
 		#
 		# default 100, max 1000, valid limits 5, 10, 20, 50, 100, 500, 1000
 	*/
-	getJobFn := func(client *base.WsClient) (*base.WsJobInfo, *errs.Error) {
+	getJobFn := func(marketType string) (*base.WsJobInfo, *errs.Error) {
 		if limit != 0 {
-			if e.IsContract(client.MarketType) {
+			if e.IsContract(marketType) {
 				if !utils.ArrContains(contOdBookLimits, limit) {
 					return nil, errs.NewMsg(errs.CodeParamInvalid, "WatchOrderBooks.limit must be 0,5,10,20,50,100,500,1000")
 				}
@@ -129,9 +102,216 @@ func (e *Binance) UnWatchOrderBooks(symbols []string, params *map[string]interfa
 		return err
 	}
 	e.DelWsChanRefs(chanKey, symbols...)
+	e.bookLock.Lock()
+	for _, sym := range symbols {
+		delete(e.bookJobs, sym)
+	}
+	e.bookLock.Unlock()
 	return nil
 }
 
+/*
+WatchOrderBookSnapshots
+订阅有限档深度信息，每次推送完整的前N档订单簿，无需请求rest快照
+
+	:see: https://binance-docs.github.io/apidocs/spot/en/#partial-book-depth-streams
+	:see: https://binance-docs.github.io/apidocs/futures/en/#partial-book-depth-streams
+	:param []string symbols: unified symbols, must be the same market type
+	:param int levels: 5, 10 or 20
+	:param int speedMs: spot: 100/1000(default), linear/inverse: 100/250(default)/500
+	:param dict [params]: extra parameters specific to the exchange API endpoint
+*/
+func (e *Binance) WatchOrderBookSnapshots(symbols []string, levels, speedMs int, params *map[string]interface{}) (chan base.OrderBook, *errs.Error) {
+	if !utils.ArrContains(bookSnapLevels, levels) {
+		return nil, errs.NewMsg(errs.CodeParamInvalid, "WatchOrderBookSnapshots.levels must be 5,10,20")
+	}
+	if len(symbols) == 0 {
+		return nil, errs.NewMsg(errs.CodeParamRequired, "symbols required for WatchOrderBookSnapshots")
+	}
+	args, market, err := e.LoadArgsMarket(symbols[0], params)
+	if err != nil {
+		return nil, err
+	}
+	var suffix = fmt.Sprintf("depth%d", levels)
+	if e.IsContract(market.Type) {
+		if market.Option {
+			return nil, errs.NewMsg(errs.CodeUnsupportMarket, "WatchOrderBookSnapshots not support option")
+		}
+		if speedMs != 0 && !utils.ArrContains(contSnapSpeeds, speedMs) {
+			return nil, errs.NewMsg(errs.CodeParamInvalid, "WatchOrderBookSnapshots.speedMs must be 0,100,250,500")
+		}
+		if speedMs != 0 && speedMs != 250 {
+			suffix += fmt.Sprintf("@%dms", speedMs)
+		}
+	} else {
+		if speedMs != 0 && !utils.ArrContains(spotSnapSpeeds, speedMs) {
+			return nil, errs.NewMsg(errs.CodeParamInvalid, "WatchOrderBookSnapshots.speedMs must be 0,100,1000")
+		}
+		if speedMs == 100 {
+			suffix += "@100ms"
+		}
+	}
+	exgParams, err := e.getExgWsParams(symbols, suffix)
+	if err != nil {
+		return nil, err
+	}
+	chanKey, err := e.writeBookSnapSub("SUBSCRIBE", market.Type, levels, exgParams)
+	if err != nil {
+		return nil, err
+	}
+	e.bookLock.Lock()
+	for i, sym := range symbols {
+		// 同一symbol可订阅多个档位，分别记录以便取消订阅
+		streams, ok := e.bookSnapStreams[sym]
+		if !ok {
+			streams = make(map[string]bool)
+			e.bookSnapStreams[sym] = streams
+		}
+		streams[exgParams[i]] = true
+	}
+	e.bookLock.Unlock()
+	create := func(cap int) chan base.OrderBook { return make(chan base.OrderBook, cap) }
+	out := base.GetWsOutChan(e.Exchange, chanKey, create, args)
+	e.AddWsChanRefs(chanKey, symbols...)
+	return out, nil
+}
+
+/*
+UnWatchOrderBookSnapshots
+取消symbols所有档位的有限档深度订阅，每个档位的输出通道分别减少引用
+*/
+func (e *Binance) UnWatchOrderBookSnapshots(symbols []string, params *map[string]interface{}) *errs.Error {
+	if len(symbols) == 0 {
+		return errs.NewMsg(errs.CodeParamRequired, "symbols required for UnWatchOrderBookSnapshots")
+	}
+	_, market, err := e.LoadArgsMarket(symbols[0], params)
+	if err != nil {
+		return err
+	}
+	// 档位: symbol: stream
+	var levelStreams = make(map[int]map[string]string)
+	e.bookLock.Lock()
+	for _, sym := range symbols {
+		for stream := range e.bookSnapStreams[sym] {
+			levels := parseSnapLevels(stream)
+			items, ok := levelStreams[levels]
+			if !ok {
+				items = make(map[string]string)
+				levelStreams[levels] = items
+			}
+			items[sym] = stream
+		}
+	}
+	e.bookLock.Unlock()
+	for levels, items := range levelStreams {
+		exgParams := make([]string, 0, len(items))
+		syms := make([]string, 0, len(items))
+		for sym, stream := range items {
+			exgParams = append(exgParams, stream)
+			syms = append(syms, sym)
+		}
+		chanKey, err := e.writeBookSnapSub("UNSUBSCRIBE", market.Type, levels, exgParams)
+		if err != nil {
+			return err
+		}
+		// 取消订阅成功后才移除记录，失败时可重试
+		e.bookLock.Lock()
+		for sym, stream := range items {
+			if streams, ok := e.bookSnapStreams[sym]; ok {
+				delete(streams, stream)
+				if len(streams) == 0 {
+					delete(e.bookSnapStreams, sym)
+				}
+			}
+		}
+		e.bookLock.Unlock()
+		e.DelWsChanRefs(chanKey, syms...)
+	}
+	return nil
+}
+
+/*
+bookSnapChanKey
+有限档深度的输出通道按档位区分，如linear@depthSnap5
+*/
+func bookSnapChanKey(marketType string, levels int) string {
+	return fmt.Sprintf("%s@depthSnap%d", marketType, levels)
+}
+
+/*
+parseSnapLevels
+从有限档深度的stream中解析档位，如btcusdt@depth5@100ms返回5
+*/
+func parseSnapLevels(stream string) int {
+	parts := strings.Split(stream, "@")
+	if len(parts) < 2 {
+		return 0
+	}
+	levels, _ := strconv.Atoi(strings.TrimPrefix(parts[1], "depth"))
+	return levels
+}
+
+func (e *Binance) writeBookSnapSub(method, marketType string, levels int, exgParams []string) (string, *errs.Error) {
+	chanKey := e.wsChanKey(marketType, bookSnapChanKey(marketType, levels))
+	err := e.writeWsStreams(marketType, method, chanKey, exgParams, nil)
+	if err != nil {
+		return "", err
+	}
+	return chanKey, nil
+}
+
+func isPartialDepth(stream string) bool {
+	parts := strings.Split(stream, "@")
+	if len(parts) < 2 {
+		return false
+	}
+	switch parts[1] {
+	case "depth5", "depth10", "depth20":
+		return true
+	}
+	return false
+}
+
+/*
+handleOrderBookSnapshot
+处理有限档深度推送，现货和合约格式不同：
+
+	spot: {"lastUpdateId":160,"bids":[["0.0024","10"]],"asks":[["0.0026","100"]]}
+	futures: {"e":"depthUpdate","E":1571889248277,"T":1571889248276,"s":"BTCUSDT","U":390497796,"u":390497878,"pu":390497794,"b":[["7403.89","0.002"]],"a":[["7405.96","3.340"]]}
+*/
+func (e *Binance) handleOrderBookSnapshot(client *base.WsClient, stream string, msg map[string]string) {
+	marketId := strings.ToUpper(strings.Split(stream, "@")[0])
+	market := e.GetMarketById(marketId, client.MarketType)
+	if market == nil {
+		log.Error("no market for ws partial depth", zap.String("url", client.URL), zap.String("stream", stream))
+		return
+	}
+	var zero = int64(0)
+	var book = base.OrderBook{
+		Symbol: market.Symbol,
+		Asks:   base.NewOrderBookSide(false, 0, nil),
+		Bids:   base.NewOrderBookSide(true, 0, nil),
+	}
+	askKey, bidKey := "a", "b"
+	if _, ok := msg["lastUpdateId"]; ok {
+		// spot
+		askKey, bidKey = "asks", "bids"
+		book.Nonce, _ = utils.SafeMapVal(msg, "lastUpdateId", zero)
+		book.TimeStamp = e.MilliSeconds()
+	} else {
+		book.Nonce, _ = utils.SafeMapVal(msg, "u", zero)
+		book.TimeStamp, _ = utils.SafeMapVal(msg, "E", zero)
+	}
+	levels := parseSnapLevels(stream)
+	book.Asks.Depth = levels
+	book.Bids.Depth = levels
+	book.Asks.Exact = e.DecimalMode
+	book.Bids.Exact = e.DecimalMode
+	book.SetSide(msg[askKey], false)
+	book.SetSide(msg[bidKey], true)
+	base.WriteOutChan(e.Exchange, client.Prefix(bookSnapChanKey(client.MarketType, levels)), book, true)
+}
+
 func (e *Binance) getExgWsParams(symbols []string, suffix string) ([]string, *errs.Error) {
 	exgParams := make([]string, 0, len(symbols))
 	for _, sym := range symbols {
@@ -144,7 +324,8 @@ func (e *Binance) getExgWsParams(symbols []string, suffix string) ([]string, *er
 	}
 	return exgParams, nil
 }
-func (e *Binance) prepareBookArgs(method string, getJobInfo base.FuncGetWsJob, symbols []string, params *map[string]interface{}) (string, map[string]interface{}, *errs.Error) {
+func (e *Binance) prepareBookArgs(method string, getJobInfo func(marketType string) (*base.WsJobInfo, *errs.Error),
+	symbols []string, params *map[string]interface{}) (string, map[string]interface{}, *errs.Error) {
 	if len(symbols) == 0 {
 		return "", nil, errs.NewMsg(errs.CodeParamRequired, "symbols required for UnWatchOrderBooks")
 	}
@@ -153,22 +334,12 @@ func (e *Binance) prepareBookArgs(method string, getJobInfo base.FuncGetWsJob, s
 		return "", nil, err
 	}
 	var msgHash = market.Type + "@depth"
-	client, requestId, err := e.GetWsClient(market.Type, msgHash)
-	if err != nil {
-		return "", nil, err
-	}
 	var jobInfo *base.WsJobInfo
 	if getJobInfo != nil {
-		jobInfo, err = getJobInfo(client)
+		jobInfo, err = getJobInfo(market.Type)
 		if err != nil {
 			return "", nil, err
 		}
-		if jobInfo != nil {
-			jobInfo.ID = strconv.Itoa(requestId)
-			jobInfo.MsgHash = msgHash
-			jobInfo.Name = "depth"
-			jobInfo.Symbols = symbols
-		}
 	}
 	watchRate, ok := e.WsIntvs["WatchOrderBooks"]
 	if !ok {
@@ -178,13 +349,26 @@ func (e *Binance) prepareBookArgs(method string, getJobInfo base.FuncGetWsJob, s
 	if err != nil {
 		return "", nil, err
 	}
-	var request = map[string]interface{}{
-		"method": method,
-		"params": exgParams,
-		"id":     requestId,
+	var getJob func(streams []string) (*base.WsJobInfo, *errs.Error)
+	if jobInfo != nil {
+		symbolMap := make(map[string]string, len(symbols))
+		for i, stream := range exgParams {
+			symbolMap[stream] = symbols[i]
+		}
+		getJob = func(streams []string) (*base.WsJobInfo, *errs.Error) {
+			// 每个连接的订阅结果单独处理对应的symbols
+			info := *jobInfo
+			info.MsgHash = msgHash
+			info.Name = "depth"
+			info.Symbols = make([]string, len(streams))
+			for i, stream := range streams {
+				info.Symbols[i] = symbolMap[stream]
+			}
+			return &info, nil
+		}
 	}
-	err = client.Write(request, jobInfo)
-	chanKey := client.Prefix(msgHash)
+	chanKey := e.wsChanKey(market.Type, msgHash)
+	err = e.writeWsStreams(market.Type, method, chanKey, exgParams, getJob)
 	return chanKey, args, err
 }
 
@@ -205,14 +389,30 @@ func (e *Binance) WatchMyTrades(params *map[string]interface{}) (chan base.MyTra
 		return nil, err
 	}
 	args := utils.SafeParams(params)
-	chanKey := client.Prefix("mytrades")
+	chanKey := e.userChanKey(client.AccName, client.MarketType, "mytrades")
 	create := func(cap int) chan base.MyTrade { return make(chan base.MyTrade, cap) }
 	out := base.GetWsOutChan(e.Exchange, chanKey, create, args)
 	e.AddWsChanRefs(chanKey, "account")
 	return out, nil
 }
 
-func (e *Binance) handleOrderBook(client *base.WsClient, msg map[string]string) {
+func (e *Binance) UnWatchMyTrades(params *map[string]interface{}) *errs.Error {
+	return e.unWatchUserStream("mytrades", params)
+}
+
+type WsDepthUpdate struct {
+	Event      string      `json:"e"`
+	Time       int64       `json:"E"`
+	TransTime  int64       `json:"T"`
+	Symbol     string      `json:"s"`
+	FirstId    int64       `json:"U"`
+	LastId     int64       `json:"u"`
+	PrevLastId int64       `json:"pu"` // 仅合约
+	Bids       [][2]string `json:"b"`
+	Asks       [][2]string `json:"a"`
+}
+
+func (e *Binance) handleOrderBook(client *base.WsClient, msg *WsDepthUpdate) {
 	/*
 		# initial snapshot is fetched with ccxt's fetchOrderBook
 		# the feed does not include a snapshot, just the deltas
@@ -231,43 +431,39 @@ func (e *Binance) handleOrderBook(client *base.WsClient, msg map[string]string)
 		#         ]
 		#     }
 	*/
-	marketId, _ := msg["s"]
-	market := e.GetMarketById(marketId, client.MarketType)
+	market := e.GetMarketById(msg.Symbol, client.MarketType)
 	urlZap := zap.String("url", client.URL)
 	if market == nil {
-		log.Error("no market for ws depth update", urlZap, zap.String("symbol", marketId))
+		log.Error("no market for ws depth update", urlZap, zap.String("symbol", msg.Symbol))
 		return
 	}
+	e.bookLock.Lock()
+	defer e.bookLock.Unlock()
 	book, ok := e.OrderBooks[market.Symbol]
 	if !ok {
 		return
 	}
 	nonce := book.Nonce
 	if nonce == 0 {
+		// 快照未就绪或正在重新同步，缓存增量
 		book.Cache = append(book.Cache, msg)
-		log.Info("book nonce empty, cache")
+		if drop := len(book.Cache) - MaxBookCache; drop > 0 {
+			// 重新同步退避期间避免缓存无限增长，最旧的增量早于之后获取的快照，可丢弃
+			book.Cache = append(book.Cache[:0], book.Cache[drop:]...)
+		}
+		log.Debug("book nonce empty, cache", zap.String("symbol", market.Symbol))
 		return
 	}
-	var chanKey = client.Prefix("depth")
-	var zero = int64(0)
-	U, _ := utils.SafeMapVal(msg, "U", zero)
-	u, _ := utils.SafeMapVal(msg, "u", zero)
-	pu, _ := utils.SafeMapVal(msg, "pu", zero)
+	var chanKey = client.Prefix(client.MarketType + "@depth")
+	U, u, pu := msg.FirstId, msg.LastId, msg.PrevLastId
 	var err error
 	if pu == 0 {
 		// spot
 		// 4. Drop any event where u is <= lastUpdateId in the snapshot
 		if u > nonce {
-			timestamp, _ := utils.SafeMapVal(msg, "timestamp", zero)
-			valid := false
-			if timestamp == 0 {
-				// 5. The first processed event should have U <= lastUpdateId+1 AND u >= lastUpdateId+1
-				valid = U-1 <= nonce && u-1 >= nonce
-			} else {
-				// 6. While listening to the stream, each new event's U should be equal to the previous event's u+1.
-				valid = U-1 == nonce
-			}
-			if valid {
+			// 5. The first processed event should have U <= lastUpdateId+1 AND u >= lastUpdateId+1
+			// 6. While listening to the stream, each new event's U should be equal to the previous event's u+1.
+			if U-1 <= nonce && u-1 >= nonce {
 				e.handleOrderBookMsg(msg, book)
 				if nonce < book.Nonce {
 					base.WriteOutChan(e.Exchange, chanKey, *book, true)
@@ -295,32 +491,25 @@ func (e *Binance) handleOrderBook(client *base.WsClient, msg map[string]string)
 		}
 	}
 	if err != nil {
-		msgText, _ := sonic.MarshalString(msg)
-		log.Error("ws order book received an out-of-order nonce", urlZap, zap.String("msg", msgText),
-			zap.Int64("nonce", nonce))
-		delete(e.OrderBooks, market.Symbol)
+		stat := e.UpdateOdBookStat(market.Symbol, func(stat *base.OdBookStat) {
+			stat.Gaps += 1
+			stat.LastGapMS = e.MilliSeconds()
+		})
+		log.Warn("ws order book received an out-of-order nonce, resync", urlZap, zap.String("symbol", market.Symbol),
+			zap.Int64("nonce", nonce), zap.Int64("U", U), zap.Int64("u", u), zap.Int("gaps", stat.Gaps))
+		// 标记订单簿无效，缓存后续增量，异步重新获取快照
+		book.Nonce = 0
+		book.Cache = []interface{}{msg}
+		go e.resyncOrderBook(client, market.Symbol)
 	}
 }
 
-func (e *Binance) handleOrderBookMsg(msg map[string]string, book *base.OrderBook) {
-	var zero = int64(0)
-	u, _ := utils.SafeMapVal(msg, "u", zero)
-	at, ok := msg["a"]
-	if !ok {
-		log.Error("asks not found in ws depth")
-		at = "[]"
-	}
-	book.SetSide(at, false)
-	bt, ok := msg["b"]
-	if !ok {
-		log.Error("bids not found in ws depth")
-		bt = "[]"
-	}
-	book.SetSide(bt, true)
-	book.Nonce = u
-	timestamp, err := utils.SafeMapVal(msg, "E", zero)
-	if err == nil {
-		book.TimeStamp = timestamp
+func (e *Binance) handleOrderBookMsg(msg *WsDepthUpdate, book *base.OrderBook) {
+	book.UpdateSide(msg.Asks, false)
+	book.UpdateSide(msg.Bids, true)
+	book.Nonce = msg.LastId
+	if msg.Time > 0 {
+		book.TimeStamp = msg.Time
 	}
 }
 
@@ -336,11 +525,13 @@ func (e *Binance) HandleOrderBookSub(client *base.WsClient, msg map[string]strin
 	symbols := info.Symbols
 	var failSymbols []string
 	for _, symbol := range symbols {
-		delete(e.OrderBooks, symbol)
+		e.bookLock.Lock()
 		e.OrderBooks[symbol] = &base.OrderBook{
 			Symbol: symbol,
-			Cache:  make([]map[string]string, 0),
+			Cache:  make([]interface{}, 0),
 		}
+		e.bookJobs[symbol] = info
+		e.bookLock.Unlock()
 		err = e.fetchOrderBookSnapshot(client, symbol, info)
 		if err != nil {
 			failSymbols = append(failSymbols, symbol)
@@ -356,6 +547,60 @@ func (e *Binance) HandleOrderBookSub(client *base.WsClient, msg map[string]strin
 	}
 }
 
+/*
+resyncOrderBook
+增量深度出现断档后，重新获取快照并回放缓存的增量；失败时指数退避重试，直到成功或取消订阅
+*/
+func (e *Binance) resyncOrderBook(client *base.WsClient, symbol string) {
+	e.bookLock.Lock()
+	info, ok := e.bookJobs[symbol]
+	if !ok || e.bookSyncing[symbol] {
+		e.bookLock.Unlock()
+		return
+	}
+	e.bookSyncing[symbol] = true
+	e.bookLock.Unlock()
+	defer func() {
+		e.bookLock.Lock()
+		delete(e.bookSyncing, symbol)
+		e.bookLock.Unlock()
+	}()
+	symZap := zap.String("symbol", symbol)
+	wait := time.Second
+	for {
+		if client.IsClosed() {
+			log.Warn("ws closed, stop resync order book", symZap)
+			return
+		}
+		e.bookLock.Lock()
+		cur := e.bookJobs[symbol]
+		e.bookLock.Unlock()
+		if cur != info {
+			// 已取消订阅或重新订阅
+			return
+		}
+		err := e.fetchOrderBookSnapshot(client, symbol, info)
+		e.UpdateOdBookStat(symbol, func(stat *base.OdBookStat) {
+			if err == nil {
+				stat.Resyncs += 1
+			} else {
+				stat.ResyncFails += 1
+			}
+		})
+		if err == nil {
+			log.Info("resync order book ok", symZap)
+			return
+		}
+		log.Warn("resync order book fail, retry later", symZap, zap.Duration("wait", wait), zap.Error(err))
+		time.Sleep(wait)
+		wait = min(wait*2, time.Second*30)
+	}
+}
+
+/*
+fetchOrderBookSnapshot
+获取订单簿快照，回放缓存的增量后替换本地订单簿，并推送一个Reset为true的订单簿
+*/
 func (e *Binance) fetchOrderBookSnapshot(client *base.WsClient, symbol string, info *base.WsJobInfo) *errs.Error {
 	// 3. Get a depth snapshot from https://www.binance.com/api/v1/depth?symbol=BNBBTC&limit=1000 .
 	// default 100, max 1000, valid limits 5, 10, 20, 50, 100, 500, 1000
@@ -363,54 +608,59 @@ func (e *Binance) fetchOrderBookSnapshot(client *base.WsClient, symbol string, i
 	if err != nil {
 		return err
 	}
+	e.bookLock.Lock()
+	defer e.bookLock.Unlock()
 	oldBook, ok := e.OrderBooks[symbol]
-	var cache []map[string]string
-	if ok && len(oldBook.Cache) > 0 {
-		cache = oldBook.Cache
+	if !ok {
+		// 已取消订阅
+		return nil
 	}
-	e.OrderBooks[symbol] = book
-	if len(cache) > 0 {
-		var zero = int64(0)
-		for _, msg := range cache {
-			U, _ := utils.SafeMapVal(msg, "U", zero)
-			u, _ := utils.SafeMapVal(msg, "u", zero)
-			pu, _ := utils.SafeMapVal(msg, "pu", zero)
-			nonce := book.Nonce
-			if e.IsContract(client.MarketType) {
-				//4. Drop any event where u is < lastUpdateId in the snapshot
-				if u < nonce {
-					continue
-				}
-				// 5. The first processed event should have U <= lastUpdateId AND u >= lastUpdateId
-				if U <= nonce && u >= nonce || pu == nonce {
-					e.handleOrderBookMsg(msg, book)
-				}
-			} else {
-				// 4. Drop any event where u is <= lastUpdateId in the snapshot
-				if u <= nonce {
-					continue
-				}
-				// 5. The first processed event should have U <= lastUpdateId+1 AND u >= lastUpdateId+1
-				if U-1 <= nonce && u-1 >= nonce {
-					e.handleOrderBookMsg(msg, book)
-				}
+	for _, item := range oldBook.Cache {
+		msg, ok := item.(*WsDepthUpdate)
+		if !ok {
+			continue
+		}
+		U, u, pu := msg.FirstId, msg.LastId, msg.PrevLastId
+		nonce := book.Nonce
+		var valid bool
+		if e.IsContract(client.MarketType) {
+			//4. Drop any event where u is < lastUpdateId in the snapshot
+			if u < nonce {
+				continue
 			}
+			// 5. The first processed event should have U <= lastUpdateId AND u >= lastUpdateId
+			valid = U <= nonce && u >= nonce || pu == nonce
+		} else {
+			// 4. Drop any event where u is <= lastUpdateId in the snapshot
+			if u <= nonce {
+				continue
+			}
+			// 5. The first processed event should have U <= lastUpdateId+1 AND u >= lastUpdateId+1
+			valid = U-1 <= nonce && u-1 >= nonce
+		}
+		if !valid {
+			// 快照比缓存的增量旧，保留缓存，稍后重试
+			return errs.NewMsg(errs.CodeInvalidResponse, "depth snapshot %v older than cached update %v", nonce, U)
 		}
+		e.handleOrderBookMsg(msg, book)
 	}
-	base.WriteOutChan(e.Exchange, info.MsgHash, *book, true)
+	e.OrderBooks[symbol] = book
+	res := *book
+	res.Reset = true
+	base.WriteOutChan(e.Exchange, client.Prefix(info.MsgHash), res, true)
 	return nil
 }
 
 /*
 parseMyTrade
-将websocket收到的交易转为Trade，注意Symbol和fee.Currency未进行标准化
+将websocket收到的交易转为Trade，注意Symbol和fee.Currency未进行标准化。exact为true时额外解析decimal精确值
 
 	public trade
 	public agg trade
 	private spot trade
 	private contract trade
 */
-func parseMyTrade(msg map[string]string) base.MyTrade {
+func parseMyTrade(msg map[string]string, exact bool) base.MyTrade {
 	var res = base.MyTrade{}
 	zeroFlt := float64(0)
 	// execType, _ := utils.SafeMapVal(msg, "x", "")
@@ -443,10 +693,24 @@ func parseMyTrade(msg map[string]string) base.MyTrade {
 	res.Symbol, _ = utils.SafeMapVal(msg, "s", "")
 	side, _ := utils.SafeMapVal(msg, "S", "")
 	res.Side = strings.ToLower(side)
+	if exact {
+		dec := &base.TradeDec{
+			Price:   base.ParseDec(msg["L"]),
+			Amount:  base.ParseDec(msg["l"]),
+			Cost:    base.ParseDec(msg["Y"]),
+			FeeCost: base.ParseDec(msg["n"]),
+			Filled:  base.ParseDec(msg["z"]),
+			Average: base.ParseDec(msg["ap"]),
+		}
+		if dec.Cost.IsZero() {
+			dec.Cost = dec.Price.Mul(dec.Amount)
+		}
+		res.Dec = dec
+	}
 	return res
 }
 
-func parsePubTrade(msg map[string]string) base.Trade {
+func parsePubTrade(msg map[string]string, exact bool) base.Trade {
 	var res = base.Trade{}
 	zeroFlt := float64(0)
 	res.ID, _ = utils.SafeMapVal(msg, "a", "")
@@ -459,5 +723,13 @@ func parsePubTrade(msg map[string]string) base.Trade {
 	res.Symbol, _ = utils.SafeMapVal(msg, "s", "")
 	side, _ := utils.SafeMapVal(msg, "S", "")
 	res.Side = strings.ToLower(side)
+	if exact {
+		dec := &base.TradeDec{
+			Price:  base.ParseDec(msg["p"]),
+			Amount: base.ParseDec(msg["q"]),
+		}
+		dec.Cost = dec.Price.Mul(dec.Amount)
+		res.Dec = dec
+	}
 	return res
 }
@@ -222,3 +222,67 @@ mainFor:
 		}
 	}
 }
+
+func TestWatchOrderBookSnapshots(t *testing.T) {
+	exg := getBinance(nil)
+	symbols := []string{"ETH/USDT:USDT", "BTC/USDT:USDT"}
+	out, err := exg.WatchOrderBookSnapshots(symbols, 5, 100, nil)
+	if err != nil {
+		panic(err)
+	}
+	count := 0
+mainFor:
+	for {
+		select {
+		case book, ok := <-out:
+			if !ok {
+				log.Info("read out chan fail, break")
+				break mainFor
+			}
+			count += 1
+			if count == 20 {
+				err = exg.UnWatchOrderBookSnapshots(symbols, nil)
+				if err != nil {
+					panic(err)
+				}
+			}
+			log.Info("book", zap.String("symbol", book.Symbol), zap.Int64("nonce", book.Nonce),
+				zap.Any("asks", book.Asks.Rows), zap.Any("bids", book.Bids.Rows))
+		}
+	}
+}
+
+const benchDepthMsg = `{"stream":"ethusdt@depth@100ms","data":{"e":"depthUpdate","E":1703936451333,"T":1703936451329,"s":"ETHUSDT","U":3743827045045,"u":3743827048488,"pu":3743827044911,"b":[["2285.04","1.906"],["2285.05","3.400"],["2285.27","6.608"],["2285.28","14.331"],["2285.50","74.587"],["2285.51","12.041"],["2285.73","1.450"],["2285.74","45.150"]],"a":[["2285.75","10.124"],["2285.96","0.910"],["2285.97","3.012"],["2286.19","19.561"],["2286.20","2.442"],["2286.42","0.188"],["2286.43","7.330"],["2286.65","1.004"]]}}`
+
+// BenchmarkDepthMapDecode 旧的解析方式：先解析为map[string]string，再二次解析深度数组
+func BenchmarkDepthMapDecode(b *testing.B) {
+	b.ReportAllocs()
+	var zero = int64(0)
+	for i := 0; i < b.N; i++ {
+		msg, err := base.NewWsMsg(benchDepthMsg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, _ = utils.SafeMapVal(msg.Object, "U", zero)
+		_, _ = utils.SafeMapVal(msg.Object, "u", zero)
+		_, _ = utils.SafeMapVal(msg.Object, "pu", zero)
+		var asks, bids = make([][2]string, 0), make([][2]string, 0)
+		_ = sonic.UnmarshalString(msg.Object["a"], &asks)
+		_ = sonic.UnmarshalString(msg.Object["b"], &bids)
+	}
+}
+
+// BenchmarkDepthTypedDecode 读取事件类型后直接解析为WsDepthUpdate
+func BenchmarkDepthTypedDecode(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		event, _, payload := base.PeekWsEvent(benchDepthMsg)
+		if event != "depthUpdate" {
+			b.Fatal("bad event: " + event)
+		}
+		var msg = WsDepthUpdate{}
+		if err := sonic.UnmarshalString(payload, &msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -37,6 +37,11 @@ var (
 	ParamMethod             = base.ParamMethod
 	ParamInterval           = base.ParamInterval
 	ParamAccount            = base.ParamAccount
+	ParamReloadSecs         = base.ParamReloadSecs
+	ParamRefPrice           = base.ParamRefPrice
+	ParamFetchRefPrice      = base.ParamFetchRefPrice
+	ParamLeverageCheck      = base.ParamLeverageCheck
+	ParamNotional           = base.ParamNotional
 )
 
 const (
@@ -68,6 +73,13 @@ const (
 	OptRetries         = base.OptRetries
 	OptWsConn          = base.OptWsConn
 	OptAuthRefreshSecs = base.OptAuthRefreshSecs
+	OptWsRecord        = base.OptWsRecord
+	OptHttpCassette    = base.OptHttpCassette
+	OptCassetteMode    = base.OptCassetteMode
+	OptMarketCache     = base.OptMarketCache
+	OptMarketCacheSecs = base.OptMarketCacheSecs
+	OptValidateOrder   = base.OptValidateOrder
+	OptDecimalMode     = base.OptDecimalMode
 	OptPositionMethod  = base.OptPositionMethod
 )
 
@@ -77,6 +89,12 @@ const (
 	PrecModeTickSize     = utils.PrecModeTickSize
 )
 
+const (
+	RoundNearest = utils.RoundNearest
+	RoundDown    = utils.RoundDown
+	RoundUp      = utils.RoundUp
+)
+
 const (
 	MarketSpot    = base.MarketSpot   // 现货交易
 	MarketMargin  = base.MarketMargin // 保证金杠杆现货交易 margin trade
@@ -87,6 +105,22 @@ const (
 	MarketFuture  = base.MarketFuture // 有交割日的期货 for expiring futures contracts that have a delivery/settlement date
 )
 
+const (
+	OptionTypeCall = base.OptionTypeCall
+	OptionTypePut  = base.OptionTypePut
+)
+
+const (
+	ContCurrentQuarter = base.ContCurrentQuarter
+	ContNextQuarter    = base.ContNextQuarter
+)
+
+const (
+	ContAdjustNone  = base.ContAdjustNone
+	ContAdjustAdd   = base.ContAdjustAdd
+	ContAdjustRatio = base.ContAdjustRatio
+)
+
 const (
 	MarginCross    = base.MarginCross
 	MarginIsolated = base.MarginIsolated
@@ -138,6 +172,15 @@ var (
 	ParamChanCap          = base.ParamChanCap
 )
 
+var (
+	ParseSymbol = base.ParseSymbol
+	BuildSymbol = base.BuildSymbol
+
+	ParseContSymbol = base.ParseContSymbol
+	IsContSymbol    = base.IsContSymbol
+	NewContResolver = base.NewContResolver
+)
+
 type FuncSign = base.FuncSign
 type FuncFetchCurr = base.FuncFetchCurr
 type FuncFetchMarkets = base.FuncFetchMarkets
@@ -166,6 +209,7 @@ type LimitRange = base.LimitRange
 type Market = base.Market
 type Precision = base.Precision
 type MarketLimits = base.MarketLimits
+type MarketRules = base.MarketRules
 type MarketMap = base.MarketMap
 type MarketArrMap = base.MarketArrMap
 type Ticker = base.Ticker
@@ -174,14 +218,39 @@ type Kline = base.Kline
 type SymbolKline = base.SymbolKline
 type Balances = base.Balances
 type Asset = base.Asset
+type AssetDec = base.AssetDec
 type Position = base.Position
+type PosDec = base.PosDec
 type Order = base.Order
+type OrderDec = base.OrderDec
 type Trade = base.Trade
+type TradeDec = base.TradeDec
 type MyTrade = base.MyTrade
+type Liquidation = base.Liquidation
+type AccountEvent = base.AccountEvent
 type Fee = base.Fee
 type OrderBook = base.OrderBook
 type OrderBookSide = base.OrderBookSide
+type OdBookStat = base.OdBookStat
 type WsJobInfo = base.WsJobInfo
 type WsMsg = base.WsMsg
 type WsClient = base.WsClient
 type WebSocket = base.WebSocket
+type WsFrame = base.WsFrame
+type WsRecorder = base.WsRecorder
+type ReplayWsConn = base.ReplayWsConn
+type Cassette = base.Cassette
+type MarketCache = base.MarketCache
+type MarketChange = base.MarketChange
+type SymbolParts = base.SymbolParts
+type OptionChain = base.OptionChain
+type OptionStrike = base.OptionStrike
+type OptionQuote = base.OptionQuote
+type LeverageTier = base.LeverageTier
+type ContSymbol = base.ContSymbol
+type ContRoll = base.ContRoll
+type ContSegment = base.ContSegment
+type ContExchange = base.ContExchange
+type ContResolver = base.ContResolver
+type OrderCheck = base.OrderCheck
+type OrderViolation = base.OrderViolation
@@ -24,6 +24,9 @@ const (
 	CodeInvalidTimeFrame
 	CodePrecDecFail
 	CodeBadExgName
+	CodeIOWriteFail
+	CodeIOReadFail
+	CodeOrderInvalid
 )
 
 var (
@@ -3,20 +3,20 @@ module github.com/banbox/banexg
 go 1.21.4
 
 require (
+	github.com/bytedance/sonic v1.10.2
+	github.com/gorilla/websocket v1.5.1
+	github.com/h2non/gock v1.2.0
+	github.com/shopspring/decimal v1.3.1
 	go.uber.org/zap v1.26.0
 	golang.org/x/text v0.13.0
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1
 )
 
 require (
-	github.com/bytedance/sonic v1.10.2 // indirect
 	github.com/chenzhuoyu/base64x v0.0.0-20230717121745-296ad89f973d // indirect
 	github.com/chenzhuoyu/iasm v0.9.0 // indirect
-	github.com/gorilla/websocket v1.5.1 // indirect
-	github.com/h2non/gock v1.2.0 // indirect
 	github.com/h2non/parth v0.0.0-20190131123155-b4df798d6542 // indirect
 	github.com/klauspost/cpuid/v2 v2.0.9 // indirect
-	github.com/shopspring/decimal v1.3.1 // indirect
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	golang.org/x/arch v0.0.0-20210923205945-b76863e36670 // indirect
@@ -15,6 +15,12 @@ const (
 	PrecModeTickSize     = 4
 )
 
+const (
+	RoundNearest = iota // 四舍五入
+	RoundDown           // 向零截断
+	RoundUp             // 远离零进位
+)
+
 var (
 	regTrimEndZero = regexp.MustCompile(`0+$`)
 )
@@ -169,6 +175,43 @@ func DecToPrec(num string, countMode int, precision string, isRound, padZero boo
 	return precise.String(), nil
 }
 
+/*
+DecToPrecRound
+同DecToPrec，rounding指定取整方式：RoundNearest/RoundDown/RoundUp
+*/
+func DecToPrecRound(num string, countMode int, precision string, rounding int, padZero bool) (string, error) {
+	if rounding == RoundNearest || rounding == RoundDown {
+		return DecToPrec(num, countMode, precision, rounding == RoundNearest, padZero)
+	} else if rounding != RoundUp {
+		return "", fmt.Errorf("invalid rounding %d", rounding)
+	}
+	trunc, err := DecToPrec(num, countMode, precision, false, false)
+	if err != nil {
+		return "", err
+	}
+	numVal, _ := decimal.NewFromString(num)
+	truncVal, err := decimal.NewFromString(trunc)
+	if err != nil {
+		return "", err
+	}
+	if truncVal.Equal(numVal) {
+		return DecToPrec(trunc, countMode, precision, false, padZero)
+	}
+	precVal, _ := decimal.NewFromString(precision)
+	var unit decimal.Decimal
+	if countMode == PrecModeTickSize {
+		unit = precVal
+	} else if countMode == PrecModeDecimalPlace {
+		unit = decimal.New(1, -int32(precVal.IntPart()))
+	} else {
+		unit = decimal.New(1, adjusted(numVal)-int32(precVal.IntPart())+1)
+	}
+	if numVal.IsNegative() {
+		unit = unit.Neg()
+	}
+	return DecToPrec(truncVal.Add(unit).String(), countMode, precision, false, padZero)
+}
+
 // 获取与Python中Decimal.adjusted()类似的值
 func adjusted(dec decimal.Decimal) int32 {
 	// 计算有效数字（coefficient）
@@ -201,3 +244,13 @@ func PrecFloat64Str(num float64, prec int, isRound bool) (string, error) {
 	precStr := strconv.Itoa(prec)
 	return DecToPrec(numStr, PrecModeDecimalPlace, precStr, isRound, false)
 }
+
+/*
+PrecFloat64Round
+按countMode和rounding对浮点数取近似值，precision为小数位数、有效数字个数或最小变动单位
+*/
+func PrecFloat64Round(num float64, countMode int, precision float64, rounding int) (string, error) {
+	numStr := strconv.FormatFloat(num, 'f', -1, 64)
+	precStr := strconv.FormatFloat(precision, 'f', -1, 64)
+	return DecToPrecRound(numStr, countMode, precStr, rounding, false)
+}
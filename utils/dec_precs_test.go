@@ -172,6 +172,38 @@ func TestNumToPrecs(t *testing.T) {
 	}
 }
 
+func TestDecToPrecRound(t *testing.T) {
+	items := []struct {
+		text      string
+		precision string
+		countMode int
+		rounding  int
+		output    string
+	}{
+		{"1.23", "0.5", PrecModeTickSize, RoundNearest, "1"},
+		{"1.26", "0.5", PrecModeTickSize, RoundNearest, "1.5"},
+		{"1.26", "0.5", PrecModeTickSize, RoundDown, "1"},
+		{"1.26", "0.5", PrecModeTickSize, RoundUp, "1.5"},
+		{"1.5", "0.5", PrecModeTickSize, RoundUp, "1.5"},
+		{"12", "5", PrecModeTickSize, RoundUp, "15"},
+		{"12", "5", PrecModeTickSize, RoundDown, "10"},
+		{"-12", "5", PrecModeTickSize, RoundUp, "-15"},
+		{"1.231", "2", PrecModeDecimalPlace, RoundUp, "1.24"},
+		{"1.239", "2", PrecModeDecimalPlace, RoundDown, "1.23"},
+		{"1.235", "2", PrecModeDecimalPlace, RoundNearest, "1.24"},
+		{"123.4", "2", PrecModeSignifDigits, RoundUp, "130"},
+	}
+	for _, it := range items {
+		outText, err := DecToPrecRound(it.text, it.countMode, it.precision, it.rounding, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if outText != it.output {
+			t.Errorf("Fail %s %v %v %v out: %s exp: %s", it.text, it.precision, it.countMode, it.rounding, outText, it.output)
+		}
+	}
+}
+
 func TestAdjust(t *testing.T) {
 	cases := []struct {
 		input  string
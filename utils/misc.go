@@ -60,16 +60,30 @@ func EncodeURIComponent(str string, safe string) string {
 	return escapeStr
 }
 
+/*
+GetMapFloat
+读取字典中的浮点数，值可以是字符串或数字，不存在或无法解析时返回0
+*/
 func GetMapFloat(data map[string]interface{}, key string) float64 {
 	if rawVal, ok := data[key]; ok {
-		if rawVal == nil {
-			return 0.0
-		}
-		val, err := strconv.ParseFloat(rawVal.(string), 64)
-		if err != nil {
-			return 0.0
+		switch val := rawVal.(type) {
+		case string:
+			res, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return 0.0
+			}
+			return res
+		case float64:
+			return val
+		case float32:
+			return float64(val)
+		case int64:
+			return float64(val)
+		case int32:
+			return float64(val)
+		case int:
+			return float64(val)
 		}
-		return val
 	}
 	return 0.0
 }